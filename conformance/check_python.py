@@ -0,0 +1,81 @@
+#!/usr/bin/env python3
+"""Run the Python crawler against the conformance corpus and compare its
+results with expected.json."""
+import asyncio
+import json
+import os
+import sys
+import threading
+from http.server import BaseHTTPRequestHandler, ThreadingHTTPServer
+
+here = os.path.dirname(os.path.abspath(__file__))
+sys.path.insert(0, os.path.join(os.path.dirname(here), 'python-crawler'))
+
+from main import crawl_urls
+
+
+def load_json(name):
+    with open(os.path.join(here, name)) as f:
+        return json.load(f)
+
+
+def make_handler(routes):
+    """Serve the corpus exactly as routes.json describes it."""
+    class Handler(BaseHTTPRequestHandler):
+        def do_GET(self):
+            route = routes.get(self.path)
+            if route is None:
+                self.send_error(404)
+                return
+            body = b''
+            if route.get('file'):
+                with open(os.path.join(here, 'corpus', route['file']), 'rb') as f:
+                    body = f.read()
+            self.send_response(route['status'])
+            if route.get('location'):
+                self.send_header('Location', route['location'])
+            if route.get('content_type'):
+                self.send_header('Content-Type', route['content_type'])
+            self.send_header('Content-Length', str(len(body)))
+            self.end_headers()
+            self.wfile.write(body)
+
+        def log_message(self, format, *args):
+            pass
+
+    return Handler
+
+
+def main():
+    routes = {route['path']: route for route in load_json('routes.json')}
+    expected = load_json('expected.json')
+
+    server = ThreadingHTTPServer(('127.0.0.1', 0), make_handler(routes))
+    threading.Thread(target=server.serve_forever, daemon=True).start()
+    base = f"http://127.0.0.1:{server.server_port}"
+
+    try:
+        results = asyncio.run(crawl_urls([base + want['path'] for want in expected], 4))
+    finally:
+        server.shutdown()
+
+    got = {result['url'][len(base):]: result for result in results}
+    mismatches = 0
+    for want in expected:
+        result = got.get(want['path'])
+        if result is None:
+            print(f"{want['path']}: no result")
+            mismatches += 1
+        elif result['status'] != want['status'] or result['title'] != want['title']:
+            print(f"{want['path']}: got status {result['status']} title {result['title']!r}, "
+                  f"want status {want['status']} title {want['title']!r}")
+            mismatches += 1
+
+    if mismatches:
+        print(f"{mismatches} of {len(expected)} conformance cases failed")
+        sys.exit(1)
+    print(f"All {len(expected)} conformance cases passed")
+
+
+if __name__ == '__main__':
+    main()
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Check the URLs given as arguments for an ad-hoc crawl
+func checkAdHocURLs(urls []string) error {
+	for _, urlStr := range urls {
+		if err := validateURL(urlStr); err != nil {
+			return fmt.Errorf("invalid URL %q: %s", urlStr, err)
+		}
+	}
+	return nil
+}
+
+// Print the results of an ad-hoc crawl to stdout as indented JSON, one
+// document per URL, and return the exit code: exitFailures when any fetch
+// failed
+func printAdHocResults(results []Result) int {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	code := exitOK
+	for _, result := range results {
+		if err := encoder.Encode(result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding result: %s\n", err)
+			return exitError
+		}
+		if result.SkipReason == "" && !resultSucceeded(result) {
+			code = exitFailures
+		}
+	}
+	return code
+}
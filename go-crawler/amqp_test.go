@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The sessions in testdata/amqp replay a broker whose frames were encoded
+// with amqp091-go. The broker offers its smallest frame size, 4096 bytes.
+func amqpSessionURL(addr, password, queue string) string {
+	return "amqp://crawler:" + password + "@" + addr + "/crawl?queue=" + queue
+}
+
+// The sink declares its queue once the passive declare finds none, splits a
+// large result over body frames, and fails on a message the broker refuses
+func TestAMQPSinkSession(t *testing.T) {
+	devVersion(t)
+	addr := replaySession(t, loadSession(t, "testdata/amqp/sink.txt"))
+	stopped := false
+	sink, err := openAMQPSink(amqpSessionURL(addr, "secret", "results"), sinkConfig{stop: func() { stopped = true }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(Result{URL: "https://a.example/", Title: strings.Repeat("A", 5000), Status: 200, Domain: "a.example"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(Result{URL: "https://b.example/", Status: 500, Domain: "b.example"}); err == nil || !strings.Contains(err.Error(), "refused a message") {
+		t.Errorf("got %v for a refused message", err)
+	}
+	if !stopped {
+		t.Errorf("the crawl wasn't stopped")
+	}
+	if err := sink.Close(); err == nil || !strings.Contains(err.Error(), "queue results") {
+		t.Errorf("got %v from Close, want the publishing failure", err)
+	}
+	if report := sink.(*amqpSink).report(); report != "1 results published to queue results" {
+		t.Errorf("report %q", report)
+	}
+}
+
+// The source reassembles a body split over frames, acknowledges a URL once
+// its result is recorded and rejects a message without one
+func TestAMQPSourceSession(t *testing.T) {
+	devVersion(t)
+	addr := replaySession(t, loadSession(t, "testdata/amqp/source.txt"))
+	source, err := openAMQPSource(amqpSessionURL(addr, "secret", "urls"), 2, time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var submitted []string
+	err = source.feed(context.Background(), &fetchOptions{}, func(url string) bool {
+		if url != "" {
+			submitted = append(submitted, url)
+			source.done(Result{URL: url})
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(submitted) != 1 || submitted[0] != "https://a.example/" || source.consumed != 1 || source.rejected != 1 {
+		t.Errorf("submitted %q, consumed %d, rejected %d", submitted, source.consumed, source.rejected)
+	}
+	if err := source.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAMQPLoginRefused(t *testing.T) {
+	devVersion(t)
+	target, err := parseAMQPURL(amqpSessionURL(replaySession(t, loadSession(t, "testdata/amqp/login-refused.txt")), "wrong", "urls"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dialAMQP(target)
+	var refused amqpError
+	if !errors.As(err, &refused) || refused.code != 403 {
+		t.Errorf("got %v, want the broker's 403", err)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request rate of an API client whose key doesn't set one
+const (
+	defaultAPIRPS   = 5
+	defaultAPIBurst = 20
+)
+
+// apiKey is an entry of the -api-keys file
+type apiKey struct {
+	Name      string  `json:"name"`
+	Key       string  `json:"key"`        // the key itself
+	KeySHA256 string  `json:"key_sha256"` // or its SHA-256 in hex, keeping the key out of the file
+	RPS       float64 `json:"rps"`        // requests per second, defaultAPIRPS when 0
+	Burst     int     `json:"burst"`      // requests allowed at once after a pause
+
+	digest []byte
+}
+
+// Load the API keys file: a JSON list of named keys with their rate limits
+func loadAPIKeys(filePath string) ([]apiKey, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var keys []apiKey
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&keys); err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no keys", filePath)
+	}
+	names := make(map[string]bool)
+	for i := range keys {
+		key := &keys[i]
+		switch {
+		case key.Name == "":
+			return nil, fmt.Errorf("%s: key %d has no name", filePath, i+1)
+		case names[key.Name]:
+			return nil, fmt.Errorf("%s: key name %s is used twice", filePath, key.Name)
+		case (key.Key == "") == (key.KeySHA256 == ""):
+			return nil, fmt.Errorf("%s: key %s needs one of key and key_sha256", filePath, key.Name)
+		case key.Key != "" && len(key.Key) < 16:
+			return nil, fmt.Errorf("%s: key %s is shorter than 16 characters", filePath, key.Name)
+		case key.RPS < 0 || key.Burst < 0:
+			return nil, fmt.Errorf("%s: key %s: rps and burst must not be negative", filePath, key.Name)
+		}
+		names[key.Name] = true
+		if key.Key != "" {
+			digest := sha256.Sum256([]byte(key.Key))
+			key.digest = digest[:]
+		} else if key.digest, err = hex.DecodeString(key.KeySHA256); err != nil || len(key.digest) != sha256.Size {
+			return nil, fmt.Errorf("%s: key %s: key_sha256 must be 64 hex digits", filePath, key.Name)
+		}
+		if key.RPS == 0 {
+			key.RPS = defaultAPIRPS
+		}
+		if key.Burst == 0 {
+			key.Burst = max(defaultAPIBurst, int(math.Ceil(key.RPS)))
+		}
+	}
+	return keys, nil
+}
+
+// apiAuth admits job API requests that carry a known API key, a client
+// certificate signed by the -client-ca, or both when both are set up. Each
+// client has a rate limit of its own.
+type apiAuth struct {
+	keys       []apiKey
+	clientCert bool
+
+	mu       sync.Mutex
+	limiters map[string]*rateLimiter
+}
+
+func newAPIAuth(keys []apiKey, clientCert bool) *apiAuth {
+	return &apiAuth{keys: keys, clientCert: clientCert, limiters: make(map[string]*rateLimiter)}
+}
+
+// Context key of the client name a request was admitted under
+type apiClientKey struct{}
+
+// Name of the client an admitted request came from, "" without auth
+func apiClient(r *http.Request) string {
+	name, _ := r.Context().Value(apiClientKey{}).(string)
+	return name
+}
+
+// The API key a request carries, as a bearer token or an X-API-Key header
+func requestAPIKey(r *http.Request) string {
+	if value, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(value)
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// Identify the client of a request. Keys are compared by digest in constant
+// time, so response times don't leak how much of a key was right.
+func (a *apiAuth) identify(r *http.Request) (string, float64, int, error) {
+	name, rps, burst := "", float64(defaultAPIRPS), defaultAPIBurst
+	if a.clientCert {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			return "", 0, 0, errors.New("client certificate required")
+		}
+		name = "cert:" + r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+	if len(a.keys) > 0 {
+		presented := requestAPIKey(r)
+		if presented == "" {
+			return "", 0, 0, errors.New("API key required")
+		}
+		digest := sha256.Sum256([]byte(presented))
+		var found *apiKey
+		for i := range a.keys {
+			if subtle.ConstantTimeCompare(digest[:], a.keys[i].digest) == 1 {
+				found = &a.keys[i]
+			}
+		}
+		if found == nil {
+			return "", 0, 0, errors.New("invalid API key")
+		}
+		name, rps, burst = found.Name, found.RPS, found.Burst
+	}
+	return name, rps, burst, nil
+}
+
+// Take a request slot for a client. Returns 0 when the request may go ahead,
+// otherwise how long until it could.
+func (a *apiAuth) limit(name string, rps float64, burst int) time.Duration {
+	a.mu.Lock()
+	limiter := a.limiters[name]
+	if limiter == nil {
+		limiter = newRateLimiter(rps, burst)
+		a.limiters[name] = limiter
+	}
+	a.mu.Unlock()
+	return limiter.tryTake()
+}
+
+// Wrap a handler so only identified clients within their rate reach it
+func (a *apiAuth) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, rps, burst, err := a.identify(r)
+		if err != nil {
+			if len(a.keys) > 0 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="crawler"`)
+			}
+			writeJSON(w, http.StatusUnauthorized, jobError{err.Error()})
+			return
+		}
+		if wait := a.limit(name, rps, burst); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeJSON(w, http.StatusTooManyRequests, jobError{"rate limit exceeded for " + name})
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiClientKey{}, name)))
+	})
+}
+
+// Build the TLS config of the job server. With a client CA, certificates
+// are verified when given; the job API then insists on one, while health
+// probes, which can't present one, still get through.
+func serverTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// Report whether a listen address only accepts connections from this machine
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
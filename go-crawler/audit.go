@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// auditSet lists the audits enabled with -audit
+type auditSet struct {
+	security      bool
+	accessibility bool
+	seo           bool
+}
+
+// Parse a comma separated list of audit names
+func parseAudits(value string) (auditSet, error) {
+	var audits auditSet
+	for _, name := range strings.Split(value, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "security":
+			audits.security = true
+		case "a11y", "accessibility":
+			audits.accessibility = true
+		case "seo":
+			audits.seo = true
+		default:
+			return audits, fmt.Errorf("unknown audit %q (available: security, a11y, seo)", name)
+		}
+	}
+	return audits, nil
+}
+
+// AuditCheck is the outcome of a single audit rule
+type AuditCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// SecurityAudit scores a response's security headers
+type SecurityAudit struct {
+	Score  int          `json:"score"` // percentage of checks passed
+	Checks []AuditCheck `json:"checks"`
+}
+
+// Security header checks, in report order
+var securityCheckNames = []string{
+	"strict-transport-security",
+	"content-security-policy",
+	"x-content-type-options",
+	"x-frame-options",
+	"referrer-policy",
+}
+
+var validReferrerPolicies = map[string]bool{
+	"no-referrer":                     true,
+	"no-referrer-when-downgrade":      true,
+	"origin":                          true,
+	"origin-when-cross-origin":        true,
+	"same-origin":                     true,
+	"strict-origin":                   true,
+	"strict-origin-when-cross-origin": true,
+	"unsafe-url":                      true,
+}
+
+// Check the security headers of a response
+func auditSecurity(resp *http.Response) *SecurityAudit {
+	header := resp.Header
+	audit := &SecurityAudit{}
+
+	// HSTS only counts when delivered over HTTPS with a positive max-age
+	hsts := AuditCheck{Name: "strict-transport-security"}
+	if value := header.Get("Strict-Transport-Security"); value == "" {
+		hsts.Detail = "missing"
+	} else if resp.Request == nil || resp.Request.URL.Scheme != "https" {
+		hsts.Detail = "ignored over plain HTTP"
+	} else if maxAge, ok := hstsMaxAge(value); !ok || maxAge <= 0 {
+		hsts.Detail = "max-age missing or zero"
+	} else {
+		hsts.Passed = true
+	}
+
+	csp := AuditCheck{Name: "content-security-policy"}
+	if strings.TrimSpace(header.Get("Content-Security-Policy")) == "" {
+		csp.Detail = "missing"
+	} else {
+		csp.Passed = true
+	}
+
+	xcto := AuditCheck{Name: "x-content-type-options"}
+	if value := strings.TrimSpace(header.Get("X-Content-Type-Options")); strings.EqualFold(value, "nosniff") {
+		xcto.Passed = true
+	} else if value == "" {
+		xcto.Detail = "missing"
+	} else {
+		xcto.Detail = fmt.Sprintf("invalid value %q", value)
+	}
+
+	// CSP frame-ancestors supersedes X-Frame-Options
+	xfo := AuditCheck{Name: "x-frame-options"}
+	value := strings.ToUpper(strings.TrimSpace(header.Get("X-Frame-Options")))
+	switch {
+	case value == "DENY" || value == "SAMEORIGIN":
+		xfo.Passed = true
+	case strings.Contains(header.Get("Content-Security-Policy"), "frame-ancestors"):
+		xfo.Passed = true
+		xfo.Detail = "covered by CSP frame-ancestors"
+	case value == "":
+		xfo.Detail = "missing"
+	default:
+		xfo.Detail = fmt.Sprintf("invalid value %q", value)
+	}
+
+	// The last recognized token in a comma separated list applies
+	referrer := AuditCheck{Name: "referrer-policy", Detail: "missing"}
+	if value := header.Get("Referrer-Policy"); value != "" {
+		referrer.Detail = fmt.Sprintf("invalid value %q", value)
+		for _, token := range strings.Split(value, ",") {
+			if validReferrerPolicies[strings.ToLower(strings.TrimSpace(token))] {
+				referrer.Passed = true
+				referrer.Detail = ""
+			}
+		}
+	}
+
+	audit.Checks = []AuditCheck{hsts, csp, xcto, xfo, referrer}
+	passed := 0
+	for _, check := range audit.Checks {
+		if check.Passed {
+			passed++
+		}
+	}
+	audit.Score = passed * 100 / len(audit.Checks)
+	return audit
+}
+
+// Extract max-age from a Strict-Transport-Security header
+func hstsMaxAge(value string) (int64, bool) {
+	for _, directive := range strings.Split(value, ";") {
+		name, arg, ok := strings.Cut(strings.TrimSpace(directive), "=")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "max-age") {
+			maxAge, err := strconv.ParseInt(strings.Trim(strings.TrimSpace(arg), `"`), 10, 64)
+			return maxAge, err == nil
+		}
+	}
+	return 0, false
+}
+
+// SecurityAuditSummary aggregates security audits across a crawl
+type SecurityAuditSummary struct {
+	PagesAudited   int            `json:"pages_audited"`
+	AverageScore   float64        `json:"average_score"`
+	FullyCompliant int            `json:"fully_compliant"`
+	ChecksPassed   map[string]int `json:"checks_passed"`
+}
+
+// Summarize the security audits of all results
+func summarizeSecurityAudits(results []Result) *SecurityAuditSummary {
+	summary := &SecurityAuditSummary{ChecksPassed: make(map[string]int)}
+	for _, name := range securityCheckNames {
+		summary.ChecksPassed[name] = 0
+	}
+
+	totalScore := 0
+	for _, result := range results {
+		if result.Security == nil {
+			continue
+		}
+		summary.PagesAudited++
+		totalScore += result.Security.Score
+		if result.Security.Score == 100 {
+			summary.FullyCompliant++
+		}
+		for _, check := range result.Security.Checks {
+			if check.Passed {
+				summary.ChecksPassed[check.Name]++
+			}
+		}
+	}
+
+	if summary.PagesAudited > 0 {
+		summary.AverageScore = float64(totalScore) / float64(summary.PagesAudited)
+	}
+	return summary
+}
+
+var (
+	imgTagRegex     = regexp.MustCompile(`(?is)<img\b[^>]*>`)
+	altAttrRegex    = regexp.MustCompile(`(?is)\balt\s*=`)
+	htmlTagRegex    = regexp.MustCompile(`(?is)<html\b[^>]*>`)
+	langAttrRegex   = regexp.MustCompile(`(?is)\blang\s*=\s*(?:"[^"\s]+"|'[^'\s]+'|[^\s>"']+)`)
+	anchorRegex     = regexp.MustCompile(`(?is)<a\b([^>]*)>(.*?)</a>`)
+	labelAttrRegex  = regexp.MustCompile(`(?is)\b(?:aria-label|aria-labelledby|title)\s*=\s*["']?[^\s"'>]`)
+	imgWithAltRegex = regexp.MustCompile(`(?is)<img\b[^>]*\balt\s*=\s*["']?[^\s"'>]`)
+)
+
+// AccessibilityAudit counts common accessibility problems on a page
+type AccessibilityAudit struct {
+	ImagesMissingAlt int  `json:"images_missing_alt"`
+	MissingLang      bool `json:"missing_lang"`
+	EmptyLinks       int  `json:"empty_links"`
+}
+
+// Issues returns the total number of problems found
+func (a *AccessibilityAudit) Issues() int {
+	issues := a.ImagesMissingAlt + a.EmptyLinks
+	if a.MissingLang {
+		issues++
+	}
+	return issues
+}
+
+// Check an HTML page for images without alt text, a missing lang attribute
+// and links without an accessible name
+func auditAccessibility(body string) *AccessibilityAudit {
+	audit := &AccessibilityAudit{}
+
+	for _, img := range imgTagRegex.FindAllString(body, -1) {
+		if !altAttrRegex.MatchString(img) {
+			audit.ImagesMissingAlt++
+		}
+	}
+
+	htmlTag := htmlTagRegex.FindString(body)
+	audit.MissingLang = htmlTag == "" || !langAttrRegex.MatchString(htmlTag)
+
+	for _, match := range anchorRegex.FindAllStringSubmatch(body, -1) {
+		attributes, content := match[1], match[2]
+		if labelAttrRegex.MatchString(attributes) || imgWithAltRegex.MatchString(content) {
+			continue
+		}
+		if strings.TrimSpace(tagRegex.ReplaceAllString(content, "")) == "" {
+			audit.EmptyLinks++
+		}
+	}
+
+	return audit
+}
+
+// AccessibilitySummary aggregates accessibility audits across a crawl
+type AccessibilitySummary struct {
+	PagesAudited     int `json:"pages_audited"`
+	PagesWithIssues  int `json:"pages_with_issues"`
+	ImagesMissingAlt int `json:"images_missing_alt"`
+	PagesMissingLang int `json:"pages_missing_lang"`
+	EmptyLinks       int `json:"empty_links"`
+}
+
+// Summarize the accessibility audits of all results
+func summarizeAccessibilityAudits(results []Result) *AccessibilitySummary {
+	summary := &AccessibilitySummary{}
+	for _, result := range results {
+		audit := result.Accessibility
+		if audit == nil {
+			continue
+		}
+		summary.PagesAudited++
+		if audit.Issues() > 0 {
+			summary.PagesWithIssues++
+		}
+		summary.ImagesMissingAlt += audit.ImagesMissingAlt
+		summary.EmptyLinks += audit.EmptyLinks
+		if audit.MissingLang {
+			summary.PagesMissingLang++
+		}
+	}
+	return summary
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Spacing of requests to a host when it is first throttled
+const backoffInitial = time.Second
+
+// Throttling events kept for the results file
+const maxThrottleEvents = 1000
+
+// hostBackoff slows requests to hosts that answer with bursts of 5xx. After
+// threshold 5xx responses in a row a host gets one request per interval.
+// Each request is a probe: another 5xx doubles the interval up to max, a
+// success halves it, and once it drops below backoffInitial the host is
+// back to full speed.
+type hostBackoff struct {
+	mu        sync.Mutex
+	threshold int
+	max       time.Duration
+	hosts     map[string]*hostBackoffState
+	throttled int
+	events    []ThrottleEvent
+	dropped   int
+}
+
+// hostBackoffState is the 5xx streak and request spacing of one host
+type hostBackoffState struct {
+	consecutive int
+	interval    time.Duration // 0 when the host is not throttled
+	next        time.Time     // earliest start of the next request while throttled
+	changed     time.Time     // responses to requests started before this are stale
+	throttled   bool          // the host was throttled at some point
+}
+
+// ThrottleEvent is a change in the request spacing of a host
+type ThrottleEvent struct {
+	Time       time.Time `json:"time"`
+	Host       string    `json:"host"`
+	Event      string    `json:"event"` // throttled, slowed, eased or recovered
+	Status     int       `json:"status,omitempty"`
+	IntervalMS int64     `json:"interval_ms,omitempty"` // spacing of requests from now on
+}
+
+func newHostBackoff(threshold int, max time.Duration) *hostBackoff {
+	if max < backoffInitial {
+		max = backoffInitial
+	}
+	return &hostBackoff{threshold: threshold, max: max, hosts: make(map[string]*hostBackoffState)}
+}
+
+// Take the host's next request slot. Returns 0 when the request may start
+// now, otherwise how long until the host's next slot.
+func (b *hostBackoff) acquire(host string, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := b.hosts[host]
+	if state == nil || state.interval == 0 {
+		return 0
+	}
+	if now.Before(state.next) {
+		return state.next.Sub(now)
+	}
+	state.next = now.Add(state.interval)
+	return 0
+}
+
+// Adjust a host's spacing for the response to a request started at started.
+// Request errors say nothing about the server and are ignored.
+func (b *hostBackoff) observe(host string, status int, started, now time.Time) {
+	if status <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := b.hosts[host]
+	if state == nil {
+		state = &hostBackoffState{}
+		b.hosts[host] = state
+	}
+	if started.Before(state.changed) {
+		return
+	}
+
+	if status >= 500 {
+		state.consecutive++
+		switch {
+		case state.interval == 0 && state.consecutive >= b.threshold:
+			state.interval = backoffInitial
+			if !state.throttled {
+				state.throttled = true
+				b.throttled++
+			}
+			b.event(now, host, "throttled", status, state)
+		case state.interval > 0:
+			state.interval = min(2*state.interval, b.max)
+			b.event(now, host, "slowed", status, state)
+		}
+		return
+	}
+
+	state.consecutive = 0
+	if state.interval == 0 {
+		return
+	}
+	state.interval /= 2
+	if state.interval < backoffInitial {
+		state.interval = 0
+		b.event(now, host, "recovered", status, state)
+		return
+	}
+	b.event(now, host, "eased", status, state)
+}
+
+// Record a spacing change and restart the host's spacing from it
+func (b *hostBackoff) event(now time.Time, host, name string, status int, state *hostBackoffState) {
+	state.changed = now
+	state.next = now.Add(state.interval)
+	if len(b.events) == maxThrottleEvents {
+		b.dropped++
+		return
+	}
+	b.events = append(b.events, ThrottleEvent{
+		Time:       now.UTC(),
+		Host:       host,
+		Event:      name,
+		Status:     status,
+		IntervalMS: state.interval.Milliseconds(),
+	})
+}
+
+// HostBackoffStats lists the hosts slowed down for 5xx bursts and every
+// change in their request spacing
+type HostBackoffStats struct {
+	HostsThrottled int             `json:"hosts_throttled"`
+	StillThrottled []string        `json:"still_throttled,omitempty"`
+	Events         []ThrottleEvent `json:"events"`
+	EventsDropped  int             `json:"events_dropped,omitempty"`
+}
+
+// Stats returns the throttling events, nil when no host was throttled
+func (b *hostBackoff) Stats() *HostBackoffStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.throttled == 0 {
+		return nil
+	}
+	stats := &HostBackoffStats{HostsThrottled: b.throttled, Events: b.events, EventsDropped: b.dropped}
+	for host, state := range b.hosts {
+		if state.interval > 0 {
+			stats.StillThrottled = append(stats.StillThrottled, host)
+		}
+	}
+	sort.Strings(stats.StillThrottled)
+	return stats
+}
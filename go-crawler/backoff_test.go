@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// The spacing starts at backoffInitial after threshold 5xx in a row,
+// doubles up to the maximum, halves on success and ends below
+// backoffInitial
+func TestHostBackoffInterval(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	b := newHostBackoff(3, 5*time.Second)
+	now := start
+	observe := func(status int) time.Duration {
+		now = now.Add(time.Millisecond)
+		b.observe("a.example", status, now, now)
+		return b.hosts["a.example"].interval
+	}
+
+	for _, step := range []struct {
+		status   int
+		interval time.Duration
+	}{
+		{500, 0},
+		{200, 0}, // a success resets the streak
+		{500, 0},
+		{502, 0},
+		{503, time.Second},
+		{500, 2 * time.Second},
+		{500, 4 * time.Second},
+		{500, 5 * time.Second}, // capped at the maximum
+		{500, 5 * time.Second},
+		{-1, 5 * time.Second}, // request errors are ignored
+		{404, 2500 * time.Millisecond},
+		{200, 1250 * time.Millisecond},
+		{200, 0},
+		{500, 0}, // a new streak starts from zero
+	} {
+		if got := observe(step.status); got != step.interval {
+			t.Fatalf("status %d: interval %v, want %v", step.status, got, step.interval)
+		}
+	}
+
+	stats := b.Stats()
+	var events []string
+	for _, event := range stats.Events {
+		events = append(events, event.Event)
+	}
+	want := []string{"throttled", "slowed", "slowed", "slowed", "slowed", "eased", "eased", "recovered"}
+	if len(events) != len(want) {
+		t.Fatalf("got events %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("got events %v, want %v", events, want)
+		}
+	}
+	if stats.HostsThrottled != 1 || len(stats.StillThrottled) != 0 {
+		t.Errorf("got %+v, want one host throttled and none still throttled", stats)
+	}
+}
+
+// A throttled host gets one request per interval, and responses to requests
+// started before the last change don't move the spacing again
+func TestHostBackoffAcquire(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	b := newHostBackoff(1, time.Minute)
+	if delay := b.acquire("a.example", now); delay != 0 {
+		t.Fatalf("unthrottled host waits %v", delay)
+	}
+
+	sent := now
+	b.observe("a.example", 500, sent, now)
+	if delay := b.acquire("a.example", now); delay != time.Second {
+		t.Errorf("first slot in %v, want 1s", delay)
+	}
+	if delay := b.acquire("a.example", now.Add(time.Second)); delay != 0 {
+		t.Errorf("slot not free after the interval, wait %v", delay)
+	}
+	if delay := b.acquire("a.example", now.Add(1500*time.Millisecond)); delay != 500*time.Millisecond {
+		t.Errorf("second slot in %v, want 500ms", delay)
+	}
+	if delay := b.acquire("b.example", now); delay != 0 {
+		t.Errorf("other host waits %v", delay)
+	}
+
+	// Stale responses in flight when the host was throttled
+	b.observe("a.example", 500, sent.Add(-time.Millisecond), now.Add(time.Second))
+	b.observe("a.example", 200, sent.Add(-time.Millisecond), now.Add(time.Second))
+	if interval := b.hosts["a.example"].interval; interval != time.Second {
+		t.Errorf("stale responses moved the interval to %v", interval)
+	}
+}
+
+// A maximum below backoffInitial still lets a host be throttled
+func TestHostBackoffMaximum(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	b := newHostBackoff(1, 100*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Millisecond)
+		b.observe("a.example", 500, now, now)
+	}
+	if interval := b.hosts["a.example"].interval; interval != backoffInitial {
+		t.Errorf("interval %v, want %v", interval, backoffInitial)
+	}
+	if stats := b.Stats(); len(stats.StillThrottled) != 1 {
+		t.Errorf("got %+v, want a.example still throttled", stats)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// Rough per-entry cost of a URL in a map[string]struct{}: the string header,
+// bucket slot and hash overhead on top of the URL bytes themselves
+const exactSetEntryOverhead = 48
+
+// VisitedSetStats describes the visited-URL structure of a recursive crawl
+type VisitedSetStats struct {
+	Kind                       string  `json:"kind"`
+	URLs                       int     `json:"urls"`
+	MemoryBytes                int64   `json:"memory_bytes"`
+	EstimatedExactSetBytes     int64   `json:"estimated_exact_set_bytes"`
+	EstimatedMemorySavedBytes  int64   `json:"estimated_memory_saved_bytes"`
+	FalsePositiveRate          float64 `json:"false_positive_rate,omitempty"`
+	EstimatedFalsePositiveRate float64 `json:"estimated_false_positive_rate,omitempty"`
+}
+
+// visitedSet records which URLs a frontier has already seen
+type visitedSet interface {
+	// Add inserts key and reports whether it was not already present
+	Add(key string) (bool, error)
+	Stats() VisitedSetStats
+}
+
+// mapSet is an exact in-memory visited set
+type mapSet struct {
+	keys     map[string]struct{}
+	keyBytes int64
+}
+
+func newMapSet() *mapSet {
+	return &mapSet{keys: make(map[string]struct{})}
+}
+
+func (s *mapSet) Add(key string) (bool, error) {
+	if _, ok := s.keys[key]; ok {
+		return false, nil
+	}
+	s.keys[key] = struct{}{}
+	s.keyBytes += int64(len(key))
+	return true, nil
+}
+
+func (s *mapSet) Stats() VisitedSetStats {
+	size := s.keyBytes + int64(len(s.keys))*exactSetEntryOverhead
+	return VisitedSetStats{
+		Kind:                   "map",
+		URLs:                   len(s.keys),
+		MemoryBytes:            size,
+		EstimatedExactSetBytes: size,
+	}
+}
+
+// bloomFilter is a probabilistic visited set. It never reports a new URL as
+// seen twice, but may skip a small fraction of unseen URLs as false positives.
+type bloomFilter struct {
+	bits      []uint64
+	numBits   uint64
+	numHashes uint64
+	fpRate    float64
+	count     int
+	keyBytes  int64
+}
+
+// Size a bloom filter for the expected number of URLs at the target false
+// positive rate
+func newBloomFilter(capacity int, fpRate float64) *bloomFilter {
+	if capacity < 1 {
+		capacity = 1
+	}
+	n := float64(capacity)
+	m := math.Ceil(-n * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	k := math.Max(1, math.Round(m/n*math.Ln2))
+
+	numBits := uint64(m)
+	return &bloomFilter{
+		bits:      make([]uint64, (numBits+63)/64),
+		numBits:   numBits,
+		numHashes: uint64(k),
+		fpRate:    fpRate,
+	}
+}
+
+func (b *bloomFilter) Add(key string) (bool, error) {
+	// Derive k bit positions from two halves of a 64-bit hash
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32|1
+
+	present := true
+	for i := uint64(0); i < b.numHashes; i++ {
+		bit := (h1 + i*h2) % b.numBits
+		word, mask := bit/64, uint64(1)<<(bit%64)
+		if b.bits[word]&mask == 0 {
+			present = false
+			b.bits[word] |= mask
+		}
+	}
+
+	if present {
+		return false, nil
+	}
+	b.count++
+	b.keyBytes += int64(len(key))
+	return true, nil
+}
+
+func (b *bloomFilter) Stats() VisitedSetStats {
+	size := int64(len(b.bits) * 8)
+	exact := b.keyBytes + int64(b.count)*exactSetEntryOverhead
+	return VisitedSetStats{
+		Kind:                       "bloom",
+		URLs:                       b.count,
+		MemoryBytes:                size,
+		EstimatedExactSetBytes:     exact,
+		EstimatedMemorySavedBytes:  exact - size,
+		FalsePositiveRate:          b.fpRate,
+		EstimatedFalsePositiveRate: b.estimatedFPRate(),
+	}
+}
+
+// False positive rate implied by the number of URLs actually inserted
+func (b *bloomFilter) estimatedFPRate() float64 {
+	k, m, n := float64(b.numHashes), float64(b.numBits), float64(b.count)
+	return math.Pow(1-math.Exp(-k*n/m), k)
+}
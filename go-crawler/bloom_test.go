@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// A URL added once is reported as seen every time after, and the filter
+// counts URLs rather than calls
+func TestBloomFilterRepeatedURLs(t *testing.T) {
+	b := newBloomFilter(1000, 0.01)
+	for i := 0; i < 100; i++ {
+		url := fmt.Sprintf("https://a.example/page/%d", i)
+		if added, err := b.Add(url); !added || err != nil {
+			t.Fatalf("%s: added %v, %v the first time", url, added, err)
+		}
+		for repeat := 0; repeat < 3; repeat++ {
+			if added, err := b.Add(url); added || err != nil {
+				t.Fatalf("%s: added %v, %v again", url, added, err)
+			}
+		}
+	}
+	if stats := b.Stats(); stats.URLs != 100 || stats.Kind != "bloom" || stats.FalsePositiveRate != 0.01 {
+		t.Errorf("stats %+v, want 100 URLs", stats)
+	}
+}
+
+// Filled to its capacity, the filter wrongly reports unseen URLs as seen at
+// about the configured rate, and at less while it has room to spare
+func TestBloomFilterFalsePositiveRate(t *testing.T) {
+	const capacity, probes = 10000, 20000
+	for _, fpRate := range []float64{0.01, 0.001} {
+		b := newBloomFilter(capacity, fpRate)
+		// Probe a copy, so that probing doesn't fill the filter further
+		measure := func() float64 {
+			seen := 0
+			for i := 0; i < probes; i++ {
+				probe := *b
+				probe.bits = slices.Clone(b.bits)
+				if added, _ := probe.Add(fmt.Sprintf("https://b.example/unseen?id=%d", i)); !added {
+					seen++
+				}
+			}
+			return float64(seen) / probes
+		}
+
+		for i := 0; i < capacity/2; i++ {
+			b.Add(fmt.Sprintf("https://a.example/page/%d", i))
+		}
+		if measured := measure(); measured > fpRate/4 {
+			t.Errorf("rate %v: %.5f of unseen URLs seen at half capacity", fpRate, measured)
+		}
+		for i := capacity / 2; i < capacity; i++ {
+			b.Add(fmt.Sprintf("https://a.example/page/%d", i))
+		}
+		// Within the sampling error of the probes
+		if measured := measure(); measured > 1.5*fpRate {
+			t.Errorf("rate %v: %.5f of unseen URLs seen at capacity", fpRate, measured)
+		}
+		if estimated := b.Stats().EstimatedFalsePositiveRate; estimated > 1.1*fpRate {
+			t.Errorf("rate %v: estimated %.5f at capacity", fpRate, estimated)
+		}
+	}
+}
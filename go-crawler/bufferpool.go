@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// Buffers that grew beyond this are dropped rather than pooled, so one huge
+// page doesn't pin its memory for the rest of the crawl
+const maxPooledBuffer = 1 << 20
+
+// Reusable buffers for reading response bodies
+var bodyBuffers = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// Read a body into a pooled buffer. The returned bytes are only valid until
+// release is called.
+func readPooled(r io.Reader) ([]byte, func(), error) {
+	buffer := bodyBuffers.Get().(*bytes.Buffer)
+	buffer.Reset()
+	release := func() {
+		if buffer.Cap() <= maxPooledBuffer {
+			bodyBuffers.Put(buffer)
+		}
+	}
+	if _, err := buffer.ReadFrom(r); err != nil {
+		release()
+		return nil, func() {}, err
+	}
+	return buffer.Bytes(), release, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// A 100 KB HTML page
+var benchmarkBody = []byte("<html><head><title>Benchmark</title></head><body>" +
+	strings.Repeat("<p>Lorem ipsum dolor sit amet, consectetur adipiscing elit.</p>\n", 1600) +
+	"</body></html>")
+
+func BenchmarkReadBodyReadAll(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkBody)))
+	for i := 0; i < b.N; i++ {
+		body, err := io.ReadAll(bytes.NewReader(benchmarkBody))
+		if err != nil || len(body) != len(benchmarkBody) {
+			b.Fatal("short read")
+		}
+	}
+}
+
+func BenchmarkReadBodyPooled(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkBody)))
+	for i := 0; i < b.N; i++ {
+		body, release, err := readPooled(bytes.NewReader(benchmarkBody))
+		if err != nil || len(body) != len(benchmarkBody) {
+			b.Fatal("short read")
+		}
+		release()
+	}
+}
+
+func TestReadPooledReusesBuffers(t *testing.T) {
+	first, release, err := readPooled(strings.NewReader("first body"))
+	if err != nil || string(first) != "first body" {
+		t.Fatalf("got %q, %v", first, err)
+	}
+	release()
+
+	second, release, err := readPooled(strings.NewReader("second"))
+	if err != nil || string(second) != "second" {
+		t.Fatalf("got %q, %v", second, err)
+	}
+	release()
+}
+
+func TestReadPooledDropsLargeBuffers(t *testing.T) {
+	large := strings.Repeat("x", maxPooledBuffer+1)
+	body, release, err := readPooled(strings.NewReader(large))
+	if err != nil || len(body) != len(large) {
+		t.Fatalf("got %d bytes, %v", len(body), err)
+	}
+	release()
+
+	buffer := bodyBuffers.Get().(*bytes.Buffer)
+	if buffer.Cap() > maxPooledBuffer {
+		t.Errorf("pooled buffer has capacity %d, want at most %d", buffer.Cap(), maxPooledBuffer)
+	}
+}
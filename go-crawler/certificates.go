@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/tls"
+	"sort"
+	"time"
+)
+
+// CertificateInfo describes the leaf certificate an HTTPS server presented
+type CertificateInfo struct {
+	Subject         string    `json:"subject"`
+	Issuer          string    `json:"issuer"`
+	NotAfter        time.Time `json:"not_after"`
+	DaysUntilExpiry int       `json:"days_until_expiry"`
+	ExpiringSoon    bool      `json:"expiring_soon,omitempty"`
+}
+
+// Describe the server's leaf certificate, flagging it when it expires within
+// warnDays days
+func certificateInfo(state *tls.ConnectionState, warnDays int) *CertificateInfo {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+
+	leaf := state.PeerCertificates[0]
+	days := int(time.Until(leaf.NotAfter).Hours() / 24)
+	return &CertificateInfo{
+		Subject:         leaf.Subject.CommonName,
+		Issuer:          leaf.Issuer.String(),
+		NotAfter:        leaf.NotAfter.UTC(),
+		DaysUntilExpiry: days,
+		ExpiringSoon:    days < warnDays,
+	}
+}
+
+// ExpiringCertificate is a host whose certificate expires soon
+type ExpiringCertificate struct {
+	Domain          string    `json:"domain"`
+	NotAfter        time.Time `json:"not_after"`
+	DaysUntilExpiry int       `json:"days_until_expiry"`
+}
+
+// List the hosts with soon-to-expire certificates, soonest first
+func findExpiringCertificates(results []Result) []ExpiringCertificate {
+	byDomain := make(map[string]ExpiringCertificate)
+	for _, result := range results {
+		if result.Certificate == nil || !result.Certificate.ExpiringSoon {
+			continue
+		}
+		byDomain[result.Domain] = ExpiringCertificate{
+			Domain:          result.Domain,
+			NotAfter:        result.Certificate.NotAfter,
+			DaysUntilExpiry: result.Certificate.DaysUntilExpiry,
+		}
+	}
+
+	expiring := make([]ExpiringCertificate, 0, len(byDomain))
+	for _, cert := range byDomain {
+		expiring = append(expiring, cert)
+	}
+	sort.Slice(expiring, func(i, j int) bool {
+		if expiring[i].DaysUntilExpiry != expiring[j].DaysUntilExpiry {
+			return expiring[i].DaysUntilExpiry < expiring[j].DaysUntilExpiry
+		}
+		return expiring[i].Domain < expiring[j].Domain
+	})
+	return expiring
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// circuitBreaker stops fetching from a host after consecutive failures. The
+// circuit stays open for a cooldown; after it, one more failure reopens it.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	hosts     map[string]*hostCircuit
+	skipped   int
+}
+
+// hostCircuit is the breaker state for one host
+type hostCircuit struct {
+	consecutive int // failures since the last success
+	openUntil   time.Time
+	opened      int // times the circuit has opened
+	skipped     int // URLs skipped while open
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, hosts: make(map[string]*hostCircuit)}
+}
+
+// Return a skip reason if the circuit for host is open at now, or "" to
+// fetch
+func (b *circuitBreaker) check(host string, now time.Time) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	circuit := b.hosts[host]
+	if circuit == nil || !now.Before(circuit.openUntil) {
+		return ""
+	}
+	b.skipped++
+	circuit.skipped++
+	return fmt.Sprintf("circuit open for host after %d consecutive failures", circuit.consecutive)
+}
+
+// Track a fetched result and open the host's circuit once it has failed
+// threshold times in a row, counting the cooldown from now
+func (b *circuitBreaker) record(result Result, now time.Time) {
+	if result.SkipReason != "" {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	circuit := b.hosts[result.Domain]
+	if circuit == nil {
+		circuit = &hostCircuit{}
+		b.hosts[result.Domain] = circuit
+	}
+	if resultSucceeded(result) {
+		circuit.consecutive = 0
+		return
+	}
+
+	circuit.consecutive++
+	// A failure while half-open (after a cooldown) reopens straight away
+	if circuit.consecutive >= b.threshold && now.After(circuit.openUntil) {
+		circuit.openUntil = now.Add(b.cooldown)
+		circuit.opened++
+	}
+}
+
+// CircuitBreakerStats counts circuits opened and URLs skipped because of them
+type CircuitBreakerStats struct {
+	Opened  int `json:"opened"`
+	Skipped int `json:"skipped"`
+}
+
+// Stats returns the breaker counters
+func (b *circuitBreaker) Stats() CircuitBreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := CircuitBreakerStats{Skipped: b.skipped}
+	for _, circuit := range b.hosts {
+		stats.Opened += circuit.opened
+	}
+	return stats
+}
+
+// Copy the state of every host whose circuit has opened
+func (b *circuitBreaker) openedHosts() map[string]hostCircuit {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	hosts := make(map[string]hostCircuit)
+	for host, circuit := range b.hosts {
+		if circuit.opened > 0 {
+			hosts[host] = *circuit
+		}
+	}
+	return hosts
+}
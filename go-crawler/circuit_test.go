@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// The circuit opens after threshold failures in a row, stays open for the
+// cooldown, then lets one request through: a failure reopens it, a success
+// closes it
+func TestCircuitBreakerTransitions(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	b := newCircuitBreaker(3, time.Minute)
+	failed := Result{URL: "https://a.example/", Domain: "a.example", Status: http.StatusBadGateway}
+	succeeded := Result{URL: "https://a.example/", Domain: "a.example", Status: http.StatusOK}
+	open := func(at time.Time) bool { return b.check("a.example", at) != "" }
+
+	b.record(failed, now)
+	b.record(failed, now)
+	b.record(succeeded, now)
+	b.record(failed, now)
+	b.record(failed, now)
+	if open(now) {
+		t.Fatal("open after a success broke the streak")
+	}
+	b.record(failed, now)
+	if !open(now) || !open(now.Add(59*time.Second)) {
+		t.Fatal("closed within the cooldown after 3 failures in a row")
+	}
+	if open(now.Add(time.Minute)) {
+		t.Fatal("still open once the cooldown passed")
+	}
+	if b.check("b.example", now) != "" {
+		t.Error("other host's circuit open")
+	}
+
+	// Half-open: a single failure reopens for another cooldown
+	halfOpen := now.Add(time.Minute + time.Second)
+	b.record(failed, halfOpen)
+	if !open(halfOpen) || open(halfOpen.Add(time.Minute)) {
+		t.Fatal("a failure while half-open didn't reopen for one cooldown")
+	}
+
+	// Half-open again: a success closes, and the next failure alone doesn't
+	// reopen
+	closed := halfOpen.Add(2 * time.Minute)
+	b.record(succeeded, closed)
+	b.record(failed, closed)
+	if open(closed) {
+		t.Fatal("open after one failure following a success")
+	}
+
+	// Failures recorded while open, from requests already in flight, don't
+	// push the cooldown back
+	b.record(failed, closed)
+	b.record(failed, closed)
+	b.record(failed, closed.Add(30*time.Second))
+	if !open(closed.Add(59*time.Second)) || open(closed.Add(time.Minute)) {
+		t.Fatal("cooldown moved by failures while open")
+	}
+
+	// Skipped results say nothing about the host
+	b.record(Result{URL: "https://b.example/", Domain: "b.example", SkipReason: "disallowed by robots.txt"}, now)
+	if _, ok := b.hosts["b.example"]; ok {
+		t.Error("skipped result recorded")
+	}
+
+	stats := b.Stats()
+	if stats.Opened != 3 {
+		t.Errorf("opened %d times, want 3", stats.Opened)
+	}
+	if stats.Skipped == 0 || b.openedHosts()["a.example"].skipped != stats.Skipped {
+		t.Errorf("got %+v, with a.example skipped %d times", stats, b.openedHosts()["a.example"].skipped)
+	}
+}
@@ -0,0 +1,1091 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Address the coordinator listens on unless -addr is given
+const defaultCoordinatorAddr = "localhost:8081"
+
+// Environment variable holding the shared token of a cluster
+const clusterTokenEnv = envPrefix + "CLUSTER_TOKEN"
+
+// How a worker talks to the coordinator
+const (
+	clusterFlushEvery   = time.Second      // results are sent at least this often
+	clusterFlushResults = 100              // or as soon as this many are waiting
+	clusterRetries      = 5                // attempts at a request before giving up on the coordinator
+	clusterWait         = 2 * time.Second  // how long a worker waits when there is nothing to hand out
+	clusterLinger       = 10 * time.Second // how long a finished coordinator waits for workers to hear so
+	clusterHeartbeat    = 5 * time.Second  // how often a worker tells the coordinator it is alive
+)
+
+// States of a registered worker
+const (
+	workerActive = "active"
+	workerLost   = "lost" // missed its heartbeats; its URLs went back in the queue
+	workerLeft   = "left" // said goodbye when its crawl ended
+)
+
+// ClusterRegistration is the body a worker registers with
+type ClusterRegistration struct {
+	Worker  string `json:"worker"`
+	Workers int    `json:"workers"` // concurrent fetches the worker runs
+}
+
+// ClusterBatch is a batch of URLs handed to a worker. Done tells the worker
+// the crawl is over; no URLs and not done means there is nothing to hand out
+// yet.
+type ClusterBatch struct {
+	ID   int      `json:"id,omitempty"`
+	URLs []string `json:"urls,omitempty"`
+	Done bool     `json:"done,omitempty"`
+}
+
+// ClusterJoin is the coordinator's answer to a registration. FollowLinks
+// asks the worker to send the links of each page back with its result.
+type ClusterJoin struct {
+	ClusterWorker
+	FollowLinks bool `json:"follow_links,omitempty"`
+}
+
+// ClusterResults is a group of results a worker sends back, with the links
+// found on each page when the coordinator follows links
+type ClusterResults struct {
+	Results []Result            `json:"results"`
+	Links   map[string][]string `json:"links,omitempty"`
+}
+
+// ClusterWorker is a registered worker as the status endpoint lists it
+type ClusterWorker struct {
+	Name         string    `json:"name"`
+	State        string    `json:"state"`
+	Workers      int       `json:"workers"`
+	Batches      int       `json:"batches"`  // batches handed to the worker
+	Results      int       `json:"results"`  // results received from it
+	Requeued     int       `json:"requeued"` // URLs taken back when it was lost or left
+	RegisteredAt time.Time `json:"registered_at"`
+	LastSeen     time.Time `json:"last_seen"`
+}
+
+// ClusterStatus is the coordinator's progress
+type ClusterStatus struct {
+	Pending  int             `json:"pending"`   // URLs not handed out yet
+	InFlight int             `json:"in_flight"` // URLs handed out without a result yet
+	Done     int             `json:"done"`      // URLs with a result
+	Workers  []ClusterWorker `json:"workers"`
+}
+
+// clusterBatch is a batch handed out, with the URLs it still lacks results for
+type clusterBatch struct {
+	id     int
+	worker string
+	open   map[string]bool
+}
+
+// hostQueue holds the URLs of one host not handed out yet
+type hostQueue struct {
+	host string
+	urls []string
+}
+
+// Host a URL is crawled politely as: its host and port, in lower case
+func clusterHost(urlStr string) string {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsedURL.Host)
+}
+
+// coordinator owns the frontier of a cluster crawl: it hands URL batches to
+// registered workers and collects their results. Each host belongs to one
+// worker, chosen by consistent hashing, so per-host rate limits, robots.txt
+// and cookies stay on one machine.
+type coordinator struct {
+	batchSize int
+	entries   map[string]*urlEntry // input data reattached to results
+
+	mu       sync.Mutex
+	queues   []*hostQueue // hosts with URLs left, in the order first seen
+	byHost   map[string]*hostQueue
+	pending  int            // URLs not handed out yet
+	visited  visitedSet     // every URL queued so far, when following links
+	depths   map[string]int // link depth of discovered URLs until their result arrives
+	maxDepth int
+	maxPages int // cap on URLs queued, seeds included; 0 means no limit
+	queued   int
+	ring     *hashRing
+	holders  map[string]string        // host to the worker holding URLs of it in flight
+	inFlight map[string]int           // URLs in flight per host
+	assigned map[string]*clusterBatch // URL to the batch it is in flight in
+	workers  map[string]*ClusterWorker
+	order    []string // worker names in the order they registered
+	told     map[string]bool
+	results  []Result
+	seq      int
+	finished chan struct{} // closed once every URL has a result
+	allTold  chan struct{} // closed once every worker has heard the crawl is over
+}
+
+func newCoordinator(urls []string, entries map[string]*urlEntry, batchSize int) *coordinator {
+	c := &coordinator{
+		batchSize: batchSize,
+		entries:   entries,
+		pending:   len(urls),
+		ring:      newHashRing(),
+		holders:   make(map[string]string),
+		inFlight:  make(map[string]int),
+		assigned:  make(map[string]*clusterBatch),
+		workers:   make(map[string]*ClusterWorker),
+		told:      make(map[string]bool),
+		finished:  make(chan struct{}),
+		allTold:   make(chan struct{}),
+	}
+	c.byHost = make(map[string]*hostQueue)
+	for _, urlStr := range urls {
+		host := clusterHost(urlStr)
+		queue := c.byHost[host]
+		if queue == nil {
+			queue = &hostQueue{host: host}
+			c.byHost[host] = queue
+			c.queues = append(c.queues, queue)
+		}
+		queue.urls = append(queue.urls, urlStr)
+	}
+	c.checkFinished()
+	return c
+}
+
+// Close finished once nothing is pending or in flight. Called with the lock
+// held.
+func (c *coordinator) checkFinished() {
+	if c.pending == 0 && len(c.assigned) == 0 {
+		select {
+		case <-c.finished:
+		default:
+			close(c.finished)
+		}
+	}
+}
+
+// Follow links on the seed hosts up to maxDepth. The visited set holds every
+// URL queued, so a link found by several workers is only crawled once.
+// Called before the API is served.
+func (c *coordinator) followLinks(maxDepth, maxPages int, visited visitedSet) {
+	c.maxDepth = maxDepth
+	c.maxPages = maxPages
+	c.visited = visited
+	c.depths = make(map[string]int)
+	for _, queue := range c.queues {
+		for _, urlStr := range queue.urls {
+			visited.Add(urlStr)
+		}
+	}
+	c.queued = c.pending
+}
+
+// Queue a URL of a known host, at the front of its host's queue or the back
+func (c *coordinator) push(urlStr string, front bool) {
+	queue := c.byHost[clusterHost(urlStr)]
+	if len(queue.urls) == 0 {
+		// Only hosts with URLs left are in the list
+		if front {
+			c.queues = append([]*hostQueue{queue}, c.queues...)
+		} else {
+			c.queues = append(c.queues, queue)
+		}
+	}
+	if front {
+		queue.urls = append([]string{urlStr}, queue.urls...)
+	} else {
+		queue.urls = append(queue.urls, urlStr)
+	}
+	c.pending++
+}
+
+// Queue the new links of a page at the next depth, staying on the seed
+// hosts. Called with the lock held.
+func (c *coordinator) discover(depth int, links []string) {
+	if c.visited == nil || depth >= c.maxDepth {
+		return
+	}
+	for _, link := range links {
+		if c.maxPages > 0 && c.queued >= c.maxPages {
+			return
+		}
+		if _, ok := c.byHost[clusterHost(link)]; !ok {
+			continue
+		}
+		if added, err := c.visited.Add(link); err != nil || !added {
+			continue
+		}
+		c.push(link, false)
+		c.depths[link] = depth + 1
+		c.queued++
+	}
+}
+
+// Register a worker under its name
+func (c *coordinator) register(reg ClusterRegistration) (ClusterJoin, int, error) {
+	if !jobNameRegex.MatchString(reg.Worker) {
+		return ClusterJoin{}, http.StatusBadRequest, fmt.Errorf("invalid worker name %q: use letters, digits, '.', '_' and '-'", reg.Worker)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	worker, ok := c.workers[reg.Worker]
+	switch {
+	case !ok:
+		worker = &ClusterWorker{Name: reg.Worker, RegisteredAt: now}
+		c.workers[reg.Worker] = worker
+		c.order = append(c.order, reg.Worker)
+	case worker.State == workerActive:
+		return ClusterJoin{}, http.StatusConflict, fmt.Errorf("a worker named %s is already registered", reg.Worker)
+	}
+	// A lost worker that comes back starts afresh
+	worker.State = workerActive
+	worker.Workers = reg.Workers
+	worker.LastSeen = now
+	delete(c.told, reg.Worker)
+	c.ring.add(reg.Worker)
+	return ClusterJoin{ClusterWorker: *worker, FollowLinks: c.visited != nil}, http.StatusCreated, nil
+}
+
+// Find an active worker and note that it was seen
+func (c *coordinator) seen(name string) (*ClusterWorker, int, error) {
+	worker, ok := c.workers[name]
+	if !ok {
+		return nil, http.StatusNotFound, fmt.Errorf("no worker named %q is registered", name)
+	}
+	if worker.State != workerActive {
+		return nil, http.StatusGone, fmt.Errorf("worker %s was %s; register again", name, worker.State)
+	}
+	worker.LastSeen = time.Now()
+	return worker, http.StatusOK, nil
+}
+
+// Note a worker's heartbeat
+func (c *coordinator) heartbeat(name string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, status, err := c.seen(name); err != nil {
+		return status, err
+	}
+	return http.StatusNoContent, nil
+}
+
+// Take a worker off the ring and put the URLs it holds back in the queue,
+// at the front of their hosts' queues. Its hosts go to the other workers.
+// Called with the lock held.
+func (c *coordinator) release(worker *ClusterWorker, state string) int {
+	worker.State = state
+	c.ring.remove(worker.Name)
+	requeued := 0
+	for urlStr, batch := range c.assigned {
+		if batch.worker != worker.Name {
+			continue
+		}
+		delete(c.assigned, urlStr)
+		c.push(urlStr, true)
+		host := clusterHost(urlStr)
+		delete(c.inFlight, host)
+		delete(c.holders, host)
+		requeued++
+	}
+	worker.Requeued += requeued
+	c.checkAllTold()
+	return requeued
+}
+
+// A worker leaving once its crawl has ended
+func (c *coordinator) leave(name string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	worker, status, err := c.seen(name)
+	if err != nil {
+		return status, err
+	}
+	if requeued := c.release(worker, workerLeft); requeued > 0 {
+		fmt.Printf("Warning: worker %s left; requeued the %d URLs it held\n", name, requeued)
+	}
+	return http.StatusNoContent, nil
+}
+
+// Mark workers lost once they have missed their heartbeats for timeout, and
+// requeue their URLs, until the crawl is over
+func (c *coordinator) watch(timeout time.Duration) {
+	ticker := time.NewTicker(timeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.finished:
+			return
+		case <-ticker.C:
+		}
+		c.mu.Lock()
+		for _, name := range c.order {
+			worker := c.workers[name]
+			if worker.State == workerActive && time.Since(worker.LastSeen) > timeout {
+				requeued := c.release(worker, workerLost)
+				fmt.Printf("Warning: worker %s missed its heartbeats for %s; requeued the %d URLs it held\n", name, timeout, requeued)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// Close allTold once the crawl is over and every active worker has heard so.
+// Called with the lock held.
+func (c *coordinator) checkAllTold() {
+	select {
+	case <-c.finished:
+	default:
+		return
+	}
+	for name, worker := range c.workers {
+		if worker.State == workerActive && !c.told[name] {
+			return
+		}
+	}
+	select {
+	case <-c.allTold:
+	default:
+		close(c.allTold)
+	}
+}
+
+// Hand a worker its next batch
+func (c *coordinator) next(name string) (ClusterBatch, int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	worker, status, err := c.seen(name)
+	if err != nil {
+		return ClusterBatch{}, status, err
+	}
+	select {
+	case <-c.finished:
+		c.told[name] = true
+		c.checkAllTold()
+		return ClusterBatch{Done: true}, http.StatusOK, nil
+	default:
+	}
+
+	// Take URLs of the worker's hosts in the order they were first seen. A
+	// host that moved to the worker when it joined stays with its previous
+	// worker until that one has sent back the URLs it holds.
+	var urls []string
+	emptied := false
+	for _, queue := range c.queues {
+		if len(urls) == c.batchSize {
+			break
+		}
+		if c.ring.owner(queue.host) != name {
+			continue
+		}
+		if holder, ok := c.holders[queue.host]; ok && holder != name {
+			continue
+		}
+		take := min(c.batchSize-len(urls), len(queue.urls))
+		urls = append(urls, queue.urls[:take]...)
+		queue.urls = queue.urls[take:]
+		c.holders[queue.host] = name
+		c.inFlight[queue.host] += take
+		emptied = emptied || len(queue.urls) == 0
+	}
+	if len(urls) == 0 {
+		return ClusterBatch{}, http.StatusOK, nil
+	}
+	if emptied {
+		queues := c.queues[:0]
+		for _, queue := range c.queues {
+			if len(queue.urls) > 0 {
+				queues = append(queues, queue)
+			}
+		}
+		c.queues = queues
+	}
+	c.pending -= len(urls)
+	c.seq++
+	batch := &clusterBatch{id: c.seq, worker: name, open: make(map[string]bool, len(urls))}
+	for _, urlStr := range urls {
+		batch.open[urlStr] = true
+		c.assigned[urlStr] = batch
+	}
+	worker.Batches++
+	return ClusterBatch{ID: batch.id, URLs: urls}, http.StatusOK, nil
+}
+
+// Take results from a worker. Results for URLs the worker doesn't hold are
+// dropped, so a result can't arrive twice, even from a worker given up for
+// lost whose URLs went to another.
+func (c *coordinator) collect(name string, results []Result, links map[string][]string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	worker, status, err := c.seen(name)
+	if err != nil {
+		return status, err
+	}
+	for _, result := range results {
+		batch, ok := c.assigned[result.URL]
+		if !ok || batch.worker != name {
+			continue
+		}
+		delete(c.assigned, result.URL)
+		delete(batch.open, result.URL)
+		host := clusterHost(result.URL)
+		if c.inFlight[host]--; c.inFlight[host] == 0 {
+			delete(c.inFlight, host)
+			delete(c.holders, host)
+		}
+		if entry, ok := c.entries[result.URL]; ok {
+			result.Metadata = entry.Metadata
+			result.Tags = entry.Tags
+		}
+		if c.visited != nil {
+			result.Depth = c.depths[result.URL]
+			delete(c.depths, result.URL)
+			c.discover(result.Depth, links[result.URL])
+		}
+		c.results = append(c.results, result)
+		worker.Results++
+	}
+	c.checkFinished()
+	return http.StatusNoContent, nil
+}
+
+// The coordinator's progress
+func (c *coordinator) status() ClusterStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := ClusterStatus{Pending: c.pending, InFlight: len(c.assigned), Done: len(c.results), Workers: []ClusterWorker{}}
+	for _, name := range c.order {
+		status.Workers = append(status.Workers, *c.workers[name])
+	}
+	return status
+}
+
+// Results collected so far, the number of URLs queued in all, and whether
+// every URL has a result
+func (c *coordinator) collected() ([]Result, int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	total := len(c.results) + c.pending + len(c.assigned)
+	return append([]Result(nil), c.results...), total, c.pending == 0 && len(c.assigned) == 0
+}
+
+// Routes of the cluster API, behind the shared token when there is one, and
+// the health probes
+func coordinatorHandler(c *coordinator, health *serverHealth, token string) http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("/cluster", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeJSON(w, http.StatusMethodNotAllowed, jobError{"method not allowed"})
+			return
+		}
+		writeJSON(w, http.StatusOK, c.status())
+	})
+	api.HandleFunc("/cluster/workers", func(w http.ResponseWriter, r *http.Request) {
+		serveClusterCall(c, w, r, "register", "", 1<<20)
+	})
+	api.HandleFunc("/cluster/workers/", func(w http.ResponseWriter, r *http.Request) {
+		name, op, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/cluster/workers/"), "/")
+		serveClusterCall(c, w, r, op, name, 256<<20)
+	})
+
+	mux := http.NewServeMux()
+	if token != "" {
+		mux.Handle("/cluster", requireToken(token, api))
+		mux.Handle("/cluster/", requireToken(token, api))
+	} else {
+		mux.Handle("/cluster", api)
+		mux.Handle("/cluster/", api)
+	}
+	health.register(mux)
+	return mux
+}
+
+// Run a worker's call on the coordinator. Returns the HTTP status and the
+// response body, nil when there is none.
+func (c *coordinator) call(op, name string, body []byte) (int, interface{}, error) {
+	switch op {
+	case "register":
+		var reg ClusterRegistration
+		if err := json.Unmarshal(body, &reg); err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		join, status, err := c.register(reg)
+		return status, join, err
+	case "batch":
+		batch, status, err := c.next(name)
+		return status, batch, err
+	case "results":
+		var results ClusterResults
+		if err := json.Unmarshal(body, &results); err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		status, err := c.collect(name, results.Results, results.Links)
+		return status, nil, err
+	case "heartbeat":
+		status, err := c.heartbeat(name)
+		return status, nil, err
+	case "leave":
+		status, err := c.leave(name)
+		return status, nil, err
+	}
+	return http.StatusNotFound, nil, fmt.Errorf("unknown cluster call %q", op)
+}
+
+// Serve a worker's call made over HTTP
+func serveClusterCall(c *coordinator, w http.ResponseWriter, r *http.Request, op, name string, maxBytes int64) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, jobError{"method not allowed"})
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, jobError{err.Error()})
+		return
+	}
+	status, response, err := c.call(op, name, body)
+	switch {
+	case err != nil:
+		writeJSON(w, status, jobError{err.Error()})
+	case response == nil:
+		w.WriteHeader(status)
+	default:
+		if batch, ok := response.(ClusterBatch); ok && len(batch.URLs) == 0 && !batch.Done {
+			w.Header().Set("Retry-After", strconv.Itoa(int(clusterWait.Seconds())))
+		}
+		writeJSON(w, status, response)
+	}
+}
+
+// Wrap a handler so only requests carrying the cluster's token reach it
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(requestAPIKey(r)), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="crawler"`)
+			writeJSON(w, http.StatusUnauthorized, jobError{"invalid cluster token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Run the coordinator subcommand: hand a URL list out to workers in batches
+// and save the results they send back
+func runCoordinator(args []string) int {
+	fs := flag.NewFlagSet("coordinator", flag.ExitOnError)
+	addr := fs.String("addr", defaultCoordinatorAddr, "Address to serve the cluster API on")
+	var inputs stringListFlag
+	fs.Var(&inputs, "input", "URL list file or glob pattern; may be repeated (default ../urls.txt)")
+	output := fs.String("output", "cluster_results.json", "File to write the results of the whole cluster to")
+	batchSize := fs.Int("batch-size", 100, "URLs handed to a worker at a time")
+	token := fs.String("token", os.Getenv(clusterTokenEnv), "Shared token workers must present (default $"+clusterTokenEnv+")")
+	tlsCert := fs.String("tls-cert", "", "Certificate file to serve the API over HTTPS with")
+	tlsKey := fs.String("tls-key", "", "Private key file of -tls-cert")
+	natsURL := fs.String("nats", "", "Also serve the cluster through this NATS server, with JetStream enabled, e.g. nats://host:4222/<cluster>")
+	noAuth := fs.Bool("no-auth", false, "Serve the cluster API without a token on an address other machines can reach")
+	depth := fs.Int("depth", 0, "Follow links on the seed hosts up to this depth, crawling each discovered URL once across the cluster (0 disables recursion)")
+	maxPages := fs.Int("max-pages", 0, "Maximum number of URLs to crawl, seeds included, when following links (0 means no limit)")
+	bloomFPRate := fs.Float64("bloom-fp-rate", 0, "Use a bloom filter visited set with this false positive rate, e.g. 0.001 (0 uses an exact set)")
+	bloomCapacity := fs.Int("bloom-capacity", 1000000, "Expected number of URLs used to size the bloom filter")
+	workerTimeout := fs.Duration("worker-timeout", 30*time.Second, "Requeue the URLs of a worker not heard from for this long")
+	failureThreshold := fs.Float64("failure-threshold", 1, "Exit with status 2 when more than this fraction of fetched URLs fail")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: crawler coordinator [-addr %s] [-input urls.txt]... [-batch-size N] [-token TOKEN] [-nats nats://host:4222/cluster] [-output cluster_results.json]\n", defaultCoordinatorAddr)
+		fmt.Fprintf(fs.Output(), "Workers poll for batches of URLs and post their results back in batches, as JSON over HTTP or NATS.\n")
+		fmt.Fprintf(fs.Output(), "There is no gRPC and no result streaming: the crawler is built from the standard library alone.\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 || *batchSize < 1 || *depth < 0 || *maxPages < 0 || *bloomFPRate < 0 || *bloomFPRate >= 1 {
+		fs.Usage()
+		return exitConfig
+	}
+	if *workerTimeout < 2*clusterHeartbeat {
+		fmt.Printf("Error: -worker-timeout must be at least %s, two worker heartbeats\n", 2*clusterHeartbeat)
+		return exitConfig
+	}
+	if *token == "" && !*noAuth && !isLoopbackAddr(*addr) {
+		// Anyone who can reach the API could feed the cluster false results
+		fmt.Printf("Error: serving the cluster API on %s needs -token or $%s; use -no-auth to serve it unauthenticated\n", *addr, clusterTokenEnv)
+		return exitConfig
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fmt.Printf("Error: -tls-cert and -tls-key go together\n")
+		return exitConfig
+	}
+	var natsSubjects string
+	if *natsURL != "" {
+		cluster, err := parseNATSCluster(*natsURL)
+		if err != nil || !isNATSURL(*natsURL) {
+			fmt.Printf("Error: -nats takes a nats:// or tls:// URL naming the cluster, e.g. nats://localhost:4222/crawler\n")
+			return exitConfig
+		}
+		natsSubjects = cluster.prefix + ".>"
+	}
+
+	if len(inputs) == 0 {
+		inputs = stringListFlag{"../urls.txt"}
+	}
+	files, err := expandInputs(inputs)
+	if err != nil {
+		fmt.Printf("Error loading URLs: %s\n", err)
+		return exitConfig
+	}
+	urls, entries, invalid, err := loadURLsFromFiles(files)
+	if err != nil {
+		fmt.Printf("Error loading URLs: %s\n", err)
+		return exitConfig
+	}
+	for _, entry := range entries {
+		// Workers fetch bare URLs; only data copied to results survives
+		if entry.Method != "" || entry.Headers != nil || entry.Body != "" || entry.ExpectBodyRegex != "" {
+			fmt.Printf("Error: %s: request overrides (method, headers, body, expect_body_regex) are not supported in cluster mode\n", entry.URL)
+			return exitConfig
+		}
+	}
+	if len(invalid) > 0 {
+		fmt.Printf("Skipping %d malformed URLs\n", len(invalid))
+	}
+	if *depth > 0 {
+		// Seeds are compared with discovered links in normalized form
+		seeds := make([]string, 0, len(urls))
+		seen := make(map[string]bool, len(urls))
+		for _, seed := range urls {
+			normalized, err := normalizeURL(seed)
+			if err != nil || seen[normalized] {
+				continue
+			}
+			seen[normalized] = true
+			seeds = append(seeds, normalized)
+			if entry, ok := entries[seed]; ok && normalized != seed {
+				delete(entries, seed)
+				entries[normalized] = entry
+			}
+		}
+		urls = seeds
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Printf("Error starting coordinator: %s\n", err)
+		return exitConfig
+	}
+	scheme := "http"
+	if *tlsCert != "" {
+		config, err := serverTLSConfig(*tlsCert, *tlsKey, "")
+		if err != nil {
+			listener.Close()
+			fmt.Printf("Error setting up TLS: %s\n", err)
+			return exitConfig
+		}
+		listener = tls.NewListener(listener, config)
+		scheme = "https"
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	startTime := time.Now()
+	c := newCoordinator(urls, entries, *batchSize)
+	if *depth > 0 {
+		var visited visitedSet = newMapSet()
+		if *bloomFPRate > 0 {
+			visited = newBloomFilter(*bloomCapacity, *bloomFPRate)
+		}
+		c.followLinks(*depth, *maxPages, visited)
+	}
+	health := &serverHealth{info: newBuildInfo(newRunID(), startTime)}
+	server := &http.Server{Handler: coordinatorHandler(c, health, *token)}
+	go server.Serve(listener)
+	go c.watch(*workerTimeout)
+	fmt.Printf("Coordinator listening on %s://%s/cluster with %d URLs in batches of %d\n", scheme, listener.Addr(), len(urls), *batchSize)
+	if *natsURL != "" {
+		conn, err := serveClusterNATS(c, *natsURL, *token)
+		if err != nil {
+			server.Close()
+			fmt.Printf("Error serving the cluster over NATS: %s\n", err)
+			return exitConfig
+		}
+		defer conn.Close()
+		// The URL may carry credentials
+		fmt.Printf("Coordinator serving the cluster over NATS on %s\n", natsSubjects)
+	}
+
+	// Once every URL has a result, give workers a moment to hear the crawl
+	// is over before the API goes away
+	interrupted := false
+	select {
+	case <-c.finished:
+		select {
+		case <-c.allTold:
+		case <-time.After(clusterLinger):
+		case <-signals:
+		}
+	case <-signals:
+		fmt.Printf("Stopping: saving the results collected so far\n")
+		interrupted = true
+	}
+	server.Close()
+
+	results, total, complete := c.collected()
+	sortResults(results, sortInput, urls)
+	summary := mergedSummary([]CombinedResults{{Summary: Summary{TotalTime: time.Since(startTime).Seconds(), InvalidURLs: invalid}}}, results)
+	summary.Interrupted = interrupted
+	summary.Truncated = !complete
+	if c.visited != nil {
+		stats := c.visited.Stats()
+		summary.VisitedSet = &stats
+	}
+	if err := saveResults(CombinedResults{Summary: summary, Results: results}, outputFormat{}, *output); err != nil {
+		fmt.Printf("Error saving results: %s\n", err)
+		return exitError
+	}
+	workers := c.status().Workers
+	fmt.Printf("Collected %d results of %d URLs from %d workers\n", len(results), total, len(workers))
+	for _, worker := range workers {
+		fmt.Printf("  %s: %d batches, %d results", worker.Name, worker.Batches, worker.Results)
+		if worker.Requeued > 0 {
+			fmt.Printf(", %d URLs requeued", worker.Requeued)
+		}
+		if worker.State == workerLost {
+			fmt.Printf(" (lost)")
+		}
+		fmt.Printf("\n")
+	}
+	printSummary(summary, 0, false)
+	fmt.Printf("Results saved to %s\n", *output)
+	return crawlExitCode(summary, *failureThreshold)
+}
+
+// clusterTransport carries a worker's calls to the coordinator: register,
+// batch, results, heartbeat and leave
+type clusterTransport interface {
+	// Make a call once, decoding the response into out when it is set.
+	// Answers from the coordinator that refuse the call are clusterAPIErrors.
+	call(op string, body, out interface{}) error
+	Close() error
+}
+
+// clusterClient is a worker's connection to the coordinator. It fetches URL
+// batches and sends results back in groups.
+type clusterClient struct {
+	transport   clusterTransport
+	name        string
+	workers     int  // concurrent fetches, for registering again
+	followLinks bool // send the links found on each page with its result
+
+	mu      sync.Mutex
+	pending []Result
+	flush   chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
+	err     error // the last failure to send results
+}
+
+// Connect to the coordinator at an http(s):// URL, or through a NATS server
+// at a nats:// or tls:// URL naming the cluster
+func newClusterClient(coordinatorURL, token, name string) (*clusterClient, error) {
+	var transport clusterTransport
+	if isNATSURL(coordinatorURL) {
+		var err error
+		if transport, err = dialNATSCluster(coordinatorURL, name, token); err != nil {
+			return nil, err
+		}
+	} else {
+		transport = &httpClusterTransport{
+			base:   strings.TrimRight(coordinatorURL, "/"),
+			token:  token,
+			name:   name,
+			client: &http.Client{Timeout: 30 * time.Second},
+		}
+	}
+	return &clusterClient{
+		transport: transport,
+		name:      name,
+		flush:     make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}, nil
+}
+
+// Default worker name: the host name and process ID
+func defaultWorkerName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "worker"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// Make a call to the coordinator, retrying when it can't be reached or
+// answers with a server error
+func (c *clusterClient) call(op string, body, out interface{}) error {
+	delay := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := c.transport.call(op, body, out)
+		var apiErr clusterAPIError
+		if err == nil || (errors.As(err, &apiErr) && apiErr.status < 500) || attempt == clusterRetries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// clusterAPIError is an error answer from the coordinator
+type clusterAPIError struct {
+	status  int
+	message string
+}
+
+func (e clusterAPIError) Error() string {
+	return fmt.Sprintf("coordinator: %d %s", e.status, e.message)
+}
+
+// httpClusterTransport makes a worker's calls as requests to the
+// coordinator's HTTP API
+type httpClusterTransport struct {
+	base   string
+	token  string
+	name   string
+	client *http.Client
+}
+
+func (t *httpClusterTransport) call(op string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	path := "/cluster/workers/" + t.name + "/" + op
+	if op == "register" {
+		path = "/cluster/workers"
+	}
+	req, err := http.NewRequest(http.MethodPost, t.base+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var apiErr jobError
+		json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&apiErr)
+		return clusterAPIError{resp.StatusCode, apiErr.Error}
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (t *httpClusterTransport) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+// Register with the coordinator and start sending results and heartbeats.
+// Returns whether the coordinator follows links, which the crawl must then
+// extract.
+func (c *clusterClient) register(workers int) (bool, error) {
+	c.workers = workers
+	var join ClusterJoin
+	if err := c.call("register", ClusterRegistration{Worker: c.name, Workers: workers}, &join); err != nil {
+		return false, err
+	}
+	c.followLinks = join.FollowLinks
+	go c.sendLoop()
+	go c.heartbeatLoop()
+	return join.FollowLinks, nil
+}
+
+// Report whether the coordinator gave this worker up for lost
+func isClusterGone(err error) bool {
+	var apiErr clusterAPIError
+	return errors.As(err, &apiErr) && apiErr.status == http.StatusGone
+}
+
+// Tell the coordinator this worker is alive every clusterHeartbeat, until
+// stopped. A worker given up for lost finds out at its next batch.
+func (c *clusterClient) heartbeatLoop() {
+	ticker := time.NewTicker(clusterHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.transport.call("heartbeat", struct{}{}, nil)
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// Submit the URLs of each batch the coordinator hands out until the crawl is
+// over, or submit returns false
+func (c *clusterClient) feed(ctx context.Context, opts *fetchOptions, submit func(string) bool) error {
+	for {
+		var batch ClusterBatch
+		err := c.call("batch", struct{}{}, &batch)
+		if isClusterGone(err) {
+			// The URLs it held went to other workers; join again for more
+			fmt.Printf("Coordinator gave this worker up for lost; registering again\n")
+			err = c.call("register", ClusterRegistration{Worker: c.name, Workers: c.workers}, nil)
+		}
+		if err != nil {
+			return err
+		}
+		if batch.Done {
+			return nil
+		}
+		if len(batch.URLs) == 0 {
+			// Other workers hold the rest; let URLs waiting on Retry-After
+			// through meanwhile
+			select {
+			case <-time.After(clusterWait):
+			case <-ctx.Done():
+				return nil
+			}
+			if !submit("") {
+				return nil
+			}
+			continue
+		}
+		opts.enqueue(len(batch.URLs))
+		for _, urlStr := range batch.URLs {
+			if !submit(urlStr) {
+				return nil
+			}
+		}
+	}
+}
+
+// Queue a result to send to the coordinator
+func (c *clusterClient) add(result Result) {
+	c.mu.Lock()
+	c.pending = append(c.pending, result)
+	full := len(c.pending) >= clusterFlushResults
+	c.mu.Unlock()
+	if full {
+		select {
+		case c.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Send queued results every clusterFlushEvery, or sooner when enough are
+// waiting, until stopped
+func (c *clusterClient) sendLoop() {
+	defer close(c.stopped)
+	ticker := time.NewTicker(clusterFlushEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.flush:
+		case <-c.stop:
+			c.send()
+			return
+		}
+		c.send()
+	}
+}
+
+// Send the queued results. Results that couldn't be sent stay queued for the
+// next attempt.
+func (c *clusterClient) send() {
+	c.mu.Lock()
+	results := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+	if len(results) == 0 {
+		return
+	}
+	body := ClusterResults{Results: results}
+	if c.followLinks {
+		body.Links = make(map[string][]string)
+		for _, result := range results {
+			if len(result.Links) > 0 {
+				body.Links[result.URL] = result.Links
+			}
+		}
+	}
+	err := c.call("results", body, nil)
+	if isClusterGone(err) {
+		// Their URLs went back in the queue when this worker was lost
+		err = nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+	if err != nil {
+		c.pending = append(results, c.pending...)
+	}
+}
+
+// Send the last results, leave the cluster and stop. Returns the error of
+// the last send, if it failed. Leaving hands back any URLs this worker
+// still holds, as after an interrupt, without waiting for the heartbeat
+// timeout.
+func (c *clusterClient) Close() error {
+	close(c.stop)
+	<-c.stopped
+	defer c.transport.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return fmt.Errorf("%d results not sent: %w", len(c.pending), c.err)
+	}
+	c.call("leave", struct{}{}, nil)
+	return nil
+}
+
+// Flags a cluster worker can't combine with -coordinator, which supplies the
+// URLs
+var clusterIncompatibleFlags = []string{"input", "sitemap", "discover-sitemaps", "retry-from", "scale", "offset", "limit", "sample", "sample-n", "shuffle", "since", "depth", "frontier-dir", "pre-resolve"}
+
+// Reject flags that don't make sense for a cluster worker
+func checkClusterFlags(flags *flag.FlagSet) error {
+	var err error
+	flags.Visit(func(f *flag.Flag) {
+		for _, name := range clusterIncompatibleFlags {
+			if f.Name == name && err == nil {
+				err = fmt.Errorf("-coordinator cannot be combined with -%s; the coordinator hands out the URLs", name)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return checkStreamFlags(flags)
+}
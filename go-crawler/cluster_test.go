@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// A test worker speaking the coordinator's HTTP API, crawling by making up
+// a result for each URL it is handed
+type testWorker struct {
+	transport *httpClusterTransport
+	crawled   map[string]int
+}
+
+func newTestWorker(t *testing.T, base, name string) *testWorker {
+	w := &testWorker{
+		transport: &httpClusterTransport{base: base, name: name, client: &http.Client{Timeout: 5 * time.Second}},
+		crawled:   make(map[string]int),
+	}
+	if err := w.transport.call("register", ClusterRegistration{Worker: name, Workers: 1}, nil); err != nil {
+		t.Fatalf("registering %s: %v", name, err)
+	}
+	return w
+}
+
+// Fetch a batch and crawl it, sending results back for the first send URLs
+// of it, or all of them when send is negative
+func (w *testWorker) crawl(t *testing.T, send int) ClusterBatch {
+	var batch ClusterBatch
+	if err := w.transport.call("batch", struct{}{}, &batch); err != nil {
+		t.Fatalf("%s fetching a batch: %v", w.transport.name, err)
+	}
+	if send < 0 || send > len(batch.URLs) {
+		send = len(batch.URLs)
+	}
+	var results []Result
+	for _, urlStr := range batch.URLs[:send] {
+		w.crawled[urlStr]++
+		results = append(results, Result{URL: urlStr, Status: http.StatusOK})
+	}
+	if len(results) > 0 {
+		if err := w.transport.call("results", ClusterResults{Results: results}, nil); err != nil {
+			t.Fatalf("%s sending results: %v", w.transport.name, err)
+		}
+	}
+	return batch
+}
+
+// A worker that stops heartbeating is given up for lost, and the URLs it
+// held are crawled by the other worker, each exactly once
+func TestClusterReassignsLostWorker(t *testing.T) {
+	var urls []string
+	for host := 0; host < 10; host++ {
+		for page := 0; page < 3; page++ {
+			urls = append(urls, fmt.Sprintf("http://host-%d.test/page-%d", host, page))
+		}
+	}
+	c := newCoordinator(urls, nil, 5)
+	health := &serverHealth{info: newBuildInfo(newRunID(), time.Now())}
+	server := httptest.NewServer(coordinatorHandler(c, health, ""))
+	defer server.Close()
+	go c.watch(200 * time.Millisecond)
+
+	lost := newTestWorker(t, server.URL, "lost")
+	alive := newTestWorker(t, server.URL, "alive")
+
+	// The lost worker sends back part of its first batch, then dies holding
+	// the rest
+	held := lost.crawl(t, 2)
+	if len(held.URLs) <= 2 {
+		t.Fatalf("lost worker got %d URLs, want more than 2 to hold", len(held.URLs))
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if time.Now().After(deadline) {
+			t.Fatalf("crawl not done: %+v", c.status())
+		}
+		batch := alive.crawl(t, -1)
+		if batch.Done {
+			break
+		}
+		if len(batch.URLs) == 0 {
+			// Hosts held by the lost worker wait for it to be given up
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	for _, urlStr := range held.URLs[2:] {
+		if alive.crawled[urlStr] == 0 {
+			t.Errorf("%s, held by the lost worker, was not reassigned", urlStr)
+		}
+	}
+	results, total, complete := c.collected()
+	if !complete || total != len(urls) || len(results) != len(urls) {
+		t.Fatalf("got %d results of %d URLs (complete %v), want %d", len(results), total, complete, len(urls))
+	}
+	got := make(map[string]int)
+	for _, result := range results {
+		got[result.URL]++
+	}
+	for _, urlStr := range urls {
+		if crawls := lost.crawled[urlStr] + alive.crawled[urlStr]; crawls != 1 || got[urlStr] != 1 {
+			t.Errorf("%s crawled %d times with %d results, want once", urlStr, crawls, got[urlStr])
+		}
+	}
+
+	workers := c.status().Workers
+	if workers[0].State != workerLost || workers[0].Requeued != len(held.URLs)-2 {
+		t.Errorf("lost worker: state %s, %d URLs requeued, want %s and %d", workers[0].State, workers[0].Requeued, workerLost, len(held.URLs)-2)
+	}
+	// Results it sends late are refused, so none arrives twice
+	late := ClusterResults{Results: []Result{{URL: held.URLs[2], Status: http.StatusOK}}}
+	if err := lost.transport.call("results", late, nil); !isClusterGone(err) {
+		t.Errorf("late results from the lost worker: got %v, want 410 Gone", err)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// command is a subcommand of the crawler binary
+type command struct {
+	name    string
+	aliases []string
+	summary string
+	run     func(args []string) int
+}
+
+// Subcommands in the order the help lists them. Without one the arguments
+// are crawl flags and URLs, as they were before subcommands existed.
+var commands = []command{
+	{"crawl", nil, "Crawl a URL list, or URLs given as arguments (the default)", runCrawl},
+	{"serve", nil, "Crawl with the live web dashboard, on :8080 unless -serve is given", runServe},
+	{"server", nil, "Run named crawl jobs submitted over HTTP, side by side", runJobServer},
+	{"coordinator", nil, "Hand a URL list out to cluster workers (crawl -coordinator) and collect their results", runCoordinator},
+	{"bench", nil, "Crawl several times and report timing statistics", runBench},
+	{"compare", nil, "Compare two results files side by side, e.g. Go and Python", runCompare},
+	{"report", nil, "Print the summary of a results file", runReport},
+	{"diff", []string{"results-diff"}, "Report what changed between two results files", runDiff},
+	{"merge", nil, "Merge results files from sharded crawls", runMerge},
+	{"history", nil, "Show trends from a -history file", runHistory},
+	{"prune", nil, "Delete old runs from a -history file, or old finished jobs from a server -store", runPrune},
+	{"lint-urls", nil, "Check URL list files without fetching anything", runLint},
+	{"config", nil, "Validate a crawl's config (check) or print the effective config (print)", runConfig},
+}
+
+// Find a subcommand by name or alias
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+		for _, alias := range commands[i].aliases {
+			if alias == name {
+				return &commands[i]
+			}
+		}
+	}
+	return nil
+}
+
+func main() {
+	args := os.Args[1:]
+	if len(args) > 0 {
+		if cmd := findCommand(args[0]); cmd != nil {
+			os.Exit(cmd.run(args[1:]))
+		}
+		if args[0] == "help" {
+			printUsage()
+			os.Exit(exitOK)
+		}
+		// Anything else that isn't a flag or a URL is a mistyped command
+		if !strings.HasPrefix(args[0], "-") && !strings.Contains(args[0], "://") {
+			fmt.Printf("Unknown command %q\n\n", args[0])
+			printUsage()
+			os.Exit(exitConfig)
+		}
+	}
+	os.Exit(runCrawl(args))
+}
+
+// Print the list of subcommands
+func printUsage() {
+	fmt.Printf("Usage: crawler [command] [flags] [args]\n\nCommands:\n")
+	for _, cmd := range commands {
+		name := cmd.name
+		if len(cmd.aliases) > 0 {
+			name += " (" + strings.Join(cmd.aliases, ", ") + ")"
+		}
+		fmt.Printf("  %-20s %s\n", name, cmd.summary)
+	}
+	fmt.Printf("\nWithout a command, crawl is run. Use \"crawler <command> -h\" for a command's flags.\n")
+}
+
+// Usage of the crawl flags
+func crawlUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: crawler [crawl] [flags] [URL...]\n")
+	fmt.Fprintf(out, "Run \"crawler help\" for the other commands.\n\n")
+	flag.PrintDefaults()
+}
+
+// Address the serve command's dashboard listens on by default
+const defaultServeAddr = ":8080"
+
+// Run a crawl with the web dashboard. A -serve flag in the arguments
+// overrides the default address, since the last value of a flag wins.
+func runServe(args []string) int {
+	return runCrawl(append([]string{"-serve", defaultServeAddr}, args...))
+}
+
+// Run the bench subcommand: crawl several times with the same crawl flags,
+// each in a fresh process, and report the spread of the timings
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	runs := fs.Int("runs", 3, "Number of crawls to time")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: crawler bench [-runs N] [-- crawl flags]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *runs < 1 {
+		fs.Usage()
+		return exitConfig
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Printf("Error getting executable path: %s\n", err)
+		return exitError
+	}
+	// Each run writes here, whatever -output or CRAWLER_OUTPUT say, since the
+	// last -output flag wins
+	dir, err := os.MkdirTemp("", "crawler-bench-")
+	if err != nil {
+		fmt.Printf("Error creating temporary directory: %s\n", err)
+		return exitError
+	}
+	defer os.RemoveAll(dir)
+	resultsFile := filepath.Join(dir, "results.json")
+
+	times := make([]float64, 0, *runs)
+	var rates []float64
+	for i := 1; i <= *runs; i++ {
+		cmd := exec.Command(exe, append(append([]string{"crawl"}, fs.Args()...), "-output", resultsFile)...)
+		cmd.Stderr = os.Stderr
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && (exitErr.ExitCode() == exitFailures || exitErr.ExitCode() == exitPartial) {
+			// Failed fetches are part of what is being measured
+			err = nil
+		}
+		if err != nil {
+			fmt.Printf("Error in run %d: %s\n", i, err)
+			return exitError
+		}
+
+		combined, err := loadResults(resultsFile)
+		if err != nil {
+			fmt.Printf("Error loading results of run %d: %s\n", i, err)
+			return exitError
+		}
+		summary := combined.Summary
+		times = append(times, summary.TotalTime)
+		rate := 0.0
+		if summary.TotalTime > 0 {
+			rate = float64(summary.TotalURLs) / summary.TotalTime
+		}
+		rates = append(rates, rate)
+		fmt.Printf("Run %d: %.2f seconds, %d of %d successful, %.1f URLs/s\n",
+			i, summary.TotalTime, summary.SuccessfulFetches, summary.TotalURLs, rate)
+	}
+
+	mean, min, max, stddev := describe(times)
+	fmt.Printf("\nTotal time over %d runs: mean %.2fs, min %.2fs, max %.2fs, stddev %.2fs\n", len(times), mean, min, max, stddev)
+	mean, min, max, _ = describe(rates)
+	fmt.Printf("Throughput: mean %.1f URLs/s, min %.1f, max %.1f\n", mean, min, max)
+	return exitOK
+}
+
+// Mean, minimum, maximum and sample standard deviation of a non-empty list
+func describe(values []float64) (mean, min, max, stddev float64) {
+	min, max = values[0], values[0]
+	for _, v := range values {
+		mean += v
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	mean /= float64(len(values))
+	if len(values) > 1 {
+		for _, v := range values {
+			stddev += (v - mean) * (v - mean)
+		}
+		stddev = math.Sqrt(stddev / float64(len(values)-1))
+	}
+	return mean, min, max, stddev
+}
+
+// Run the compare subcommand: print two runs' summaries side by side, with
+// the speedup and how many URLs got the same status and title
+func runCompare(args []string) int {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: crawler compare results_a.json results_b.json\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return exitConfig
+	}
+
+	var runs [2]CombinedResults
+	for i := range runs {
+		var err error
+		if runs[i], err = loadResults(fs.Arg(i)); err != nil {
+			fmt.Printf("Error loading %s: %s\n", fs.Arg(i), err)
+			return exitError
+		}
+	}
+	a, b := runs[0].Summary, runs[1].Summary
+	nameA, nameB := filepath.Base(fs.Arg(0)), filepath.Base(fs.Arg(1))
+
+	rate := func(s Summary) float64 {
+		if s.TotalTime == 0 {
+			return 0
+		}
+		return float64(s.TotalURLs) / s.TotalTime
+	}
+	fmt.Printf("%-22s %20s %20s\n", "", nameA, nameB)
+	fmt.Printf("%-22s %20d %20d\n", "Total URLs", a.TotalURLs, b.TotalURLs)
+	fmt.Printf("%-22s %20d %20d\n", "Successful fetches", a.SuccessfulFetches, b.SuccessfulFetches)
+	fmt.Printf("%-22s %20d %20d\n", "Failed fetches", a.FailedFetches, b.FailedFetches)
+	fmt.Printf("%-22s %20.2f %20.2f\n", "Total time (s)", a.TotalTime, b.TotalTime)
+	fmt.Printf("%-22s %20.4f %20.4f\n", "Average per URL (s)", a.AverageTimePerURL, b.AverageTimePerURL)
+	fmt.Printf("%-22s %20.1f %20.1f\n", "URLs per second", rate(a), rate(b))
+	if a.TotalTime > 0 && b.TotalTime > 0 {
+		if a.TotalTime <= b.TotalTime {
+			fmt.Printf("\n%s was %.2fx faster\n", nameA, b.TotalTime/a.TotalTime)
+		} else {
+			fmt.Printf("\n%s was %.2fx faster\n", nameB, a.TotalTime/b.TotalTime)
+		}
+	}
+
+	byURL := make(map[string]Result, len(runs[1].Results))
+	for _, result := range runs[1].Results {
+		byURL[result.URL] = result
+	}
+	common, sameStatus, sameTitle := 0, 0, 0
+	for _, result := range runs[0].Results {
+		other, ok := byURL[result.URL]
+		if !ok {
+			continue
+		}
+		common++
+		if result.Status == other.Status {
+			sameStatus++
+		}
+		if result.Title == other.Title {
+			sameTitle++
+		}
+	}
+	fmt.Printf("URLs in both: %d; same status: %d; same title: %d\n", common, sameStatus, sameTitle)
+	return exitOK
+}
+
+// Run the report subcommand: print the summary of a results file the way
+// the crawl printed it, with the run metadata when the file has it
+func runReport(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: crawler report [results.json]\n")
+		fmt.Fprintf(fs.Output(), "Without a file, the go_results.json next to the crawler is read.\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return exitConfig
+	}
+
+	path := fs.Arg(0)
+	if path == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			fmt.Printf("Error getting executable path: %s\n", err)
+			return exitError
+		}
+		path = filepath.Join(filepath.Dir(exe), "go_results.json")
+	}
+	combined, err := loadResults(path)
+	if err != nil {
+		fmt.Printf("Error loading %s: %s\n", path, err)
+		return exitError
+	}
+
+	var deadline time.Duration
+	incremental := false
+	if run := combined.Run; run != nil {
+		fmt.Printf("Run %s: crawler %s (%s) on %s, %s to %s\n", run.ID, run.Version, run.GoVersion, run.Hostname,
+			run.StartedAt.Format(time.RFC3339), run.EndedAt.Format(time.RFC3339))
+		deadline, _ = time.ParseDuration(run.Flags["deadline"])
+		incremental = run.Flags["since"] != ""
+	}
+	printSummary(combined.Summary, deadline, incremental)
+	return exitOK
+}
+
+// Run the config subcommand: resolve the crawl flags and config file given
+// after the action as a crawl would, then check or print them. Invalid
+// options exit with exitConfig like a crawl.
+func runConfig(args []string) int {
+	if len(args) == 0 || (args[0] != "check" && args[0] != "print") {
+		fmt.Printf("Usage: crawler config check|print [-config file.json] [crawl flags]\n")
+		return exitConfig
+	}
+	return crawl(args[1:], args[0])
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func init() {
+	// Registered here rather than in the table, which runCompletion reads
+	commands = append(commands, command{"completion", nil, "Print a shell completion script: bash, zsh or fish", runCompletion})
+}
+
+// completionFlag is a flag offered by shell completion
+type completionFlag struct {
+	name  string
+	usage string
+	value bool // takes a value, so the next word is completed as a file
+}
+
+// completionCommand is a subcommand and the flags it accepts
+type completionCommand struct {
+	names   []string // name and aliases
+	summary string
+	flags   []completionFlag
+}
+
+// Collect a subcommand's flags from its -h output. Each command builds its
+// flag set when it runs and -h exits, so it is run in a fresh process.
+func commandFlags(exe, name string) ([]completionFlag, error) {
+	out, err := exec.Command(exe, name, "-h").CombinedOutput()
+	if _, exited := err.(*exec.ExitError); err != nil && !exited {
+		return nil, err
+	}
+	return parseFlagDefaults(bytes.NewReader(out)), nil
+}
+
+// Parse the flags out of flag.PrintDefaults output: a "  -name type" line per
+// flag, where bool flags have no type, followed by indented usage lines
+func parseFlagDefaults(r io.Reader) []completionFlag {
+	var flags []completionFlag
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "    \t") && len(flags) > 0 {
+			if last := &flags[len(flags)-1]; last.usage == "" {
+				last.usage = strings.TrimSpace(line)
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, "  -") {
+			continue
+		}
+		// One-letter bool flags have their usage on the same line
+		head, usage, _ := strings.Cut(line[3:], "\t")
+		fields := strings.Fields(head)
+		if len(fields) == 0 {
+			continue
+		}
+		flags = append(flags, completionFlag{name: fields[0], usage: strings.TrimSpace(usage), value: len(fields) > 1})
+	}
+	return flags
+}
+
+// Gather every subcommand with its flags. serve and config take the crawl
+// flags.
+func completionCommands() ([]completionCommand, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	var crawlFlags []completionFlag
+	var cmds []completionCommand
+	for _, cmd := range commands {
+		cc := completionCommand{names: append([]string{cmd.name}, cmd.aliases...), summary: cmd.summary}
+		switch cmd.name {
+		case "completion":
+		case "serve", "config":
+			cc.flags = crawlFlags
+		default:
+			if cc.flags, err = commandFlags(exe, cmd.name); err != nil {
+				return nil, err
+			}
+		}
+		if cmd.name == "crawl" {
+			crawlFlags = cc.flags
+		}
+		cmds = append(cmds, cc)
+	}
+	return append(cmds, completionCommand{names: []string{"help"}, summary: "List the commands"}), nil
+}
+
+// Names of the flags, each with a leading dash
+func flagNames(flags []completionFlag, valueOnly bool) []string {
+	var names []string
+	for _, f := range flags {
+		if f.value || !valueOnly {
+			names = append(names, "-"+f.name)
+		}
+	}
+	return names
+}
+
+// Write a bash completion script. Without a command the words are crawl
+// flags, as on the command line.
+func writeBashCompletion(w io.Writer, cmds []completionCommand) {
+	var names []string
+	for _, cmd := range cmds {
+		names = append(names, cmd.names...)
+	}
+	fmt.Fprintf(w, `# bash completion for crawler
+# Load with: source <(crawler completion bash)
+_crawler() {
+    local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}
+    local commands="%s" cmd=crawl flags values
+    if [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then
+        COMPREPLY=($(compgen -W "$commands" -- "$cur") $(compgen -f -- "$cur"))
+        return
+    fi
+    if [[ " $commands " == *" ${COMP_WORDS[1]} "* ]]; then
+        cmd=${COMP_WORDS[1]}
+    fi
+    case $cmd in
+`, strings.Join(names, " "))
+	for _, cmd := range cmds {
+		fmt.Fprintf(w, "    %s)\n        flags=%q\n        values=%q\n        ;;\n",
+			strings.Join(cmd.names, "|"), strings.Join(flagNames(cmd.flags, false), " "),
+			" "+strings.Join(flagNames(cmd.flags, true), " ")+" ")
+	}
+	fmt.Fprint(w, `    esac
+    if [[ $values == *" $prev "* ]]; then
+        COMPREPLY=($(compgen -f -- "$cur"))
+    elif [[ $cur == -* ]]; then
+        COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+    else
+        COMPREPLY=($(compgen -f -- "$cur"))
+    fi
+}
+complete -o filenames -F _crawler crawler
+`)
+}
+
+// Escape text for a single-quoted zsh _arguments spec or _describe item
+func zshQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+	return strings.ReplaceAll(s, "'", `'\''`)
+}
+
+// Write a zsh completion script
+func writeZshCompletion(w io.Writer, cmds []completionCommand) {
+	fmt.Fprint(w, `#compdef crawler
+# Load with: source <(crawler completion zsh)
+_crawler() {
+    local -a commands
+    commands=(
+`)
+	for _, cmd := range cmds {
+		for _, name := range cmd.names {
+			fmt.Fprintf(w, "        '%s:%s'\n", name, zshQuote(cmd.summary))
+		}
+	}
+	fmt.Fprint(w, `    )
+    if (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then
+        _describe -t commands command commands
+        _files
+        return
+    fi
+    local cmd=crawl
+    if [[ -n ${(M)commands:#${(b)words[2]}:*} ]]; then
+        cmd=$words[2]
+        shift words
+        (( CURRENT-- ))
+    fi
+    case $cmd in
+`)
+	for _, cmd := range cmds {
+		fmt.Fprintf(w, "    %s)\n        _arguments \\\n", strings.Join(cmd.names, "|"))
+		for _, f := range cmd.flags {
+			spec := fmt.Sprintf("-%s[%s]", f.name, zshQuote(f.usage))
+			if f.value {
+				spec += ":" + f.name + ":_files"
+			}
+			fmt.Fprintf(w, "            '%s' \\\n", spec)
+		}
+		fmt.Fprint(w, "            '*:file:_files'\n        ;;\n")
+	}
+	fmt.Fprint(w, `    esac
+}
+compdef _crawler crawler
+`)
+}
+
+// Escape text for a single-quoted fish string
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// Write a fish completion script. Crawl flags are offered until another
+// command is seen.
+func writeFishCompletion(w io.Writer, cmds []completionCommand) {
+	var others []string
+	for _, cmd := range cmds {
+		if cmd.names[0] != "crawl" {
+			others = append(others, cmd.names...)
+		}
+	}
+	fmt.Fprint(w, "# fish completion for crawler\n# Load with: crawler completion fish | source\ncomplete -c crawler -e\n")
+	for _, cmd := range cmds {
+		for _, name := range cmd.names {
+			fmt.Fprintf(w, "complete -c crawler -n __fish_use_subcommand -a %s -d %s\n", name, fishQuote(cmd.summary))
+		}
+	}
+	for _, cmd := range cmds {
+		condition := "__fish_seen_subcommand_from " + strings.Join(cmd.names, " ")
+		if cmd.names[0] == "crawl" {
+			condition = "not __fish_seen_subcommand_from " + strings.Join(others, " ")
+		}
+		for _, f := range cmd.flags {
+			fmt.Fprintf(w, "complete -c crawler -n %s -o %s -d %s", fishQuote(condition), f.name, fishQuote(f.usage))
+			if f.value {
+				fmt.Fprint(w, " -r -F")
+			}
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// Run the completion subcommand and return the process exit code
+func runCompletion(args []string) int {
+	fs := flag.NewFlagSet("completion", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: crawler completion bash|zsh|fish\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitConfig
+	}
+
+	writers := map[string]func(io.Writer, []completionCommand){
+		"bash": writeBashCompletion,
+		"zsh":  writeZshCompletion,
+		"fish": writeFishCompletion,
+	}
+	write, ok := writers[fs.Arg(0)]
+	if !ok {
+		fmt.Printf("Error: unsupported shell %q (use bash, zsh or fish)\n", fs.Arg(0))
+		return exitConfig
+	}
+	cmds, err := completionCommands()
+	if err != nil {
+		fmt.Printf("Error collecting flags: %s\n", err)
+		return exitError
+	}
+	w := bufio.NewWriter(os.Stdout)
+	write(w, cmds)
+	if err := w.Flush(); err != nil {
+		fmt.Printf("Error writing completion script: %s\n", err)
+		return exitError
+	}
+	return exitOK
+}
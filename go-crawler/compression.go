@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Encodings the crawler can decode itself. Asking for them explicitly stops
+// the transport from decoding transparently, which would hide the on-wire
+// size.
+const acceptEncoding = "gzip, deflate"
+
+// Wrap a response body in a decoder for its Content-Encoding. Unknown
+// encodings are returned undecoded with ok set to false.
+func decodeBody(encoding string, body io.Reader) (reader io.Reader, ok bool, err error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, true, nil
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(body)
+		return reader, err == nil, err
+	case "deflate":
+		// Servers send either zlib-wrapped or raw deflate data
+		buffered := bufio.NewReader(body)
+		if header, err := buffered.Peek(2); err == nil && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 && header[0]&0x0f == 8 {
+			reader, err := zlib.NewReader(buffered)
+			return reader, err == nil, err
+		}
+		return flate.NewReader(buffered), true, nil
+	}
+	return body, false, nil
+}
+
+// Record the decoded size and compression ratio of a response
+func setCompressionStats(result *Result, resp *http.Response, decodedBytes int64, decoded bool) {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding == "identity" {
+		encoding = ""
+	}
+	result.ContentEncoding = encoding
+	if !decoded {
+		return
+	}
+	result.DecodedBytes = decodedBytes
+	if encoding != "" && result.BodyBytes > 0 {
+		result.CompressionRatio = float64(decodedBytes) / float64(result.BodyBytes)
+	}
+}
+
+// Text responses worth compressing
+func isCompressible(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, kind := range []string{"text/", "json", "javascript", "xml", "svg"} {
+		if strings.Contains(contentType, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// DomainCompression aggregates compression for one domain
+type DomainCompression struct {
+	Responses    int     `json:"responses"`
+	Compressed   int     `json:"compressed"`
+	WireBytes    int64   `json:"wire_bytes"`
+	DecodedBytes int64   `json:"decoded_bytes"`
+	Ratio        float64 `json:"ratio"` // decoded bytes per wire byte
+}
+
+// UncompressedPage is a large compressible response served without
+// compression
+type UncompressedPage struct {
+	URL   string `json:"url"`
+	Bytes int64  `json:"bytes"`
+}
+
+// CompressionStats summarizes compression across a crawl
+type CompressionStats struct {
+	Responses         int                           `json:"responses"`
+	Compressed        int                           `json:"compressed"`
+	Ratio             float64                       `json:"ratio"`
+	Domains           map[string]*DomainCompression `json:"domains"`
+	LargeUncompressed []UncompressedPage            `json:"large_uncompressed"`
+}
+
+// Summarize compression per domain and list compressible responses of at
+// least largeBytes that were sent uncompressed
+func summarizeCompression(results []Result, largeBytes int64) *CompressionStats {
+	stats := &CompressionStats{
+		Domains:           make(map[string]*DomainCompression),
+		LargeUncompressed: []UncompressedPage{},
+	}
+	var wireBytes, decodedBytes int64
+
+	for _, result := range results {
+		if result.BodyBytes == 0 || result.DecodedBytes == 0 {
+			continue
+		}
+		domain := stats.Domains[result.Domain]
+		if domain == nil {
+			domain = &DomainCompression{}
+			stats.Domains[result.Domain] = domain
+		}
+		domain.Responses++
+		domain.WireBytes += result.BodyBytes
+		domain.DecodedBytes += result.DecodedBytes
+		stats.Responses++
+		wireBytes += result.BodyBytes
+		decodedBytes += result.DecodedBytes
+
+		if result.ContentEncoding != "" {
+			domain.Compressed++
+			stats.Compressed++
+		} else if largeBytes > 0 && result.BodyBytes >= largeBytes && isCompressible(result.ContentType) {
+			stats.LargeUncompressed = append(stats.LargeUncompressed, UncompressedPage{URL: result.URL, Bytes: result.BodyBytes})
+		}
+	}
+	if stats.Responses == 0 {
+		return nil
+	}
+
+	for _, domain := range stats.Domains {
+		domain.Ratio = float64(domain.DecodedBytes) / float64(domain.WireBytes)
+	}
+	stats.Ratio = float64(decodedBytes) / float64(wireBytes)
+	sort.Slice(stats.LargeUncompressed, func(i, j int) bool {
+		return stats.LargeUncompressed[i].Bytes > stats.LargeUncompressed[j].Bytes
+	})
+	return stats
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Load a JSON config file. Each key names a flag with underscores in place
+// of hyphens, e.g. {"workers": 20, "capture_headers": ["server"]}.
+func loadConfigFile(filePath string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var config map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	return config, nil
+}
+
+// Config file keys for settings that are not flags
+var configSections = []string{domainsConfigKey, rewritesConfigKey}
+
+// Report whether a config key holds a section rather than a flag value
+func isConfigSection(key string) bool {
+	for _, section := range configSections {
+		if key == section {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply config values to flags that were not set on the command line, so
+// explicit flags always win
+func applyConfig(fs *flag.FlagSet, config map[string]interface{}) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for key, value := range config {
+		// Settings that are not flags are read by the crawl itself
+		if isConfigSection(key) {
+			continue
+		}
+		name := strings.ReplaceAll(key, "_", "-")
+		f := fs.Lookup(name)
+		if f == nil {
+			return fmt.Errorf("unknown config key %q", key)
+		}
+		if explicit[name] {
+			continue
+		}
+		if err := setFlagValue(f, value); err != nil {
+			return fmt.Errorf("config key %q: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// Prefix of the environment variables that set flags: CRAWLER_ and the flag
+// name in upper case with underscores, e.g. CRAWLER_CAPTURE_HEADERS
+const envPrefix = "CRAWLER_"
+
+// Set flags that were not given on the command line from their environment
+// variables, returning the names of the flags set. They count as set on the
+// command line from then on, so the config file doesn't override them.
+// Repeatable flags take a comma separated list. Variables that don't name a
+// flag are ignored, since container platforms add their own (Kubernetes sets
+// CRAWLER_SERVICE_HOST for a service named crawler).
+func applyEnv(fs *flag.FlagSet, environ []string) ([]string, error) {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	var applied []string
+	for _, entry := range environ {
+		key, value, _ := strings.Cut(entry, "=")
+		if !strings.HasPrefix(key, envPrefix) {
+			continue
+		}
+		name := strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(key, envPrefix), "_", "-"))
+		f := fs.Lookup(name)
+		if f == nil || explicit[name] {
+			continue
+		}
+		values := []string{value}
+		if _, repeatable := f.Value.(*stringListFlag); repeatable {
+			values = strings.Split(value, ",")
+		}
+		for _, v := range values {
+			if err := fs.Set(name, v); err != nil {
+				return nil, fmt.Errorf("environment variable %s: invalid value %q: %w", key, v, err)
+			}
+		}
+		applied = append(applied, name)
+	}
+	return applied, nil
+}
+
+// Set a flag from a decoded JSON value. Arrays set repeatable flags once per
+// element and are comma joined for everything else.
+func setFlagValue(f *flag.Flag, value interface{}) error {
+	switch v := value.(type) {
+	case []interface{}:
+		if _, repeatable := f.Value.(*stringListFlag); repeatable {
+			for _, element := range v {
+				if err := f.Value.Set(fmt.Sprint(element)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		parts := make([]string, len(v))
+		for i, element := range v {
+			parts[i] = fmt.Sprint(element)
+		}
+		return f.Value.Set(strings.Join(parts, ","))
+	case map[string]interface{}, nil:
+		return fmt.Errorf("unsupported value %v", value)
+	default:
+		return f.Value.Set(fmt.Sprint(v))
+	}
+}
+
+// Where a flag's effective value came from
+const (
+	sourceDefault     = "default"
+	sourceConfigFile  = "config file"
+	sourceEnv         = "environment"
+	sourceCommandLine = "command line"
+)
+
+// Find where each flag's value came from. applyConfig sets values without
+// marking the flags as set, so Visit only sees the command line and the
+// environment.
+func flagSources(fs *flag.FlagSet, config map[string]interface{}, fromEnv []string) map[string]string {
+	sources := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		sources[f.Name] = sourceDefault
+	})
+	for key := range config {
+		if !isConfigSection(key) {
+			sources[strings.ReplaceAll(key, "_", "-")] = sourceConfigFile
+		}
+	}
+	fs.Visit(func(f *flag.Flag) {
+		sources[f.Name] = sourceCommandLine
+	})
+	for _, name := range fromEnv {
+		sources[name] = sourceEnv
+	}
+	return sources
+}
+
+// A flag's value as it would be written in a config file: repeatable flags
+// as arrays, numbers and bools as JSON numbers and bools, the rest as text
+func configValue(f *flag.Flag) interface{} {
+	if list, ok := f.Value.(*stringListFlag); ok {
+		return append([]string{}, *list...)
+	}
+	if getter, ok := f.Value.(flag.Getter); ok {
+		switch v := getter.Get().(type) {
+		case bool, int, int64, uint, uint64, float64:
+			return v
+		}
+	}
+	return f.Value.String()
+}
+
+// Report on the resolved options for the config subcommand. check lists the
+// options whose values differ from the defaults and where they were set; print
+// writes every option as a config file.
+func reportConfig(action string, fs *flag.FlagSet, config map[string]interface{}, fromEnv []string) int {
+	sources := flagSources(fs, config, fromEnv)
+	switch action {
+	case "check":
+		fmt.Printf("Config OK\n")
+		fs.VisitAll(func(f *flag.Flag) {
+			if f.Value.String() != f.DefValue {
+				fmt.Printf("  %-24s %-30s (%s)\n", f.Name, f.Value.String(), sources[f.Name])
+			}
+		})
+		if policies, _ := parseDomainPolicies(config[domainsConfigKey]); len(policies) > 0 {
+			fmt.Printf("  %-24s %-30s (%s)\n", domainsConfigKey, fmt.Sprintf("%d policies", len(policies)), sourceConfigFile)
+		}
+		if rules, _ := parseRewriteRules(config[rewritesConfigKey]); len(rules) > 0 {
+			fmt.Printf("  %-24s %-30s (%s)\n", rewritesConfigKey, fmt.Sprintf("%d rules", len(rules)), sourceConfigFile)
+		}
+	case "print":
+		effective := make(map[string]interface{})
+		fs.VisitAll(func(f *flag.Flag) {
+			// A config file can't name another one
+			if f.Name != "config" {
+				effective[strings.ReplaceAll(f.Name, "-", "_")] = configValue(f)
+			}
+		})
+		for _, key := range configSections {
+			if section, ok := config[key]; ok {
+				effective[key] = section
+			}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(effective); err != nil {
+			fmt.Printf("Error encoding config: %s\n", err)
+			return exitError
+		}
+	}
+	return exitOK
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// config check refuses exactly the flags a crawl refuses, before the crawl
+// would fetch anything
+func TestConfigCheckAgreesWithCrawl(t *testing.T) {
+	input := writeInput(t, "urls.txt", "https://a.example/\n")
+	output := filepath.Join(t.TempDir(), "out.json")
+	for _, tc := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"-offset", "-1"}, "-offset and -limit must not be negative"},
+		{[]string{"-limit", "-5"}, "-offset and -limit must not be negative"},
+		{[]string{"-sample", "abc"}, `invalid sample "abc"`},
+		{[]string{"-fail-fast-rate", "0.5", "-fail-fast-window", "0"}, "-fail-fast-window must be at least 1"},
+	} {
+		args := append([]string{"-input", input, "-output", output}, tc.args...)
+		for _, command := range [][]string{{"config", "check"}, nil} {
+			out, code := runCrawler(t, append(command, args...)...)
+			if code != exitConfig || !strings.Contains(out, tc.err) {
+				t.Errorf("%v %v: got exit code %d, want %d, with output:\n%s", command, tc.args, code, exitConfig, out)
+			}
+		}
+	}
+
+	out, code := runCrawler(t, "config", "check", "-input", input, "-offset", "1", "-limit", "5", "-sample", "50%")
+	if code != exitOK || !strings.Contains(out, "Config OK") {
+		t.Errorf("got exit code %d, want %d, with output:\n%s", code, exitOK, out)
+	}
+}
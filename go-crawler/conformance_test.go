@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Shared fixture that every crawler implementation must reproduce
+const conformanceDir = "../conformance"
+
+// conformanceRoute is how the fixture server answers one path
+type conformanceRoute struct {
+	Path        string `json:"path"`
+	File        string `json:"file"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Location    string `json:"location"`
+}
+
+// conformanceResult is the part of a result the implementations must agree on
+type conformanceResult struct {
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	Title  string `json:"title"`
+}
+
+func readConformanceJSON(t *testing.T, name string, v interface{}) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(conformanceDir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("parsing %s: %v", name, err)
+	}
+}
+
+// Serve the conformance corpus exactly as routes.json describes it
+func newConformanceServer(t *testing.T, routes []conformanceRoute) *httptest.Server {
+	mux := http.NewServeMux()
+	for _, route := range routes {
+		route := route
+		var body []byte
+		if route.File != "" {
+			var err error
+			if body, err = os.ReadFile(filepath.Join(conformanceDir, "corpus", route.File)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		mux.HandleFunc(route.Path, func(w http.ResponseWriter, r *http.Request) {
+			if route.Location != "" {
+				w.Header().Set("Location", route.Location)
+			}
+			if route.ContentType != "" {
+				w.Header().Set("Content-Type", route.ContentType)
+			}
+			w.WriteHeader(route.Status)
+			w.Write(body)
+		})
+	}
+	return httptest.NewServer(mux)
+}
+
+func TestConformance(t *testing.T) {
+	var routes []conformanceRoute
+	var expected []conformanceResult
+	readConformanceJSON(t, "routes.json", &routes)
+	readConformanceJSON(t, "expected.json", &expected)
+
+	server := newConformanceServer(t, routes)
+	defer server.Close()
+
+	urls := make([]string, len(expected))
+	for i, want := range expected {
+		urls[i] = server.URL + want.Path
+	}
+	client := newHTTPClient(timeoutConfig{total: 10 * time.Second})
+	results, _, err := crawlURLs(context.Background(), urls, 4, client, &fetchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]conformanceResult, len(results))
+	for _, result := range results {
+		path := strings.TrimPrefix(result.URL, server.URL)
+		got[path] = conformanceResult{Path: path, Status: result.Status, Title: result.Title}
+	}
+	for _, want := range expected {
+		if result, ok := got[want.Path]; !ok {
+			t.Errorf("%s: no result", want.Path)
+		} else if result != want {
+			t.Errorf("%s: got status %d title %q, want status %d title %q",
+				want.Path, result.Status, result.Title, want.Status, want.Title)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Set in the environment of the crawl process a -container supervisor runs.
+// It has no CRAWLER_ prefix, so applyEnv doesn't take it for a flag.
+const containerChildEnv = "CRAWLER_CONTAINER_CHILD"
+
+// Report whether this process is the crawl a -container supervisor started
+func isContainerChild() bool {
+	return os.Getenv(containerChildEnv) != ""
+}
+
+// LogLine is a line of -container output
+type LogLine struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"msg"`
+}
+
+// Level of a line the crawl printed: errors and warnings start with the word
+func logLevel(line string, stderr bool) string {
+	switch {
+	case stderr || strings.HasPrefix(line, "Error"):
+		return "error"
+	case strings.HasPrefix(line, "Warning"):
+		return "warn"
+	}
+	return "info"
+}
+
+// Run the crawl in a child process with the same arguments and log its
+// output as JSON lines on stdout. The crawl prints plain text and exits
+// from many places, so wrapping its output from outside is what catches
+// every line. SIGTERM and interrupts are passed on, so the crawl stops and
+// saves its results within the orchestrator's grace period.
+func superviseContainerCrawl() int {
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Printf("Error getting executable path: %s\n", err)
+		return exitError
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), containerChildEnv+"=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return exitError
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return exitError
+	}
+
+	// Catch signals before the child exists, so none is lost in between
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("Error starting crawl: %s\n", err)
+		return exitError
+	}
+	go func() {
+		for sig := range signals {
+			cmd.Process.Signal(sig)
+		}
+	}()
+
+	var mu sync.Mutex
+	encoder := json.NewEncoder(os.Stdout)
+	var wg sync.WaitGroup
+	logStream := func(r io.Reader, isStderr bool) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			mu.Lock()
+			encoder.Encode(LogLine{
+				Time:    time.Now().UTC().Format(time.RFC3339Nano),
+				Level:   logLevel(line, isStderr),
+				Message: line,
+			})
+			mu.Unlock()
+		}
+	}
+	wg.Add(2)
+	go logStream(stdout, false)
+	go logStream(stderr, true)
+	wg.Wait()
+
+	err = cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() >= 0 {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		encoder.Encode(LogLine{Time: time.Now().UTC().Format(time.RFC3339Nano), Level: "error", Message: "Crawl process failed: " + err.Error()})
+		return exitError
+	}
+	return exitOK
+}
+
+// Report whether an -input names a URL to download rather than a file
+func isRemoteInput(input string) bool {
+	return strings.HasPrefix(input, "https://") || strings.HasPrefix(input, "http://")
+}
+
+// Download input lists given as URLs into temporary files, keeping the
+// extension that picks the format. Returns the file list to load and the
+// URL each temporary file came from.
+func fetchRemoteInputs(client *http.Client, inputs []string) ([]string, map[string]string, error) {
+	files := make([]string, len(inputs))
+	sources := make(map[string]string)
+	for i, input := range inputs {
+		if !isRemoteInput(input) {
+			files[i] = input
+			continue
+		}
+		file, err := downloadInput(client, input)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", input, err)
+		}
+		files[i] = file
+		sources[file] = input
+	}
+	return files, sources, nil
+}
+
+// Download one input list into a temporary file
+func downloadInput(client *http.Client, input string) (string, error) {
+	u, err := url.Parse(input)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Get(input)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	file, err := os.CreateTemp("", "crawler-input-*"+path.Ext(u.Path))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), file.Close()
+}
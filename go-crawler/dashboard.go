@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Start serving the web dashboard for a crawl on addr. The listener is
+// opened before returning so address errors are reported up front.
+func startDashboard(addr string, progress *crawlProgress, events *eventHub, info BuildInfo) (*http.Server, net.Addr, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	health := &serverHealth{info: info}
+	health.watchSignals()
+	server := &http.Server{Handler: dashboardHandler(progress, events, health)}
+	go server.Serve(listener)
+	return server, listener.Addr(), nil
+}
+
+// serverHealth answers the orchestrator probes
+type serverHealth struct {
+	info     BuildInfo
+	stopping atomic.Bool // a shutdown signal arrived
+}
+
+// Stop reporting ready at the first interrupt or SIGTERM, so traffic moves
+// elsewhere while the crawl saves its results
+func (h *serverHealth) watchSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		h.stopping.Store(true)
+	}()
+}
+
+// Add the health probe and build info routes
+func (h *serverHealth) register(mux *http.ServeMux) {
+	// Liveness: the process is up and serving
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, HealthStatus{Status: "ok", UptimeSeconds: time.Since(h.info.StartedAt).Seconds()})
+	})
+	// Readiness: serving until asked to shut down
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		uptime := time.Since(h.info.StartedAt).Seconds()
+		if h.stopping.Load() {
+			writeJSON(w, http.StatusServiceUnavailable, HealthStatus{Status: "shutting down", UptimeSeconds: uptime})
+			return
+		}
+		writeJSON(w, http.StatusOK, HealthStatus{Status: "ready", UptimeSeconds: uptime})
+	})
+	mux.HandleFunc("/buildinfo", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, h.info)
+	})
+}
+
+// HealthStatus is the body of /healthz and /readyz
+type HealthStatus struct {
+	Status        string  `json:"status"`
+	UptimeSeconds float64 `json:"uptime_seconds"`
+}
+
+// Write a JSON response that is never cached
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Routes for the dashboard page, its JSON API and the health probes
+func dashboardHandler(progress *crawlProgress, events *eventHub, health *serverHealth) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(dashboardPage))
+	})
+	mux.HandleFunc("/api/progress", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, progress.snapshot(10))
+	})
+	mux.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
+		streamEvents(w, r, progress, events)
+	})
+
+	health.register(mux)
+	return mux
+}
+
+// Stream server-sent events: a "result" event per finished URL, a
+// "progress" snapshot every second, and a final "finished" event carrying
+// the crawl summary
+func streamEvents(w http.ResponseWriter, r *http.Request, progress *crawlProgress, events *eventHub) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	send := func(name string, v interface{}) {
+		data, err := json.Marshal(v)
+		if err == nil {
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+			flusher.Flush()
+		}
+	}
+
+	ch, unsubscribe := events.subscribe()
+	defer unsubscribe()
+	send("progress", progress.snapshot(10))
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			if event.name == "finished" {
+				send("progress", progress.snapshot(10))
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.name, event.data)
+			flusher.Flush()
+		case <-ticker.C:
+			send("progress", progress.snapshot(10))
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Single page dashboard fed by the /api/events stream
+const dashboardPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>go-crawler</title>
+<style>
+  body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+  h1 { font-size: 1.4em; }
+  h2 { font-size: 1.1em; margin-top: 1.5em; }
+  .stats { display: flex; gap: 1em; flex-wrap: wrap; }
+  .stat { background: #f3f4f6; border-radius: 6px; padding: 0.8em 1.2em; min-width: 8em; }
+  .stat b { display: block; font-size: 1.6em; }
+  table { border-collapse: collapse; width: 100%; font-size: 0.9em; }
+  td, th { text-align: left; padding: 0.3em 0.6em; border-bottom: 1px solid #e5e7eb; }
+  .failed { color: #b91c1c; }
+  .url { word-break: break-all; }
+</style>
+</head>
+<body>
+<h1>go-crawler <span id="state"></span></h1>
+<div class="stats">
+  <div class="stat"><b id="completed">-</b>completed</div>
+  <div class="stat"><b id="failed">-</b>failed</div>
+  <div class="stat"><b id="busy">-</b>workers busy</div>
+  <div class="stat"><b id="queued">-</b>queued</div>
+  <div class="stat"><b id="rps">-</b>requests/sec</div>
+  <div class="stat"><b id="elapsed">-</b>elapsed</div>
+</div>
+<h2>Errors</h2>
+<table><tbody id="errors"></tbody></table>
+<div id="tag-section" hidden>
+<h2>Tags</h2>
+<table><thead><tr><th>Tag</th><th>URLs</th><th>Success rate</th><th>Average</th><th>p95</th></tr></thead><tbody id="tags"></tbody></table>
+</div>
+<h2>Slowest domains</h2>
+<table><tbody id="domains"></tbody></table>
+<h2>Recent results</h2>
+<table><tbody id="results"></tbody></table>
+<script>
+function cell(text, cls) {
+  const td = document.createElement("td");
+  td.textContent = text;
+  if (cls) td.className = cls;
+  return td;
+}
+function fill(id, rows) {
+  const body = document.getElementById(id);
+  body.replaceChildren(...rows.map(cells => {
+    const tr = document.createElement("tr");
+    tr.append(...cells);
+    return tr;
+  }));
+}
+function render(p) {
+  document.getElementById("state").textContent = p.finished ? "(finished)" : "(running)";
+  document.getElementById("completed").textContent = p.completed;
+  document.getElementById("failed").textContent = p.failed;
+  document.getElementById("busy").textContent = p.busy + "/" + p.workers;
+  document.getElementById("queued").textContent = p.queued;
+  document.getElementById("rps").textContent = p.requests_per_second.toFixed(1);
+  document.getElementById("elapsed").textContent = Math.round(p.elapsed) + "s";
+  const errors = Object.entries(p.error_breakdown).sort((a, b) => b[1] - a[1]);
+  fill("errors", errors.map(([kind, count]) => [cell(kind), cell(count)]));
+  fill("domains", p.slow_domains.map(d => [cell(d.domain), cell(d.average_time.toFixed(3) + "s"), cell(d.urls + " URLs")]));
+  fill("results", p.recent_results.map(r => [
+    cell(r.status, r.failed ? "failed" : ""), cell(r.url, "url"), cell(r.title), cell(r.time_taken.toFixed(3) + "s")]));
+}
+function renderTags(summary) {
+  if (!summary.tags) return;
+  document.getElementById("tag-section").hidden = false;
+  fill("tags", summary.tags.map(t => [
+    cell("#" + t.tag), cell(t.urls), cell((t.success_rate * 100).toFixed(1) + "%", t.failed ? "failed" : ""),
+    cell(t.average_time.toFixed(3) + "s"), cell(t.p95_time.toFixed(3) + "s")]));
+}
+const events = new EventSource("api/events");
+events.addEventListener("progress", e => render(JSON.parse(e.data)));
+events.addEventListener("finished", e => { renderTags(JSON.parse(e.data)); events.close(); });
+</script>
+</body>
+</html>
+`
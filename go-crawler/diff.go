@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// TitleChange records a page whose title differs between two runs
+type TitleChange struct {
+	URL      string `json:"url"`
+	OldTitle string `json:"old_title"`
+	NewTitle string `json:"new_title"`
+}
+
+// StatusChange records a page whose HTTP status differs between two runs
+type StatusChange struct {
+	URL       string `json:"url"`
+	OldStatus int    `json:"old_status"`
+	NewStatus int    `json:"new_status"`
+}
+
+// LatencyChange records a page whose fetch time moved to another bucket of
+// the request duration histogram between two runs
+type LatencyChange struct {
+	URL       string  `json:"url"`
+	OldBucket string  `json:"old_bucket"`
+	NewBucket string  `json:"new_bucket"`
+	OldTime   float64 `json:"old_time"`
+	NewTime   float64 `json:"new_time"`
+}
+
+// RunDiff describes the changes between two crawl runs
+type RunDiff struct {
+	Added          []string        `json:"added"`
+	Removed        []string        `json:"removed"`
+	ContentChanged []string        `json:"content_changed"`
+	TitleChanges   []TitleChange   `json:"title_changes"`
+	StatusChanges  []StatusChange  `json:"status_changes"`
+	LatencyChanges []LatencyChange `json:"latency_changes"`
+}
+
+// Label the request duration bucket a fetch time falls in, e.g. "<=0.5s"
+func latencyBucket(seconds float64) string {
+	for _, bound := range requestDurationBuckets {
+		if seconds <= bound {
+			return "<=" + strconv.FormatFloat(bound, 'g', -1, 64) + "s"
+		}
+	}
+	last := requestDurationBuckets[len(requestDurationBuckets)-1]
+	return ">" + strconv.FormatFloat(last, 'g', -1, 64) + "s"
+}
+
+// Compare two sets of results and collect the differences, ordered by URL
+func diffResults(oldResults, newResults []Result) RunDiff {
+	diff := RunDiff{
+		Added:          []string{},
+		Removed:        []string{},
+		ContentChanged: []string{},
+		TitleChanges:   []TitleChange{},
+		StatusChanges:  []StatusChange{},
+		LatencyChanges: []LatencyChange{},
+	}
+
+	oldByURL := make(map[string]Result, len(oldResults))
+	for _, result := range oldResults {
+		oldByURL[result.URL] = result
+	}
+	newByURL := make(map[string]Result, len(newResults))
+	for _, result := range newResults {
+		newByURL[result.URL] = result
+	}
+
+	for urlStr, oldResult := range oldByURL {
+		newResult, ok := newByURL[urlStr]
+		if !ok {
+			diff.Removed = append(diff.Removed, urlStr)
+			continue
+		}
+
+		// Hashes taken with different -body-digest algorithms can't be compared
+		if oldResult.ContentHash != "" && newResult.ContentHash != "" && digestAlgorithm(oldResult.ContentHash) == digestAlgorithm(newResult.ContentHash) && oldResult.ContentHash != newResult.ContentHash {
+			diff.ContentChanged = append(diff.ContentChanged, urlStr)
+		}
+		if oldResult.Title != newResult.Title {
+			diff.TitleChanges = append(diff.TitleChanges, TitleChange{URL: urlStr, OldTitle: oldResult.Title, NewTitle: newResult.Title})
+		}
+		// A 304 only confirms the old status is still current
+		if oldResult.Status != newResult.Status && !newResult.Unchanged {
+			diff.StatusChanges = append(diff.StatusChanges, StatusChange{URL: urlStr, OldStatus: oldResult.Status, NewStatus: newResult.Status})
+		}
+		// Latency is only comparable between two responses
+		if oldResult.SkipReason == "" && newResult.SkipReason == "" && oldResult.Status > 0 && newResult.Status > 0 {
+			oldBucket, newBucket := latencyBucket(oldResult.TimeTaken), latencyBucket(newResult.TimeTaken)
+			if oldBucket != newBucket {
+				diff.LatencyChanges = append(diff.LatencyChanges, LatencyChange{
+					URL: urlStr, OldBucket: oldBucket, NewBucket: newBucket, OldTime: oldResult.TimeTaken, NewTime: newResult.TimeTaken,
+				})
+			}
+		}
+	}
+	for urlStr := range newByURL {
+		if _, ok := oldByURL[urlStr]; !ok {
+			diff.Added = append(diff.Added, urlStr)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.ContentChanged)
+	sort.Slice(diff.TitleChanges, func(i, j int) bool { return diff.TitleChanges[i].URL < diff.TitleChanges[j].URL })
+	sort.Slice(diff.StatusChanges, func(i, j int) bool { return diff.StatusChanges[i].URL < diff.StatusChanges[j].URL })
+	sort.Slice(diff.LatencyChanges, func(i, j int) bool { return diff.LatencyChanges[i].URL < diff.LatencyChanges[j].URL })
+
+	return diff
+}
+
+// Print a human readable diff report
+func printDiff(diff RunDiff) {
+	fmt.Printf("Added URLs: %d\n", len(diff.Added))
+	for _, urlStr := range diff.Added {
+		fmt.Printf("  + %s\n", urlStr)
+	}
+
+	fmt.Printf("Removed URLs: %d\n", len(diff.Removed))
+	for _, urlStr := range diff.Removed {
+		fmt.Printf("  - %s\n", urlStr)
+	}
+
+	fmt.Printf("Content changed: %d\n", len(diff.ContentChanged))
+	for _, urlStr := range diff.ContentChanged {
+		fmt.Printf("  ~ %s\n", urlStr)
+	}
+
+	fmt.Printf("Title changes: %d\n", len(diff.TitleChanges))
+	for _, change := range diff.TitleChanges {
+		fmt.Printf("  %s\n    %q -> %q\n", change.URL, change.OldTitle, change.NewTitle)
+	}
+
+	fmt.Printf("Status transitions: %d\n", len(diff.StatusChanges))
+	for _, change := range diff.StatusChanges {
+		fmt.Printf("  %s: %d -> %d\n", change.URL, change.OldStatus, change.NewStatus)
+	}
+
+	fmt.Printf("Latency bucket changes: %d\n", len(diff.LatencyChanges))
+	for _, change := range diff.LatencyChanges {
+		fmt.Printf("  %s: %s -> %s (%.3fs -> %.3fs)\n", change.URL, change.OldBucket, change.NewBucket, change.OldTime, change.NewTime)
+	}
+}
+
+// Run the results-diff (or diff) subcommand and return the process exit code
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("results-diff", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print the diff as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: crawler results-diff [-json] old_results.json new_results.json\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return exitConfig
+	}
+
+	oldResults, err := loadResults(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Error loading %s: %s\n", fs.Arg(0), err)
+		return exitError
+	}
+	newResults, err := loadResults(fs.Arg(1))
+	if err != nil {
+		fmt.Printf("Error loading %s: %s\n", fs.Arg(1), err)
+		return exitError
+	}
+
+	diff := diffResults(oldResults.Results, newResults.Results)
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(diff); err != nil {
+			fmt.Printf("Error encoding diff: %s\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+
+	printDiff(diff)
+	return exitOK
+}
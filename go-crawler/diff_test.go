@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Each URL in testdata/diff is named for the change it shows
+func TestDiffResults(t *testing.T) {
+	oldResults, err := loadResults(filepath.Join("testdata", "diff", "old.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newResults, err := loadResults(filepath.Join("testdata", "diff", "new.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const site = "https://a.example"
+
+	want := RunDiff{
+		Added:          []string{site + "/added"},
+		Removed:        []string{site + "/gone"},
+		ContentChanged: []string{site + "/edited"},
+		TitleChanges: []TitleChange{
+			{URL: site + "/broken", OldTitle: "Broken", NewTitle: ""},
+			{URL: site + "/edited", OldTitle: "Old title", NewTitle: "New title"},
+		},
+		// /cached answered 304, which confirms its old status
+		StatusChanges:  []StatusChange{{URL: site + "/broken", OldStatus: 200, NewStatus: 503}},
+		LatencyChanges: []LatencyChange{{URL: site + "/slow", OldBucket: "<=0.1s", NewBucket: "<=5s", OldTime: 0.08, NewTime: 3}},
+	}
+	if got := diffResults(oldResults.Results, newResults.Results); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+
+	if got := diffResults(oldResults.Results, oldResults.Results); len(got.Added)+len(got.Removed)+len(got.ContentChanged)+len(got.TitleChanges)+len(got.StatusChanges)+len(got.LatencyChanges) != 0 {
+		t.Errorf("a run differs from itself: %+v", got)
+	}
+}
+
+func TestDiffCommand(t *testing.T) {
+	out, code := runCrawler(t, "diff", "-json", filepath.Join("testdata", "diff", "old.json"), filepath.Join("testdata", "diff", "new.json"))
+	if code != exitOK {
+		t.Fatalf("diff exited with %d:\n%s", code, out)
+	}
+	var diff RunDiff
+	if err := json.Unmarshal([]byte(out), &diff); err != nil {
+		t.Fatalf("%v in:\n%s", err, out)
+	}
+	if len(diff.Added) != 1 || len(diff.Removed) != 1 || len(diff.StatusChanges) != 1 {
+		t.Errorf("got %+v", diff)
+	}
+
+	if _, code := runCrawler(t, "diff", filepath.Join("testdata", "diff", "old.json")); code != exitConfig {
+		t.Errorf("one file exited with %d, want %d", code, exitConfig)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc64"
+	"strings"
+)
+
+// Content hash algorithms for -body-digest. CRC-64 is cheap enough to run on
+// every body; SHA-256 costs more but is collision resistant.
+const (
+	digestCRC64  = "crc64"
+	digestSHA256 = "sha256"
+)
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// Check a -body-digest value
+func checkDigestAlgorithm(algorithm string) error {
+	if algorithm != digestCRC64 && algorithm != digestSHA256 {
+		return fmt.Errorf("unknown body digest %q (use %s or %s)", algorithm, digestCRC64, digestSHA256)
+	}
+	return nil
+}
+
+// Start a digest of a body as it is read
+func newBodyDigest(algorithm string) hash.Hash {
+	if algorithm == digestSHA256 {
+		return sha256.New()
+	}
+	return crc64.New(crc64Table)
+}
+
+// The algorithm of a formatted digest, "" for a content hash written before
+// content hashes named theirs
+func digestAlgorithm(digest string) string {
+	algorithm, _, found := strings.Cut(digest, ":")
+	if !found {
+		return ""
+	}
+	return algorithm
+}
+
+// Format a finished digest with its algorithm, e.g. "crc64:0123456789abcdef",
+// so digests from runs with different algorithms never compare equal
+func formatBodyDigest(algorithm string, digest hash.Hash) string {
+	if algorithm != digestSHA256 {
+		algorithm = digestCRC64
+	}
+	return algorithm + ":" + hex.EncodeToString(digest.Sum(nil))
+}
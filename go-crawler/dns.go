@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DomainDNS aggregates DNS lookup times for one domain
+type DomainDNS struct {
+	Lookups   int     `json:"lookups"`
+	TotalMs   float64 `json:"total_ms"`
+	AverageMs float64 `json:"average_ms"`
+	MaxMs     float64 `json:"max_ms"`
+}
+
+// DNSStats aggregates DNS lookup times across a crawl
+type DNSStats struct {
+	Lookups   int                   `json:"lookups"`
+	AverageMs float64               `json:"average_ms"`
+	Domains   map[string]*DomainDNS `json:"domains"`
+}
+
+// Aggregate DNS lookup times per domain. Requests on reused connections do no
+// lookup and are left out. Returns nil when no lookups were made.
+func summarizeDNS(results []Result) *DNSStats {
+	stats := &DNSStats{Domains: make(map[string]*DomainDNS)}
+	totalMs := 0.0
+	for _, result := range results {
+		if result.DNSMs <= 0 {
+			continue
+		}
+		domain := stats.Domains[result.Domain]
+		if domain == nil {
+			domain = &DomainDNS{}
+			stats.Domains[result.Domain] = domain
+		}
+		domain.Lookups++
+		domain.TotalMs += result.DNSMs
+		if result.DNSMs > domain.MaxMs {
+			domain.MaxMs = result.DNSMs
+		}
+		stats.Lookups++
+		totalMs += result.DNSMs
+	}
+	if stats.Lookups == 0 {
+		return nil
+	}
+
+	for _, domain := range stats.Domains {
+		domain.AverageMs = domain.TotalMs / float64(domain.Lookups)
+	}
+	stats.AverageMs = totalMs / float64(stats.Lookups)
+	return stats
+}
+
+// Domains with the slowest average lookups first
+func slowestDNSDomains(stats *DNSStats, count int) []string {
+	domains := make([]string, 0, len(stats.Domains))
+	for domain := range stats.Domains {
+		domains = append(domains, domain)
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		a, b := stats.Domains[domains[i]], stats.Domains[domains[j]]
+		if a.AverageMs != b.AverageMs {
+			return a.AverageMs > b.AverageMs
+		}
+		return domains[i] < domains[j]
+	})
+	if len(domains) > count {
+		domains = domains[:count]
+	}
+	return domains
+}
+
+// How long a single pre-resolution lookup may take
+const preResolveTimeout = 10 * time.Second
+
+// dnsCache holds addresses resolved before the crawl so fetches skip the
+// lookup. Hosts that failed to resolve keep their error.
+type dnsCache struct {
+	addrs      map[string][]string
+	unresolved map[string]string
+}
+
+// UnresolvedHost is a host the pre-resolution pass could not resolve
+type UnresolvedHost struct {
+	Host  string `json:"host"`
+	Error string `json:"error"`
+}
+
+// PreResolveStats reports the DNS pre-resolution pass
+type PreResolveStats struct {
+	Hosts      int              `json:"hosts"`
+	Resolved   int              `json:"resolved"`
+	Unresolved []UnresolvedHost `json:"unresolved"`
+	Seconds    float64          `json:"seconds"`
+}
+
+// Resolve the hostnames of urls concurrently. IP literals are left out.
+func preResolve(urls []string, concurrency int) (*dnsCache, PreResolveStats) {
+	start := time.Now()
+	hosts := make(map[string]bool)
+	for _, rawURL := range urls {
+		parsed, err := url.Parse(rawURL)
+		if err != nil || parsed.Hostname() == "" || net.ParseIP(parsed.Hostname()) != nil {
+			continue
+		}
+		hosts[parsed.Hostname()] = true
+	}
+
+	cache := &dnsCache{addrs: make(map[string][]string), unresolved: make(map[string]string)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, concurrency)
+	for host := range hosts {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(host string) {
+			defer wg.Done()
+			defer func() { <-limit }()
+			ctx, cancel := context.WithTimeout(context.Background(), preResolveTimeout)
+			defer cancel()
+			addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				cache.unresolved[host] = err.Error()
+			} else {
+				cache.addrs[host] = addrs
+			}
+		}(host)
+	}
+	wg.Wait()
+
+	stats := PreResolveStats{
+		Hosts:      len(hosts),
+		Resolved:   len(cache.addrs),
+		Unresolved: []UnresolvedHost{},
+		Seconds:    time.Since(start).Seconds(),
+	}
+	for host, err := range cache.unresolved {
+		stats.Unresolved = append(stats.Unresolved, UnresolvedHost{host, err})
+	}
+	sort.Slice(stats.Unresolved, func(i, j int) bool {
+		return stats.Unresolved[i].Host < stats.Unresolved[j].Host
+	})
+	return cache, stats
+}
+
+// Return the lookup error for a host that failed to resolve, or ""
+func (c *dnsCache) unresolvedError(host string) string {
+	return c.unresolved[host]
+}
+
+// Wrap a dial function to connect to pre-resolved addresses, trying each in
+// turn. Hosts that were not pre-resolved are dialed as usual.
+func (c *dnsCache) wrapDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return dial(ctx, network, addr)
+		}
+		addrs, ok := c.addrs[host]
+		if !ok {
+			return dial(ctx, network, addr)
+		}
+		var lastErr error
+		for _, ip := range addrs {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variable holding an Elasticsearch API key, sent instead of
+// the URL's user and password
+const elasticsearchAPIKeyEnv = envPrefix + "ES_API_KEY"
+
+// Characters Elasticsearch and OpenSearch don't allow in index names
+const elasticsearchIndexForbidden = `\/*?"<>| ,#:`
+
+// elasticsearchTarget is an index given as es://user:password@host:9200/index,
+// or ess:// for HTTPS
+type elasticsearchTarget struct {
+	bulkURL  string
+	index    string
+	user     string
+	password string
+}
+
+func parseElasticsearchURL(rawURL string) (elasticsearchTarget, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return elasticsearchTarget{}, err
+	}
+	scheme := "http"
+	if parsedURL.Scheme == "ess" {
+		scheme = "https"
+	}
+	host := parsedURL.Host
+	if parsedURL.Port() == "" {
+		host += ":9200"
+	}
+	index := strings.Trim(parsedURL.Path, "/")
+	if index == "" || index != strings.ToLower(index) || strings.ContainsAny(index, elasticsearchIndexForbidden) || strings.HasPrefix(index, "_") {
+		return elasticsearchTarget{}, fmt.Errorf("-sink %s: the path must be an index name: lowercase, without spaces or any of %s, not starting with _", parsedURL.Redacted(), elasticsearchIndexForbidden)
+	}
+	target := elasticsearchTarget{bulkURL: scheme + "://" + host + "/_bulk", index: index}
+	if user := parsedURL.User; user != nil {
+		target.user = user.Username()
+		target.password, _ = user.Password()
+	}
+	return target, nil
+}
+
+// elasticsearchSink bulk-indexes results into an Elasticsearch or OpenSearch
+// index in batches, retrying with exponential backoff while the cluster is
+// unavailable or pushing back
+type elasticsearchSink struct {
+	target elasticsearchTarget
+	apiKey string
+	runID  string
+	client *http.Client
+	*batchSink
+
+	mu             sync.Mutex
+	indexed        int
+	rejected       int
+	firstRejection string // why the first rejected document was refused
+}
+
+// Start indexing into the index an es:// URL names. Nothing is sent until
+// the first result, so a cluster that can't be reached stops the crawl then.
+func openElasticsearchSink(rawURL string, config sinkConfig) (ResultSink, error) {
+	target, err := parseElasticsearchURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	s := &elasticsearchSink{
+		target: target,
+		apiKey: os.Getenv(elasticsearchAPIKeyEnv),
+		runID:  config.runID,
+		client: &http.Client{Timeout: time.Minute},
+	}
+	s.batchSink = newBatchSink(config, s.bulk)
+	return s, nil
+}
+
+// elasticsearchDoc is the document indexed for a result: the result's
+// fields, plus the run and a timestamp for Kibana's time filter
+type elasticsearchDoc struct {
+	Result
+	RunID     string `json:"run_id"`
+	Timestamp string `json:"@timestamp"`
+}
+
+func (s *elasticsearchSink) Write(result Result) error {
+	timestamp := result.StartedAt
+	if timestamp == "" {
+		timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	doc, err := json.Marshal(elasticsearchDoc{Result: result, RunID: s.runID, Timestamp: timestamp})
+	if err != nil {
+		return err
+	}
+	s.add(result, sinkItem{id: sinkDocumentID(s.runID, result.URL), doc: doc})
+	return nil
+}
+
+// Send one bulk request, returning the documents to try again and, when the
+// whole request failed, whether it is worth retrying
+func (s *elasticsearchSink) bulk(batch []sinkItem) ([]sinkItem, bool, error) {
+	var body bytes.Buffer
+	for _, item := range batch {
+		action, _ := json.Marshal(map[string]interface{}{"index": map[string]string{"_index": s.target.index, "_id": item.id}})
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(item.doc)
+		body.WriteByte('\n')
+	}
+	req, err := http.NewRequest(http.MethodPost, s.target.bulkURL, &body)
+	if err != nil {
+		return batch, false, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+s.apiKey)
+	} else if s.target.user != "" {
+		req.SetBasicAuth(s.target.user, s.target.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return batch, true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return batch, true, fmt.Errorf("%s: %s", s.target.bulkURL, resp.Status)
+	}
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return batch, false, fmt.Errorf("%s: %s: %s", s.target.bulkURL, resp.Status, bytes.TrimSpace(message))
+	}
+	var response struct {
+		Items []map[string]struct {
+			Status int `json:"status"`
+			Error  *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return batch, true, fmt.Errorf("%s: %w", s.target.bulkURL, err)
+	}
+	if len(response.Items) != len(batch) {
+		return batch, true, fmt.Errorf("%s: %d items in the response to %d documents", s.target.bulkURL, len(response.Items), len(batch))
+	}
+	var again []sinkItem
+	for i, item := range batch {
+		result := response.Items[i]["index"]
+		switch {
+		case result.Status == http.StatusTooManyRequests || result.Status >= 500:
+			again = append(again, item)
+		case result.Status >= 300:
+			// A document the index will never take, e.g. for a mapping
+			// conflict, is counted and given up on
+			s.mu.Lock()
+			s.rejected++
+			if s.firstRejection == "" && result.Error != nil {
+				s.firstRejection = result.Error.Type + ": " + result.Error.Reason
+			}
+			s.mu.Unlock()
+			item.done()
+		default:
+			s.mu.Lock()
+			s.indexed++
+			s.mu.Unlock()
+			item.done()
+		}
+	}
+	return again, false, nil
+}
+
+func (s *elasticsearchSink) Close() error {
+	if err := s.close(); err != nil {
+		return fmt.Errorf("index %s: %w", s.target.index, err)
+	}
+	return nil
+}
+
+func (s *elasticsearchSink) report() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	text := fmt.Sprintf("%d results indexed in %s", s.indexed, s.target.index)
+	if s.rejected > 0 {
+		text += fmt.Sprintf(", %d refused by the index (%s)", s.rejected, s.firstRejection)
+	}
+	return text
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Events buffered per subscriber before new ones are dropped for it
+const eventBuffer = 256
+
+// crawlEvent is a named event with a JSON payload
+type crawlEvent struct {
+	name string
+	data []byte
+}
+
+// eventHub fans crawl events out to live subscribers. Slow subscribers miss
+// events rather than holding up the crawl.
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan crawlEvent]struct{}
+	final       *crawlEvent // set once the crawl has finished
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[chan crawlEvent]struct{})}
+}
+
+// Subscribe to events. The channel is closed once the crawl finishes, after
+// the "finished" event, or right away if it already has.
+func (h *eventHub) subscribe() (<-chan crawlEvent, func()) {
+	ch := make(chan crawlEvent, eventBuffer)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.final != nil {
+		ch <- *h.final
+		close(ch)
+		return ch, func() {}
+	}
+	h.subscribers[ch] = struct{}{}
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Send an event to every subscriber
+func (h *eventHub) publish(name string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- crawlEvent{name, data}:
+		default:
+		}
+	}
+}
+
+// Publish the "finished" event with the crawl summary and end every stream
+func (h *eventHub) finish(summary Summary) {
+	data, _ := json.Marshal(summary)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.final = &crawlEvent{"finished", data}
+	for ch := range h.subscribers {
+		select {
+		case ch <- *h.final:
+		default:
+		}
+		close(ch)
+		delete(h.subscribers, ch)
+	}
+}
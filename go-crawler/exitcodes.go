@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"os"
+)
+
+// Exit codes of a crawl run
+const (
+	exitOK       = 0 // every check passed
+	exitError    = 1 // the crawler itself failed, e.g. results could not be saved
+	exitFailures = 2 // the failure rate exceeded -failure-threshold, or -fail-fast-rate aborted the crawl
+	exitPartial  = 3 // the crawl was cut short by -deadline or an interrupt
+	exitConfig   = 4 // invalid flags, config or input files
+)
+
+// Pick the exit code for a finished crawl. Partial results take precedence
+// over failures since their failure rate is incomplete, unless the crawl was
+// aborted because of failures.
+func crawlExitCode(summary Summary, failureThreshold float64) int {
+	if summary.Aborted != "" {
+		return exitFailures
+	}
+	if summary.Truncated {
+		return exitPartial
+	}
+	fetched := summary.SuccessfulFetches + summary.FailedFetches
+	if fetched > 0 && float64(summary.FailedFetches)/float64(fetched) > failureThreshold {
+		return exitFailures
+	}
+	return exitOK
+}
+
+// Parse the crawl flags, exiting with exitConfig on errors rather than the
+// flag package's default of 2, which is reserved for failed crawls
+func parseFlags(fs *flag.FlagSet, args []string) {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(exitOK)
+		}
+		os.Exit(exitConfig)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// failFast aborts a crawl once the error rate over the most recent fetches
+// exceeds a threshold, e.g. when a proxy or the network is down
+type failFast struct {
+	mu        sync.Mutex
+	threshold float64
+	window    []bool // ring of recent outcomes, true for failures
+	next      int
+	filled    int
+	failures  int
+	cancel    context.CancelFunc
+	reason    string
+}
+
+func newFailFast(threshold float64, window int, cancel context.CancelFunc) *failFast {
+	return &failFast{threshold: threshold, window: make([]bool, window), cancel: cancel}
+}
+
+// Record a finished URL and abort the crawl if the rolling error rate is
+// too high. The rate is only judged once the window is full.
+func (f *failFast) record(result Result) {
+	if result.SkipReason != "" {
+		return
+	}
+	failed := !resultSucceeded(result)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.reason != "" {
+		return
+	}
+
+	if f.filled == len(f.window) {
+		if f.window[f.next] {
+			f.failures--
+		}
+	} else {
+		f.filled++
+	}
+	f.window[f.next] = failed
+	if failed {
+		f.failures++
+	}
+	f.next = (f.next + 1) % len(f.window)
+
+	if f.filled < len(f.window) {
+		return
+	}
+	if rate := float64(f.failures) / float64(f.filled); rate > f.threshold {
+		f.reason = fmt.Sprintf("error rate %.2f over the last %d URLs exceeded -fail-fast-rate %.2f", rate, f.filled, f.threshold)
+		f.cancel()
+	}
+}
+
+// Why the crawl was aborted, or "" if it was not
+func (f *failFast) abortReason() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reason
+}
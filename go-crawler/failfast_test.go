@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A bad -fail-fast-window is refused before the results and failures files
+// are created, so the files of an earlier run survive the typo
+func TestFailFastWindowCheckedFirst(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "out.json")
+	failures := filepath.Join(dir, "ff.txt")
+	for _, path := range []string{output, failures} {
+		if err := os.WriteFile(path, []byte("earlier run\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out, code := runCrawler(t, "-input", writeInput(t, "urls.txt", "https://a.example/\n"), "-output", output, "-stream",
+		"-failures-file", failures, "-fail-fast-rate", "0.5", "-fail-fast-window", "0")
+	if code != exitConfig || !strings.Contains(out, "-fail-fast-window must be at least 1") {
+		t.Fatalf("got exit code %d, want %d, with output:\n%s", code, exitConfig, out)
+	}
+	for _, path := range []string{output, failures} {
+		if data, err := os.ReadFile(path); err != nil || string(data) != "earlier run\n" {
+			t.Errorf("%s: got %q, %v", filepath.Base(path), data, err)
+		}
+	}
+}
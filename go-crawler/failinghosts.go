@@ -0,0 +1,65 @@
+package main
+
+import "sort"
+
+// FailingHost is a host worth removing from URL lists: its circuit opened,
+// or every URL fetched from it failed
+type FailingHost struct {
+	Domain         string         `json:"domain"`
+	Fetched        int            `json:"fetched"`
+	Failed         int            `json:"failed"`
+	CircuitOpened  int            `json:"circuit_opened,omitempty"`
+	CircuitSkipped int            `json:"circuit_skipped,omitempty"`
+	Reasons        map[string]int `json:"reasons"` // failures by error kind
+}
+
+// List failing hosts, most failures first. opened holds the hosts the
+// circuit breaker opened, if one was used.
+func summarizeFailingHosts(results []Result, opened map[string]hostCircuit) []FailingHost {
+	hosts := make(map[string]*FailingHost)
+	for _, result := range results {
+		if result.SkipReason != "" {
+			continue
+		}
+		host := hosts[result.Domain]
+		if host == nil {
+			host = &FailingHost{Domain: result.Domain, Reasons: make(map[string]int)}
+			hosts[result.Domain] = host
+		}
+		host.Fetched++
+		if !resultSucceeded(result) {
+			host.Failed++
+			host.Reasons[errorKind(result)]++
+		}
+	}
+
+	failing := []FailingHost{}
+	for domain, host := range hosts {
+		circuit, broken := opened[domain]
+		if !broken && host.Failed < host.Fetched {
+			continue
+		}
+		host.CircuitOpened = circuit.opened
+		host.CircuitSkipped = circuit.skipped
+		failing = append(failing, *host)
+	}
+	sort.Slice(failing, func(i, j int) bool {
+		a, b := failing[i], failing[j]
+		if a.Failed+a.CircuitSkipped != b.Failed+b.CircuitSkipped {
+			return a.Failed+a.CircuitSkipped > b.Failed+b.CircuitSkipped
+		}
+		return a.Domain < b.Domain
+	})
+	return failing
+}
+
+// Most common failure reason for a host
+func topReason(reasons map[string]int) string {
+	top := ""
+	for reason, count := range reasons {
+		if top == "" || count > reasons[top] || (count == reasons[top] && reason < top) {
+			top = reason
+		}
+	}
+	return top
+}
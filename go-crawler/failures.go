@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// failuresFile writes the URLs of failed fetches as they complete, in the
+// input format its extension names (plain text, CSV or JSON lines), so it
+// can be fed straight back in as a retry list
+type failuresFile struct {
+	file    *os.File
+	w       *bufio.Writer
+	csv     *csv.Writer   // set for .csv files
+	json    *json.Encoder // set for .jsonl files
+	columns []string      // metadata columns of a CSV file
+	tags    bool          // a CSV file has a tags column
+	inputs  map[string]*urlEntry
+	count   int
+}
+
+// Create the failures file. Entries with extra input data keep it in CSV and
+// JSON lines files; a CSV header lists every metadata column in the input.
+// Plain text files keep tags only.
+func createFailuresFile(filePath string, inputs map[string]*urlEntry) (*failuresFile, error) {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return nil, err
+	}
+	f := &failuresFile{file: file, w: bufio.NewWriter(file), inputs: inputs}
+
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".csv":
+		seen := make(map[string]bool)
+		for _, entry := range inputs {
+			f.tags = f.tags || entry.Tags != nil
+			for column := range entry.Metadata {
+				if !seen[column] {
+					seen[column] = true
+					f.columns = append(f.columns, column)
+				}
+			}
+		}
+		sort.Strings(f.columns)
+		f.csv = csv.NewWriter(f.w)
+		header := append([]string{"url"}, f.columns...)
+		if f.tags {
+			header = append(header, "tags")
+		}
+		if err := f.csv.Write(header); err != nil {
+			file.Close()
+			return nil, err
+		}
+	case ".jsonl", ".ndjson":
+		f.json = json.NewEncoder(f.w)
+		f.json.SetEscapeHTML(false)
+	}
+	return f, nil
+}
+
+// Write the result's URL if its fetch failed. Skipped URLs were never
+// fetched and are left out.
+func (f *failuresFile) add(result Result) error {
+	if result.SkipReason != "" || resultSucceeded(result) {
+		return nil
+	}
+	f.count++
+
+	entry := f.inputs[result.URL]
+	if entry == nil {
+		entry = &urlEntry{URL: result.URL}
+	}
+	switch {
+	case f.csv != nil:
+		record := []string{result.URL}
+		for _, column := range f.columns {
+			record = append(record, entry.Metadata[column])
+		}
+		if f.tags {
+			record = append(record, strings.Join(entry.Tags, " "))
+		}
+		return f.csv.Write(record)
+	case f.json != nil:
+		return f.json.Encode(entry)
+	}
+	line := result.URL
+	for _, tag := range entry.Tags {
+		line += " #" + tag
+	}
+	_, err := f.w.WriteString(line + "\n")
+	return err
+}
+
+// Flush and close the file
+func (f *failuresFile) Close() error {
+	defer f.file.Close()
+	if f.csv != nil {
+		f.csv.Flush()
+		if err := f.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if err := f.w.Flush(); err != nil {
+		return err
+	}
+	return f.file.Close()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resultFilter selects the results written to the results file. The summary
+// still covers every result; only the results list is slimmed down.
+type resultFilter struct {
+	onlyFailures bool
+	statuses     map[int]bool
+	minTime      time.Duration
+	tags         map[string]bool
+	dropped      int // results left out so far
+}
+
+// Build a filter from -only-failures, -only-status, -min-time and -only-tag.
+// Statuses are a comma separated list such as "404,500"; -1 selects request
+// errors. A result passes the tag filter when it has any of the tags.
+func newResultFilter(onlyFailures bool, statuses string, minTime time.Duration, tags string) (*resultFilter, error) {
+	f := &resultFilter{onlyFailures: onlyFailures, minTime: minTime}
+	if minTime < 0 {
+		return nil, fmt.Errorf("-min-time must not be negative")
+	}
+	for _, value := range strings.Split(statuses, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		status, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status %q in -only-status", value)
+		}
+		if f.statuses == nil {
+			f.statuses = make(map[int]bool)
+		}
+		f.statuses[status] = true
+	}
+	for _, tag := range parseTags(tags) {
+		if f.tags == nil {
+			f.tags = make(map[string]bool)
+		}
+		f.tags[tag] = true
+	}
+	return f, nil
+}
+
+// Report whether a result passes every filter that is set
+func (f *resultFilter) keep(result Result) bool {
+	if f.onlyFailures && (result.SkipReason != "" || resultSucceeded(result)) {
+		return false
+	}
+	if f.statuses != nil && !f.statuses[result.Status] {
+		return false
+	}
+	if f.minTime > 0 && result.TimeTaken < f.minTime.Seconds() {
+		return false
+	}
+	if f.tags != nil && !hasAnyTag(result, f.tags) {
+		return false
+	}
+	return true
+}
+
+// Return the results that pass, counting the rest as dropped
+func (f *resultFilter) apply(results []Result) []Result {
+	kept := results[:0:0]
+	for _, result := range results {
+		if f.keep(result) {
+			kept = append(kept, result)
+		} else {
+			f.dropped++
+		}
+	}
+	return kept
+}
@@ -0,0 +1,84 @@
+package main
+
+import "errors"
+
+var errUnsupportedScheme = errors.New("unsupported URL scheme")
+
+// crawlJob is a URL waiting in the frontier together with its link depth
+type crawlJob struct {
+	URL   string `json:"url"`
+	Depth int    `json:"depth"`
+}
+
+// Frontier holds the URLs still to be crawled and the set of URLs already
+// seen. Implementations are used from a single dispatcher goroutine.
+type Frontier interface {
+	// Push enqueues a job unless its URL has been seen before
+	Push(job crawlJob) (bool, error)
+	// Pop removes the next job; ok is false once the frontier is empty
+	Pop() (job crawlJob, ok bool, err error)
+	// Requeue puts a popped job back at the end of the queue, for a URL that
+	// is already in the visited set but still has to be fetched
+	Requeue(job crawlJob) error
+	// Len returns the number of queued jobs
+	Len() int
+	// Stats describes the visited set
+	Stats() VisitedSetStats
+	// Close releases any resources held by the frontier
+	Close() error
+}
+
+// memoryFrontier keeps the queue and visited set in memory
+type memoryFrontier struct {
+	queue   []crawlJob
+	head    int
+	visited visitedSet
+}
+
+func newMemoryFrontier(visited visitedSet) *memoryFrontier {
+	return &memoryFrontier{visited: visited}
+}
+
+func (f *memoryFrontier) Push(job crawlJob) (bool, error) {
+	added, err := f.visited.Add(job.URL)
+	if err != nil || !added {
+		return false, err
+	}
+	f.queue = append(f.queue, job)
+	return true, nil
+}
+
+func (f *memoryFrontier) Pop() (crawlJob, bool, error) {
+	if f.head == len(f.queue) {
+		return crawlJob{}, false, nil
+	}
+
+	job := f.queue[f.head]
+	f.queue[f.head] = crawlJob{}
+	f.head++
+
+	// Reclaim the consumed prefix once it dominates the slice
+	if f.head > 1024 && f.head*2 > len(f.queue) {
+		f.queue = append([]crawlJob(nil), f.queue[f.head:]...)
+		f.head = 0
+	}
+
+	return job, true, nil
+}
+
+func (f *memoryFrontier) Requeue(job crawlJob) error {
+	f.queue = append(f.queue, job)
+	return nil
+}
+
+func (f *memoryFrontier) Len() int {
+	return len(f.queue) - f.head
+}
+
+func (f *memoryFrontier) Stats() VisitedSetStats {
+	return f.visited.Stats()
+}
+
+func (f *memoryFrontier) Close() error {
+	return nil
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Number of recent pops replayed after a restart, so jobs that were in
+	// flight when the process died are not lost
+	frontierReplayWindow = 1024
+	// Pops between persisting the read offset
+	frontierCheckpointInterval = 256
+)
+
+// diskFrontier keeps the queue as an append-only JSON lines file and the
+// visited set as an on-disk hash table, so memory use does not grow with the
+// size of the crawl. State in the directory survives restarts.
+type diskFrontier struct {
+	offsetPath string
+	writer     *os.File
+	reader     *os.File
+	buffered   *bufio.Reader
+	readOffset int64
+	popOffsets []int64
+	queued     int
+	sincePoint int
+	visited    *diskSet
+}
+
+// Open (or resume) a disk frontier stored in dir
+func openDiskFrontier(dir string) (*diskFrontier, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	visited, err := openDiskSet(filepath.Join(dir, "visited.set"))
+	if err != nil {
+		return nil, err
+	}
+
+	f := &diskFrontier{
+		offsetPath: filepath.Join(dir, "queue.offset"),
+		visited:    visited,
+	}
+
+	if data, err := os.ReadFile(f.offsetPath); err == nil {
+		f.readOffset, err = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			visited.Close()
+			return nil, fmt.Errorf("corrupt frontier offset: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		visited.Close()
+		return nil, err
+	}
+
+	queuePath := filepath.Join(dir, "queue.jsonl")
+	f.writer, err = os.OpenFile(queuePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		visited.Close()
+		return nil, err
+	}
+	f.reader, err = os.Open(queuePath)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.recoverQueue(queuePath); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Count the pending jobs after the read offset and drop a partially written
+// trailing line left behind by a crash
+func (f *diskFrontier) recoverQueue(queuePath string) error {
+	if _, err := f.reader.Seek(f.readOffset, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(f.reader)
+	offset := f.readOffset
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				if err := os.Truncate(queuePath, offset); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(len(line))
+		f.queued++
+	}
+
+	if _, err := f.reader.Seek(f.readOffset, io.SeekStart); err != nil {
+		return err
+	}
+	f.buffered = bufio.NewReader(f.reader)
+	return nil
+}
+
+func (f *diskFrontier) Push(job crawlJob) (bool, error) {
+	added, err := f.visited.Add(job.URL)
+	if err != nil || !added {
+		return false, err
+	}
+
+	return true, f.Requeue(job)
+}
+
+// Requeue appends the job to the queue file without checking the visited
+// set, so that a resumed crawl still fetches it
+func (f *diskFrontier) Requeue(job crawlJob) error {
+	line, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	if _, err := f.writer.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	f.queued++
+	return nil
+}
+
+func (f *diskFrontier) Pop() (crawlJob, bool, error) {
+	var job crawlJob
+	if f.queued == 0 {
+		return job, false, nil
+	}
+
+	line, err := f.buffered.ReadBytes('\n')
+	if err != nil {
+		return job, false, err
+	}
+	if err := json.Unmarshal(line, &job); err != nil {
+		return job, false, fmt.Errorf("corrupt frontier entry at offset %d: %w", f.readOffset, err)
+	}
+
+	f.popOffsets = append(f.popOffsets, f.readOffset)
+	if len(f.popOffsets) > frontierReplayWindow {
+		f.popOffsets = f.popOffsets[1:]
+	}
+	f.readOffset += int64(len(line))
+	f.queued--
+
+	f.sincePoint++
+	if f.sincePoint >= frontierCheckpointInterval {
+		f.sincePoint = 0
+		if err := f.checkpoint(f.popOffsets[0]); err != nil {
+			return job, false, err
+		}
+	}
+
+	return job, true, nil
+}
+
+func (f *diskFrontier) Len() int {
+	return f.queued
+}
+
+func (f *diskFrontier) Stats() VisitedSetStats {
+	return f.visited.Stats()
+}
+
+// Close persists the read offset; every popped job is assumed to be done or
+// requeued
+func (f *diskFrontier) Close() error {
+	var errs []error
+	if f.buffered != nil {
+		errs = append(errs, f.checkpoint(f.readOffset))
+	}
+	if f.reader != nil {
+		errs = append(errs, f.reader.Close())
+	}
+	if f.writer != nil {
+		errs = append(errs, f.writer.Close())
+	}
+	errs = append(errs, f.visited.Close())
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Atomically persist the offset from which a restarted crawl resumes
+func (f *diskFrontier) checkpoint(offset int64) error {
+	tmpPath := f.offsetPath + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(strconv.FormatInt(offset, 10)), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, f.offsetPath)
+}
+
+const (
+	diskSetHeaderSize   = 16
+	diskSetInitialSlots = 1 << 16
+	diskSetProbeBatch   = 64
+)
+
+var diskSetMagic = []byte("CRAWLSET")
+
+// diskSet is an open-addressing hash set of 64-bit URL hashes stored in a
+// file. Lookups go through the OS page cache instead of the Go heap.
+type diskSet struct {
+	path  string
+	file  *os.File
+	slots uint64
+	count uint64
+}
+
+// Open or create a disk set at path
+func openDiskSet(path string) (*diskSet, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	s := &diskSet{path: path, file: file}
+	if info.Size() == 0 {
+		if err := s.init(diskSetInitialSlots); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return s, nil
+	}
+
+	header := make([]byte, diskSetHeaderSize)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if string(header[:8]) != string(diskSetMagic) {
+		file.Close()
+		return nil, fmt.Errorf("%s is not a visited set file", path)
+	}
+	s.slots = uint64(info.Size()-diskSetHeaderSize) / 8
+	if s.count, err = s.countSlots(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Count the used slots. The count in the header is only written on Close,
+// so it is stale after a crash and isn't trusted.
+func (s *diskSet) countSlots() (uint64, error) {
+	reader := bufio.NewReaderSize(io.NewSectionReader(s.file, diskSetHeaderSize, int64(s.slots)*8), 1<<16)
+	buf := make([]byte, 8)
+	var count uint64
+	for i := uint64(0); i < s.slots; i++ {
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return 0, err
+		}
+		if binary.LittleEndian.Uint64(buf) != 0 {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Write an empty table with the given number of slots
+func (s *diskSet) init(slots uint64) error {
+	s.slots = slots
+	s.count = 0
+	if err := s.file.Truncate(diskSetHeaderSize + int64(slots)*8); err != nil {
+		return err
+	}
+	if _, err := s.file.WriteAt(diskSetMagic, 0); err != nil {
+		return err
+	}
+	return s.writeCount()
+}
+
+func (s *diskSet) writeCount() error {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, s.count)
+	_, err := s.file.WriteAt(buf, 8)
+	return err
+}
+
+// Add inserts key and reports whether it was not already present
+func (s *diskSet) Add(key string) (bool, error) {
+	if (s.count+1)*2 > s.slots {
+		if err := s.grow(); err != nil {
+			return false, err
+		}
+	}
+
+	added, err := s.insert(hashKey(key))
+	if err != nil || !added {
+		return false, err
+	}
+	s.count++
+	return true, nil
+}
+
+// Insert a hash using linear probing, reading slots in batches
+func (s *diskSet) insert(hash uint64) (bool, error) {
+	mask := s.slots - 1
+	buf := make([]byte, diskSetProbeBatch*8)
+	slot := hash & mask
+
+	for {
+		n := s.slots - slot
+		if n > diskSetProbeBatch {
+			n = diskSetProbeBatch
+		}
+		chunk := buf[:n*8]
+		if _, err := s.file.ReadAt(chunk, diskSetHeaderSize+int64(slot)*8); err != nil {
+			return false, err
+		}
+
+		for i := uint64(0); i < n; i++ {
+			value := binary.LittleEndian.Uint64(chunk[i*8:])
+			if value == hash {
+				return false, nil
+			}
+			if value == 0 {
+				binary.LittleEndian.PutUint64(chunk[:8], hash)
+				_, err := s.file.WriteAt(chunk[:8], diskSetHeaderSize+int64(slot+i)*8)
+				return err == nil, err
+			}
+		}
+		slot = (slot + n) & mask
+	}
+}
+
+// Double the table size by rehashing into a new file
+func (s *diskSet) grow() error {
+	tmpPath := s.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	bigger := &diskSet{path: s.path, file: file}
+	if err := bigger.init(s.slots * 2); err != nil {
+		file.Close()
+		return err
+	}
+
+	reader := bufio.NewReaderSize(io.NewSectionReader(s.file, diskSetHeaderSize, int64(s.slots)*8), 1<<16)
+	buf := make([]byte, 8)
+	for i := uint64(0); i < s.slots; i++ {
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			file.Close()
+			return err
+		}
+		if value := binary.LittleEndian.Uint64(buf); value != 0 {
+			if _, err := bigger.insert(value); err != nil {
+				file.Close()
+				return err
+			}
+			bigger.count++
+		}
+	}
+	if err := bigger.writeCount(); err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file.Close()
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.slots = bigger.slots
+	return nil
+}
+
+// The table lives on disk, so it costs no heap memory
+func (s *diskSet) Stats() VisitedSetStats {
+	return VisitedSetStats{
+		Kind: "disk",
+		URLs: int(s.count),
+	}
+}
+
+func (s *diskSet) Close() error {
+	if err := s.writeCount(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// Hash a key to a non-zero 64-bit value; zero marks an empty slot
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	if sum := h.Sum64(); sum != 0 {
+		return sum
+	}
+	return 1
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Pop every queued job
+func drainFrontier(t *testing.T, f Frontier) []crawlJob {
+	t.Helper()
+	var jobs []crawlJob
+	for {
+		job, ok, err := f.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			return jobs
+		}
+		jobs = append(jobs, job)
+	}
+}
+
+// A closed frontier resumes after the jobs popped before it was closed, and
+// still knows the URLs it has seen
+func TestDiskFrontierResume(t *testing.T) {
+	dir := t.TempDir()
+	f, err := openDiskFrontier(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, url := range []string{"https://a.example/1", "https://a.example/2", "https://a.example/3", "https://a.example/1"} {
+		if _, err := f.Push(crawlJob{URL: url, Depth: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if job, ok, err := f.Pop(); err != nil || !ok || job.URL != "https://a.example/1" {
+		t.Fatalf("popped %+v, %v, %v", job, ok, err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if f, err = openDiskFrontier(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.Len() != 2 || f.Stats().URLs != 3 {
+		t.Errorf("resumed with %d queued and %d seen, want 2 and 3", f.Len(), f.Stats().URLs)
+	}
+	if added, err := f.Push(crawlJob{URL: "https://a.example/1"}); added || err != nil {
+		t.Errorf("a URL seen before the restart was queued again: %v, %v", added, err)
+	}
+	jobs := drainFrontier(t, f)
+	if len(jobs) != 2 || jobs[0] != (crawlJob{URL: "https://a.example/2", Depth: 1}) || jobs[1].URL != "https://a.example/3" {
+		t.Errorf("resumed with %+v", jobs)
+	}
+}
+
+// After a crash the jobs popped since the last checkpoint are fetched again,
+// and the visited set is counted from its slots rather than its header
+func TestDiskFrontierCrash(t *testing.T) {
+	dir := t.TempDir()
+	f, err := openDiskFrontier(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const pushed = frontierCheckpointInterval + 50
+	for i := 0; i < pushed; i++ {
+		if _, err := f.Push(crawlJob{URL: fmt.Sprintf("https://a.example/%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if popped := drainFrontier(t, f); len(popped) != pushed {
+		t.Fatalf("popped %d of %d jobs", len(popped), pushed)
+	}
+	// Die without Close, leaving half a line at the end of the queue
+	f.reader.Close()
+	f.writer.Close()
+	f.visited.file.Close()
+	queue, err := os.OpenFile(filepath.Join(dir, "queue.jsonl"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.WriteString(`{"url":"https://a.exa`)
+	queue.Close()
+
+	if f, err = openDiskFrontier(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.Len() != pushed || f.Stats().URLs != pushed {
+		t.Errorf("recovered %d queued and %d seen, want %d of each", f.Len(), f.Stats().URLs, pushed)
+	}
+	if jobs := drainFrontier(t, f); len(jobs) != pushed || jobs[pushed-1].URL != fmt.Sprintf("https://a.example/%d", pushed-1) {
+		t.Errorf("replayed %d jobs, want %d", len(jobs), pushed)
+	}
+}
+
+// The set doubles once half full, keeping what it holds, and the file holds
+// one slot per URL it can take
+func TestDiskSetGrows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "visited.set")
+	s, err := openDiskSet(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const urls = diskSetInitialSlots/2 + 1000
+	for i := 0; i < urls; i++ {
+		if added, err := s.Add(fmt.Sprintf("https://a.example/%d", i)); !added || err != nil {
+			t.Fatalf("adding URL %d: %v, %v", i, added, err)
+		}
+	}
+	if added, err := s.Add("https://a.example/0"); added || err != nil {
+		t.Errorf("a URL was added twice: %v, %v", added, err)
+	}
+	if s.slots != 2*diskSetInitialSlots {
+		t.Errorf("%d slots, want %d", s.slots, 2*diskSetInitialSlots)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(diskSetHeaderSize + 2*diskSetInitialSlots*8); info.Size() != want {
+		t.Errorf("file of %d bytes, want %d", info.Size(), want)
+	}
+
+	if s, err = openDiskSet(path); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Stats().URLs != urls {
+		t.Errorf("reopened with %d URLs, want %d", s.Stats().URLs, urls)
+	}
+	if added, err := s.Add(fmt.Sprintf("https://a.example/%d", urls-1)); added || err != nil {
+		t.Errorf("a URL added before reopening was added again: %v, %v", added, err)
+	}
+}
+
+// A URL waiting out a Retry-After when the crawl is stopped stays in a disk
+// frontier, so the resumed crawl fetches it
+func TestRecursiveCrawlKeepsWaitingURLs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+			cancel()
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><a href="/slow">slow</a></html>`)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	opts := &fetchOptions{extractLinks: true, retryAfter: newRetryAfter(3, time.Minute)}
+	client := newHTTPClient(timeoutConfig{total: 10 * time.Second})
+	results, truncated, _, err := runRecursiveCrawl(ctx, []string{server.URL + "/"}, 2, client, opts, recursiveOptions{maxDepth: 1, frontierDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !truncated {
+		t.Fatalf("got %d results, truncated %v; want the home page alone, truncated", len(results), truncated)
+	}
+
+	f, err := openDiskFrontier(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if jobs := drainFrontier(t, f); len(jobs) != 1 || jobs[0] != (crawlJob{URL: server.URL + "/slow", Depth: 1}) {
+		t.Errorf("resumed with %+v, want the waiting URL", jobs)
+	}
+}
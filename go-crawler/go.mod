@@ -0,0 +1,3 @@
+module github.com/msaberp/web-crawler-comparison/go-crawler
+
+go 1.21
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// graphEdge is a link from one crawled page to another URL
+type graphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Collect the page-to-page edges found during a crawl
+func linkGraphEdges(results []Result) []graphEdge {
+	var edges []graphEdge
+	for _, result := range results {
+		for _, link := range result.Links {
+			edges = append(edges, graphEdge{From: result.URL, To: link})
+		}
+	}
+	return edges
+}
+
+// Pick the graph format from the flag or the output file extension
+func graphFormat(format, filePath string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(filePath)) {
+		case ".dot", ".gv":
+			format = "dot"
+		case ".graphml":
+			format = "graphml"
+		default:
+			format = "jsonl"
+		}
+	}
+
+	switch format {
+	case "jsonl", "dot", "graphml":
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown graph format %q (use jsonl, dot or graphml)", format)
+}
+
+// Write the link graph of a crawl to a file in the given format
+func saveLinkGraph(results []Result, filePath, format string) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	edges := linkGraphEdges(results)
+
+	switch format {
+	case "dot":
+		err = writeGraphDOT(writer, edges)
+	case "graphml":
+		err = writeGraphML(writer, results, edges)
+	default:
+		err = writeGraphJSONL(writer, edges)
+	}
+	if err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// One {"from": ..., "to": ...} object per line
+func writeGraphJSONL(w io.Writer, edges []graphEdge) error {
+	encoder := json.NewEncoder(w)
+	for _, edge := range edges {
+		if err := encoder.Encode(edge); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Graphviz digraph with URLs as quoted node IDs
+func writeGraphDOT(w io.Writer, edges []graphEdge) error {
+	if _, err := fmt.Fprintln(w, "digraph crawl {"); err != nil {
+		return err
+	}
+	for _, edge := range edges {
+		if _, err := fmt.Fprintf(w, "  %s -> %s;\n", strconv.Quote(edge.From), strconv.Quote(edge.To)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// GraphML for Gephi and NetworkX, with page status and title as node data
+func writeGraphML(out io.Writer, results []Result, edges []graphEdge) error {
+	crawled := make(map[string]Result, len(results))
+	for _, result := range results {
+		crawled[result.URL] = result
+	}
+
+	// Nodes in first-seen order: crawled pages, then link targets
+	var nodes []string
+	seen := make(map[string]bool)
+	addNode := func(urlStr string) {
+		if !seen[urlStr] {
+			seen[urlStr] = true
+			nodes = append(nodes, urlStr)
+		}
+	}
+	for _, result := range results {
+		addNode(result.URL)
+	}
+	for _, edge := range edges {
+		addNode(edge.To)
+	}
+
+	// A bufio.Writer keeps the first write error and Flush returns it
+	w := bufio.NewWriter(out)
+	fmt.Fprintln(w, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(w, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	fmt.Fprintln(w, `  <key id="status" for="node" attr.name="status" attr.type="int"/>`)
+	fmt.Fprintln(w, `  <key id="title" for="node" attr.name="title" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <key id="crawled" for="node" attr.name="crawled" attr.type="boolean"/>`)
+	fmt.Fprintln(w, `  <graph id="crawl" edgedefault="directed">`)
+
+	for _, node := range nodes {
+		fmt.Fprintf(w, "    <node id=\"%s\">\n", xmlEscape(node))
+		if result, ok := crawled[node]; ok {
+			fmt.Fprintf(w, "      <data key=\"status\">%d</data>\n", result.Status)
+			fmt.Fprintf(w, "      <data key=\"title\">%s</data>\n", xmlEscape(result.Title))
+			fmt.Fprintln(w, `      <data key="crawled">true</data>`)
+		} else {
+			fmt.Fprintln(w, `      <data key="crawled">false</data>`)
+		}
+		fmt.Fprintln(w, "    </node>")
+	}
+	for i, edge := range edges {
+		fmt.Fprintf(w, "    <edge id=\"e%d\" source=\"%s\" target=\"%s\"/>\n", i, xmlEscape(edge.From), xmlEscape(edge.To))
+	}
+
+	fmt.Fprintln(w, "  </graph>")
+	fmt.Fprintln(w, "</graphml>")
+	return w.Flush()
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+const (
+	pageRankDamping    = 0.85
+	pageRankIterations = 100
+	pageRankTolerance  = 1e-9
+)
+
+// Annotate results with PageRank and in/out degree over the graph of crawled
+// pages. Links to pages outside the crawl are ignored.
+func computePageRank(results []Result) {
+	n := len(results)
+	if n == 0 {
+		return
+	}
+
+	index := make(map[string]int, n)
+	for i, result := range results {
+		index[result.URL] = i
+	}
+
+	// Deduplicated adjacency between crawled pages
+	outLinks := make([][]int, n)
+	for i, result := range results {
+		seen := make(map[int]bool)
+		for _, link := range result.Links {
+			if j, ok := index[link]; ok && !seen[j] {
+				seen[j] = true
+				outLinks[i] = append(outLinks[i], j)
+			}
+		}
+		results[i].OutDegree = len(outLinks[i])
+	}
+	for i := range outLinks {
+		for _, j := range outLinks[i] {
+			results[j].InDegree++
+		}
+	}
+
+	// Power iteration; pages without outgoing links spread rank evenly
+	rank := make([]float64, n)
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+	next := make([]float64, n)
+	for iteration := 0; iteration < pageRankIterations; iteration++ {
+		dangling := 0.0
+		for i := range rank {
+			if len(outLinks[i]) == 0 {
+				dangling += rank[i]
+			}
+		}
+
+		base := (1-pageRankDamping)/float64(n) + pageRankDamping*dangling/float64(n)
+		for i := range next {
+			next[i] = base
+		}
+		for i, targets := range outLinks {
+			if len(targets) == 0 {
+				continue
+			}
+			share := pageRankDamping * rank[i] / float64(len(targets))
+			for _, j := range targets {
+				next[j] += share
+			}
+		}
+
+		delta := 0.0
+		for i := range rank {
+			delta += math.Abs(next[i] - rank[i])
+		}
+		rank, next = next, rank
+		if delta < pageRankTolerance {
+			break
+		}
+	}
+
+	for i := range results {
+		results[i].PageRank = rank[i]
+	}
+}
+
+// Return the highest ranked results, best first
+func topPageRank(results []Result, count int) []Result {
+	ranked := append([]Result(nil), results...)
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].PageRank > ranked[j].PageRank })
+	if len(ranked) > count {
+		ranked = ranked[:count]
+	}
+	return ranked
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// PageRank is computed before the results are filtered for writing, so it
+// reaches the results file
+func TestPageRankIsWritten(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><head><title>%s</title></head><body><a href="/a">a</a> <a href="/b">b</a></body></html>`, r.URL.Path)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "urls.txt")
+	output := filepath.Join(dir, "results.json")
+	if err := os.WriteFile(input, []byte(server.URL+"/a\n"+server.URL+"/b\n"+server.URL+"/c\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"-pagerank"},
+		{"-pagerank", "-only-status", "200"},
+	} {
+		args = append(args, "-input", input, "-output", output)
+		if out, code := runCrawler(t, args...); code != exitOK {
+			t.Fatalf("crawler %v exited with %d:\n%s", args, code, out)
+		}
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var combined CombinedResults
+		if err := json.Unmarshal(data, &combined); err != nil {
+			t.Fatal(err)
+		}
+		if len(combined.Results) != 3 {
+			t.Fatalf("%v: got %d results, want 3", args, len(combined.Results))
+		}
+		for _, result := range combined.Results {
+			if result.PageRank <= 0 {
+				t.Errorf("%v: %s has pagerank %v", args, result.URL, result.PageRank)
+			}
+			if result.OutDegree != 2 {
+				t.Errorf("%v: %s has out degree %d, want 2", args, result.URL, result.OutDegree)
+			}
+		}
+	}
+}
+
+// A writer whose nth write fails, and every other succeeds, as with a
+// transient error
+type failingWriter struct {
+	writes int
+	failAt int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.writes == w.failAt {
+		return 0, errors.New("disk full")
+	}
+	return len(p), nil
+}
+
+// A failed write is reported whichever write it is, not just the last
+func TestGraphWriteErrors(t *testing.T) {
+	results := []Result{
+		{URL: "https://a.example/", Title: "A & B", Status: 200, Links: []string{"https://a.example/b", "https://c.example/"}},
+		{URL: "https://a.example/b", Title: "B", Status: 404},
+	}
+	edges := linkGraphEdges(results)
+	for _, tc := range []struct {
+		format string
+		write  func(io.Writer) error
+	}{
+		{"jsonl", func(w io.Writer) error { return writeGraphJSONL(w, edges) }},
+		{"dot", func(w io.Writer) error { return writeGraphDOT(w, edges) }},
+		{"graphml", func(w io.Writer) error { return writeGraphML(w, results, edges) }},
+	} {
+		counter := &failingWriter{}
+		if err := tc.write(counter); err != nil {
+			t.Fatalf("%s: %v", tc.format, err)
+		}
+		for failAt := 1; failAt <= counter.writes; failAt++ {
+			if err := tc.write(&failingWriter{failAt: failAt}); err == nil {
+				t.Errorf("%s: write %d of %d failed without an error", tc.format, failAt, counter.writes)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// Points each member gets on the ring, which evens out the share of keys
+// each one owns
+const hashRingReplicas = 100
+
+// hashRing assigns keys to members by consistent hashing: adding or
+// removing a member only moves the keys that member gains or loses
+type hashRing struct {
+	points  []uint64
+	members map[uint64]string
+}
+
+func newHashRing() *hashRing {
+	return &hashRing{members: make(map[uint64]string)}
+}
+
+func ringHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// FNV alone clusters similar keys such as "worker-1#1" and "worker-1#2"
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	return x
+}
+
+// Add a member to the ring
+func (r *hashRing) add(member string) {
+	for i := 0; i < hashRingReplicas; i++ {
+		point := ringHash(member + "#" + strconv.Itoa(i))
+		if _, taken := r.members[point]; taken {
+			continue
+		}
+		r.members[point] = member
+		r.points = append(r.points, point)
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+}
+
+// Remove a member from the ring
+func (r *hashRing) remove(member string) {
+	points := r.points[:0]
+	for _, point := range r.points {
+		if r.members[point] == member {
+			delete(r.members, point)
+			continue
+		}
+		points = append(points, point)
+	}
+	r.points = points
+}
+
+// The member owning a key, "" when the ring is empty
+func (r *hashRing) owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := ringHash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.members[r.points[i]]
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func ringKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("host-%d.example.com", i)
+	}
+	return keys
+}
+
+func ringOwners(r *hashRing, keys []string) map[string]string {
+	owners := make(map[string]string, len(keys))
+	for _, key := range keys {
+		owners[key] = r.owner(key)
+	}
+	return owners
+}
+
+func TestHashRingDistribution(t *testing.T) {
+	r := newHashRing()
+	if owner := r.owner("example.com"); owner != "" {
+		t.Fatalf("empty ring: got owner %q", owner)
+	}
+	members := []string{"worker-1", "worker-2", "worker-3", "worker-4"}
+	for _, member := range members {
+		r.add(member)
+	}
+	keys := ringKeys(10000)
+	shares := make(map[string]int)
+	for _, owner := range ringOwners(r, keys) {
+		shares[owner]++
+	}
+	// Each of four members should own about a quarter of the keys
+	for _, member := range members {
+		if share := float64(shares[member]) / float64(len(keys)); share < 0.15 || share > 0.35 {
+			t.Errorf("%s owns %.1f%% of the keys, want about 25%%", member, 100*share)
+		}
+	}
+}
+
+func TestHashRingMovesFewKeys(t *testing.T) {
+	r := newHashRing()
+	for _, member := range []string{"worker-1", "worker-2", "worker-3", "worker-4"} {
+		r.add(member)
+	}
+	keys := ringKeys(10000)
+	before := ringOwners(r, keys)
+
+	// A member joining only takes keys, it doesn't shuffle the others
+	r.add("worker-5")
+	joined := ringOwners(r, keys)
+	moved := 0
+	for _, key := range keys {
+		if joined[key] != before[key] {
+			moved++
+			if joined[key] != "worker-5" {
+				t.Fatalf("%s moved from %s to %s, not to the new member", key, before[key], joined[key])
+			}
+		}
+	}
+	if share := float64(moved) / float64(len(keys)); share < 0.1 || share > 0.3 {
+		t.Errorf("adding a fifth member moved %.1f%% of the keys, want about 20%%", 100*share)
+	}
+
+	// A member leaving only gives up its own keys
+	r.remove("worker-2")
+	left := ringOwners(r, keys)
+	for _, key := range keys {
+		if left[key] != joined[key] && joined[key] != "worker-2" {
+			t.Fatalf("%s moved from %s to %s though %s stayed", key, joined[key], left[key], joined[key])
+		}
+		if left[key] == "worker-2" {
+			t.Fatalf("%s still owned by the removed member", key)
+		}
+	}
+
+	// Removing the member that joined gives back the original assignment
+	r.add("worker-2")
+	r.remove("worker-5")
+	for key, owner := range ringOwners(r, keys) {
+		if owner != before[key] {
+			t.Fatalf("%s owned by %s, was %s before", key, owner, before[key])
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// headerCapture selects which response headers are recorded in results
+type headerCapture struct {
+	all   bool
+	names []string // canonical header names
+}
+
+// Parse a comma separated header list; "all" (or "*") captures every header
+func parseHeaderCapture(value string) *headerCapture {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if name == "all" || name == "*" {
+			return &headerCapture{all: true}
+		}
+		names = append(names, http.CanonicalHeaderKey(name))
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return &headerCapture{names: names}
+}
+
+// Extract the selected headers, joining repeated values with ", "
+func (c *headerCapture) capture(header http.Header) map[string]string {
+	captured := make(map[string]string)
+	if c.all {
+		for name, values := range header {
+			captured[name] = strings.Join(values, ", ")
+		}
+	} else {
+		for _, name := range c.names {
+			if values := header.Values(name); len(values) > 0 {
+				captured[name] = strings.Join(values, ", ")
+			}
+		}
+	}
+	if len(captured) == 0 {
+		return nil
+	}
+	return captured
+}
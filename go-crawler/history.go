@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tables of the history store: one row per run and one per URL per run
+const historySchema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	started_at TEXT NOT NULL,
+	total_urls INTEGER NOT NULL,
+	successful INTEGER NOT NULL,
+	failed INTEGER NOT NULL,
+	skipped INTEGER NOT NULL,
+	total_time REAL NOT NULL
+);
+CREATE TABLE IF NOT EXISTS url_status (
+	run_id INTEGER NOT NULL REFERENCES runs(id),
+	url TEXT NOT NULL,
+	status INTEGER NOT NULL,
+	time_taken REAL NOT NULL,
+	succeeded INTEGER NOT NULL,
+	PRIMARY KEY (run_id, url)
+);
+CREATE INDEX IF NOT EXISTS url_status_url ON url_status (url, run_id);
+`
+
+// historyDB is a SQLite history file. The crawler is built from the
+// standard library alone, so it is driven through the sqlite3 command-line
+// tool rather than a database driver.
+type historyDB struct {
+	path string
+}
+
+// Open the history file, creating its tables if needed
+func openHistory(path string) (*historyDB, error) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		return nil, errors.New("the history store needs the sqlite3 command-line tool on the PATH")
+	}
+	h := &historyDB{path: path}
+	if err := h.exec(func(w io.Writer) error {
+		_, err := io.WriteString(w, historySchema)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Run a SQL script written to sqlite3's standard input, stopping at the
+// first error
+func (h *historyDB) exec(script func(w io.Writer) error) error {
+	cmd := exec.Command("sqlite3", "-bail", h.path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(stdin)
+	writeErr := script(w)
+	if writeErr == nil {
+		writeErr = w.Flush()
+	}
+	stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("sqlite3: %s", strings.TrimSpace(stderr.String()))
+	}
+	return writeErr
+}
+
+// Run a query and decode its rows, which sqlite3 prints as a JSON array
+func (h *historyDB) query(sql string, rows interface{}) error {
+	cmd := exec.Command("sqlite3", "-bail", "-json", h.path, sql)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("sqlite3: %s", strings.TrimSpace(stderr.String()))
+	}
+	// No rows prints nothing at all
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil
+	}
+	return json.Unmarshal(out, rows)
+}
+
+// Quote a string as a SQL literal
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func sqlFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sqlBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// Append a run's summary and the status of each of its URLs in one
+// transaction
+func (h *historyDB) appendRun(started time.Time, summary Summary, results []Result) error {
+	return h.exec(func(w io.Writer) error {
+		fmt.Fprintf(w, "BEGIN IMMEDIATE;\nINSERT INTO runs (started_at, total_urls, successful, failed, skipped, total_time) VALUES (%s, %d, %d, %d, %d, %s);\n",
+			sqlQuote(started.UTC().Format(time.RFC3339)), summary.TotalURLs, summary.SuccessfulFetches, summary.FailedFetches,
+			summary.SkippedURLs, sqlFloat(summary.TotalTime))
+		for _, result := range results {
+			if result.SkipReason != "" {
+				continue
+			}
+			fmt.Fprintf(w, "INSERT OR REPLACE INTO url_status VALUES ((SELECT max(id) FROM runs), %s, %d, %s, %s);\n",
+				sqlQuote(result.URL), result.Status, sqlFloat(result.TimeTaken), sqlBool(resultSucceeded(result)))
+		}
+		_, err := io.WriteString(w, "COMMIT;\n")
+		return err
+	})
+}
+
+// HistoryRun is one run in the history store
+type HistoryRun struct {
+	ID          int     `json:"id"`
+	StartedAt   string  `json:"started_at"`
+	TotalURLs   int     `json:"total_urls"`
+	Successful  int     `json:"successful"`
+	Failed      int     `json:"failed"`
+	Skipped     int     `json:"skipped"`
+	TotalTime   float64 `json:"total_time"`
+	SuccessRate float64 `json:"success_rate"` // of the fetched URLs
+}
+
+// URLTrend is a URL's status in each of the runs shown, oldest first; 0
+// means the URL was not fetched in that run
+type URLTrend struct {
+	URL      string `json:"url"`
+	Statuses []int  `json:"statuses"`
+}
+
+// HistoryReport is what the history subcommand shows
+type HistoryReport struct {
+	Runs   []HistoryRun `json:"runs"`
+	Trends []URLTrend   `json:"trends"`
+}
+
+// Load the latest runs and the status trends of their URLs. Without a URL
+// only URLs whose status changed are included.
+func loadHistory(h *historyDB, runs int, urlStr string) (HistoryReport, error) {
+	report := HistoryReport{Runs: []HistoryRun{}, Trends: []URLTrend{}}
+	err := h.query(fmt.Sprintf(`SELECT id, started_at, total_urls, successful, failed, skipped, total_time
+		FROM runs ORDER BY id DESC LIMIT %d`, runs), &report.Runs)
+	if err != nil || len(report.Runs) == 0 {
+		return report, err
+	}
+
+	// Oldest first, like the trends
+	for i, j := 0, len(report.Runs)-1; i < j; i, j = i+1, j-1 {
+		report.Runs[i], report.Runs[j] = report.Runs[j], report.Runs[i]
+	}
+	column := make(map[int]int, len(report.Runs))
+	for i := range report.Runs {
+		run := &report.Runs[i]
+		column[run.ID] = i
+		if fetched := run.TotalURLs - run.Skipped; fetched > 0 {
+			run.SuccessRate = float64(run.Successful) / float64(fetched)
+		}
+	}
+
+	sql := fmt.Sprintf("SELECT url, run_id, status FROM url_status WHERE run_id >= %d", report.Runs[0].ID)
+	if urlStr != "" {
+		sql += " AND url = " + sqlQuote(urlStr)
+	}
+	var rows []struct {
+		URL    string `json:"url"`
+		RunID  int    `json:"run_id"`
+		Status int    `json:"status"`
+	}
+	if err := h.query(sql+" ORDER BY url, run_id", &rows); err != nil {
+		return report, err
+	}
+
+	for _, row := range rows {
+		n := len(report.Trends)
+		if n == 0 || report.Trends[n-1].URL != row.URL {
+			report.Trends = append(report.Trends, URLTrend{URL: row.URL, Statuses: make([]int, len(report.Runs))})
+			n++
+		}
+		report.Trends[n-1].Statuses[column[row.RunID]] = row.Status
+	}
+	if urlStr == "" {
+		changed := report.Trends[:0]
+		for _, trend := range report.Trends {
+			if statusChanged(trend.Statuses) {
+				changed = append(changed, trend)
+			}
+		}
+		report.Trends = changed
+	}
+	return report, nil
+}
+
+// Report whether a URL's status differs between runs it was fetched in
+func statusChanged(statuses []int) bool {
+	first := 0
+	for _, status := range statuses {
+		if status == 0 {
+			continue
+		}
+		if first == 0 {
+			first = status
+		} else if status != first {
+			return true
+		}
+	}
+	return false
+}
+
+// Print the history report as text
+func printHistory(report HistoryReport, urlStr string) {
+	fmt.Printf("Runs: %d\n", len(report.Runs))
+	for _, run := range report.Runs {
+		fmt.Printf("  #%-4d %s  %d URLs  %5.1f%% success  %.2fs\n",
+			run.ID, run.StartedAt, run.TotalURLs, run.SuccessRate*100, run.TotalTime)
+	}
+
+	if urlStr == "" {
+		fmt.Printf("URLs whose status changed: %d\n", len(report.Trends))
+	}
+	for _, trend := range report.Trends {
+		statuses := make([]string, len(trend.Statuses))
+		for i, status := range trend.Statuses {
+			statuses[i] = strconv.Itoa(status)
+			if status == 0 {
+				statuses[i] = "-"
+			}
+		}
+		fmt.Printf("  %s: %s\n", trend.URL, strings.Join(statuses, " "))
+	}
+}
+
+// Run the history subcommand and return the process exit code
+func runHistory(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	runs := fs.Int("runs", 10, "Number of latest runs to show")
+	urlStr := fs.String("url", "", "Show the status of this URL in every run shown")
+	asJSON := fs.Bool("json", false, "Print the history as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: crawler history [-runs N] [-url URL] [-json] history.db\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || *runs < 1 {
+		fs.Usage()
+		return exitConfig
+	}
+	if _, err := os.Stat(fs.Arg(0)); err != nil {
+		fmt.Printf("Error opening history: %s\n", err)
+		return exitError
+	}
+
+	h, err := openHistory(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Error opening history: %s\n", err)
+		return exitError
+	}
+	report, err := loadHistory(h, *runs, *urlStr)
+	if err != nil {
+		fmt.Printf("Error reading history: %s\n", err)
+		return exitError
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			fmt.Printf("Error encoding history: %s\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+
+	printHistory(report, *urlStr)
+	return exitOK
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// HreflangAlternate is a language alternate declared by a page
+type HreflangAlternate struct {
+	Lang string `json:"lang"`
+	URL  string `json:"url"`
+}
+
+// Extract <link rel="alternate" hreflang="..."> alternates, resolving hrefs
+// against the page URL
+func extractHreflang(body string, base *url.URL) []HreflangAlternate {
+	var alternates []HreflangAlternate
+	for _, tag := range linkTagRegex.FindAllString(body, -1) {
+		attributes := tagAttributes(tag)
+		lang := strings.TrimSpace(attributes["hreflang"])
+		if lang == "" || !hasRel(attributes["rel"], "alternate") {
+			continue
+		}
+		ref, err := url.Parse(strings.TrimSpace(attributes["href"]))
+		if err != nil {
+			continue
+		}
+		normalized, err := normalizeURL(base.ResolveReference(ref).String())
+		if err != nil {
+			continue
+		}
+		alternates = append(alternates, HreflangAlternate{Lang: strings.ToLower(lang), URL: normalized})
+	}
+	return alternates
+}
+
+// Report whether a space separated rel attribute contains value
+func hasRel(rel, value string) bool {
+	for _, token := range strings.Fields(strings.ToLower(rel)) {
+		if token == value {
+			return true
+		}
+	}
+	return false
+}
+
+// BrokenHreflang is an alternate that does not link back to the page
+// declaring it
+type BrokenHreflang struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Lang   string `json:"lang"`
+	Reason string `json:"reason"`
+}
+
+// HreflangStats summarizes hreflang validation across a crawl
+type HreflangStats struct {
+	PagesWithAlternates int              `json:"pages_with_alternates"`
+	PairsChecked        int              `json:"pairs_checked"`
+	Unverified          int              `json:"unverified"` // alternates that were not crawled
+	BrokenPairs         []BrokenHreflang `json:"broken_pairs"`
+}
+
+// Check that every crawled alternate links back to the page that declared
+// it. Alternates outside the crawl cannot be checked and are only counted.
+func validateHreflang(results []Result) *HreflangStats {
+	stats := &HreflangStats{BrokenPairs: []BrokenHreflang{}}
+
+	pages := make(map[string]Result, len(results))
+	for _, result := range results {
+		if key, err := normalizeURL(result.URL); err == nil {
+			pages[key] = result
+		}
+	}
+
+	for _, result := range results {
+		if len(result.Hreflang) == 0 {
+			continue
+		}
+		stats.PagesWithAlternates++
+		from, err := normalizeURL(result.URL)
+		if err != nil {
+			continue
+		}
+
+		for _, alternate := range result.Hreflang {
+			// Self references need no return link
+			if alternate.URL == from {
+				continue
+			}
+			target, ok := pages[alternate.URL]
+			if !ok {
+				stats.Unverified++
+				continue
+			}
+			stats.PairsChecked++
+
+			broken := BrokenHreflang{From: result.URL, To: alternate.URL, Lang: alternate.Lang}
+			switch {
+			case target.Status != 200 && !target.Unchanged:
+				broken.Reason = "alternate did not return 200"
+			case !linksBack(target.Hreflang, from):
+				broken.Reason = "no return link"
+			default:
+				continue
+			}
+			stats.BrokenPairs = append(stats.BrokenPairs, broken)
+		}
+	}
+
+	sort.SliceStable(stats.BrokenPairs, func(i, j int) bool {
+		if stats.BrokenPairs[i].From != stats.BrokenPairs[j].From {
+			return stats.BrokenPairs[i].From < stats.BrokenPairs[j].From
+		}
+		return stats.BrokenPairs[i].To < stats.BrokenPairs[j].To
+	})
+	return stats
+}
+
+func linksBack(alternates []HreflangAlternate, urlStr string) bool {
+	for _, alternate := range alternates {
+		if alternate.URL == urlStr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func FuzzExtractHreflang(f *testing.F) {
+	f.Add(`<link rel="alternate" hreflang="de" href="/de/">`)
+	f.Add(`<LINK HREFLANG="x-default" REL="Alternate Stylesheet" HREF='https://example.com/'>`)
+	f.Add(`<link rel="alternate" hreflang="" href="/empty">`)
+	base, _ := url.Parse("https://example.com/en/")
+	f.Fuzz(func(t *testing.T, body string) {
+		for _, alternate := range extractHreflang(body, base) {
+			if alternate.Lang == "" || alternate.Lang != strings.ToLower(alternate.Lang) {
+				t.Errorf("hreflang %q is not a lowercase language", alternate.Lang)
+			}
+			if normalized, err := normalizeURL(alternate.URL); err != nil || normalized != alternate.URL {
+				t.Errorf("alternate %q is not normalized (%q, %v)", alternate.URL, normalized, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// Load the results of a previous run, keyed by URL
+func loadPreviousResults(filePath string) (map[string]Result, error) {
+	combined, err := loadResults(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := make(map[string]Result, len(combined.Results))
+	for _, result := range combined.Results {
+		previous[result.URL] = result
+	}
+
+	return previous, nil
+}
+
+// Add validators from a previous result so the server can answer 304
+func setConditionalHeaders(req *http.Request, prev Result) {
+	if prev.ETag != "" {
+		req.Header.Set("If-None-Match", prev.ETag)
+	}
+	if prev.LastModified != "" {
+		req.Header.Set("If-Modified-Since", prev.LastModified)
+	}
+}
+
+// Build the result of a 304 for a page fetched before. Only what was derived
+// from the content (title, content type, hash, hreflang and meta refresh)
+// carries forward; the rest describes this run's response, and the fetch
+// stage adds its headers, timings and sizes. Links carry forward only from a
+// previous result held in memory: results files don't keep them, so a crawl
+// that needs links fetches such pages in full.
+func unchangedResult(prev Result, resp *http.Response, startTime time.Time) Result {
+	result := Result{
+		URL:          prev.URL,
+		Title:        prev.Title,
+		Status:       resp.StatusCode,
+		TimeTaken:    time.Since(startTime).Seconds(),
+		Domain:       prev.Domain,
+		StartedAt:    formatStartedAt(startTime),
+		ContentType:  prev.ContentType,
+		ContentHash:  prev.ContentHash,
+		ETag:         prev.ETag,
+		LastModified: prev.LastModified,
+		Unchanged:    true,
+		Redirects:    redirectChain(resp),
+		Links:        prev.Links,
+		Hreflang:     prev.Hreflang,
+		MetaRefresh:  prev.MetaRefresh,
+	}
+	if finalURL := resp.Request.URL.String(); finalURL != prev.URL {
+		result.FinalURL = finalURL
+	}
+
+	// Servers may refresh validators on a 304
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		result.ETag = etag
+	}
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		result.LastModified = lastModified
+	}
+
+	return result
+}
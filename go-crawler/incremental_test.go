@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Crawl URLs against previous results, returning the new results by URL
+func crawlSince(t *testing.T, urls []string, previous map[string]Result) map[string]Result {
+	t.Helper()
+	client := newHTTPClient(timeoutConfig{total: 10 * time.Second})
+	results, _, err := crawlURLs(context.Background(), urls, 2, client, &fetchOptions{previous: previous, bodyDigest: digestCRC64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byURL := make(map[string]Result, len(results))
+	for _, result := range results {
+		byURL[result.URL] = result
+	}
+	return byURL
+}
+
+// A 304 carries forward what came from the content, and takes everything
+// about the response from this run
+func TestNotModifiedResult(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.Header().Set("ETag", `"v2"`)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<title>New</title>")
+	}))
+	defer server.Close()
+
+	urlStr := server.URL + "/page"
+	prev := Result{
+		URL:              urlStr,
+		Title:            "Old title",
+		Status:           http.StatusOK,
+		Domain:           "example.com",
+		ContentType:      "text/html",
+		ContentHash:      "crc64:0123456789abcdef",
+		ETag:             `"v1"`,
+		Hreflang:         []HreflangAlternate{{Lang: "de", URL: "https://example.com/de"}},
+		TimeTaken:        9,
+		StartedAt:        "2020-01-01T00:00:00.000Z",
+		DNSMs:            50,
+		BodyBytes:        12345,
+		BytesPerSecond:   1000,
+		ContentEncoding:  "gzip",
+		DecodedBytes:     40000,
+		CompressionRatio: 3.2,
+		FinalURL:         "https://example.com/moved",
+		Redirects:        []Redirect{{URL: "https://example.com/old", Status: http.StatusMovedPermanently}},
+		Timeout:          "header",
+		Soft404:          "title says the page was not found",
+	}
+	result := crawlSince(t, []string{urlStr}, map[string]Result{urlStr: prev})[urlStr]
+
+	if !result.Unchanged || result.Status != http.StatusNotModified || !resultSucceeded(result) {
+		t.Fatalf("got status %d, unchanged %v; want an unchanged 304 counted as a success", result.Status, result.Unchanged)
+	}
+	if result.Title != prev.Title || result.ContentHash != prev.ContentHash || result.ContentType != prev.ContentType || len(result.Hreflang) != 1 {
+		t.Errorf("content fields not carried forward: %+v", result)
+	}
+	if result.ETag != `"v2"` {
+		t.Errorf("got ETag %s, want the one the 304 refreshed", result.ETag)
+	}
+	if result.StartedAt == prev.StartedAt || result.TimeTaken >= prev.TimeTaken || result.DNSMs == prev.DNSMs {
+		t.Errorf("timings of the previous run kept: %+v", result)
+	}
+	if result.BodyBytes != 0 || result.BytesPerSecond == prev.BytesPerSecond {
+		t.Errorf("transfer stats of the previous run kept: body %d bytes at %v bytes/s", result.BodyBytes, result.BytesPerSecond)
+	}
+	if result.ContentEncoding != "" || result.DecodedBytes != 0 || result.CompressionRatio != 0 {
+		t.Errorf("compression stats of the previous run kept: %q %d %v", result.ContentEncoding, result.DecodedBytes, result.CompressionRatio)
+	}
+	if result.FinalURL != "" || result.Redirects != nil || result.Timeout != "" || result.Soft404 != "" {
+		t.Errorf("response details of the previous run kept: %+v", result)
+	}
+}
+
+// Without validators, a page whose body hashes the same as before is
+// unchanged; one whose body differs is not
+func TestUnchangedContentHash(t *testing.T) {
+	body := "<title>Same</title>"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	urlStr := server.URL + "/"
+	first := crawlSince(t, []string{urlStr}, nil)[urlStr]
+	if first.ContentHash == "" || first.Unchanged {
+		t.Fatalf("first crawl: hash %q, unchanged %v", first.ContentHash, first.Unchanged)
+	}
+	if again := crawlSince(t, []string{urlStr}, map[string]Result{urlStr: first})[urlStr]; !again.Unchanged || again.Status != http.StatusOK {
+		t.Errorf("same body: got status %d, unchanged %v; want an unchanged 200", again.Status, again.Unchanged)
+	}
+	body = "<title>Different</title>"
+	if changed := crawlSince(t, []string{urlStr}, map[string]Result{urlStr: first})[urlStr]; changed.Unchanged || changed.ContentHash == first.ContentHash {
+		t.Errorf("changed body: got hash %s, unchanged %v", changed.ContentHash, changed.Unchanged)
+	}
+}
+
+// Results files don't keep links, so a recursive crawl against one fetches
+// pages in full and still follows their links, rather than taking a 304 and
+// stopping there
+func TestRecursiveSinceFollowsLinks(t *testing.T) {
+	var mu sync.Mutex
+	conditional := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			mu.Lock()
+			conditional++
+			mu.Unlock()
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<title>Home</title><a href="/child">child</a>`)
+			return
+		}
+		fmt.Fprint(w, "<title>Child</title>")
+	}))
+	defer server.Close()
+	conditionalRequests := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return conditional
+	}
+
+	dir := t.TempDir()
+	input := writeInput(t, "urls.txt", server.URL+"/\n")
+	first := filepath.Join(dir, "first.json")
+	second := filepath.Join(dir, "second.json")
+	for _, args := range [][]string{
+		{"-input", input, "-depth", "1", "-output", first},
+		{"-input", input, "-depth", "1", "-since", first, "-output", second},
+	} {
+		if out, code := runCrawler(t, args...); code != exitOK {
+			t.Fatalf("crawler %v exited with %d:\n%s", args, code, out)
+		}
+	}
+	combined, err := loadResults(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	urls := make(map[string]Result)
+	for _, result := range combined.Results {
+		urls[result.URL] = result
+	}
+	if len(urls) != 2 || urls[server.URL+"/child"].Title != "Child" {
+		t.Errorf("second crawl got %v, want the home page and its child", combined.Results)
+	}
+	if !urls[server.URL+"/"].Unchanged {
+		t.Errorf("the home page wasn't reported unchanged")
+	}
+	if n := conditionalRequests(); n != 0 {
+		t.Errorf("%d conditional requests in a crawl that needs links", n)
+	}
+
+	// Without links to follow, the same crawl asks for 304s
+	if out, code := runCrawler(t, "-input", input, "-since", first, "-output", second); code != exitOK {
+		t.Fatalf("crawler exited with %d:\n%s", code, out)
+	}
+	if n := conditionalRequests(); n != 1 {
+		t.Errorf("got %d conditional requests, want 1", n)
+	}
+}
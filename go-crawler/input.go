@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Select the slice of URLs starting at offset, with at most limit entries
+// (0 means no limit)
+func sliceURLs(urls []string, offset, limit int) []string {
+	if offset >= len(urls) {
+		return nil
+	}
+	urls = urls[offset:]
+	if limit > 0 && limit < len(urls) {
+		urls = urls[:limit]
+	}
+	return urls
+}
+
+// Parse a sample size given as a percentage ("5%") or a fraction ("0.05")
+func parseSampleFraction(value string) (float64, error) {
+	var fraction float64
+	var err error
+	if strings.HasSuffix(value, "%") {
+		fraction, err = strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		fraction /= 100
+	} else {
+		fraction, err = strconv.ParseFloat(value, 64)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid sample %q: %w", value, err)
+	}
+	if fraction <= 0 || fraction > 1 {
+		return 0, fmt.Errorf("invalid sample %q: must be between 0%% and 100%%", value)
+	}
+	return fraction, nil
+}
+
+// Pick n URLs uniformly at random, keeping them in input order
+func sampleURLs(urls []string, n int, rng *rand.Rand) []string {
+	if n >= len(urls) {
+		return urls
+	}
+
+	// Partial Fisher-Yates shuffle over the indices
+	indices := make([]int, len(urls))
+	for i := range indices {
+		indices[i] = i
+	}
+	for i := 0; i < n; i++ {
+		j := i + rng.Intn(len(indices)-i)
+		indices[i], indices[j] = indices[j], indices[i]
+	}
+	chosen := indices[:n]
+	sort.Ints(chosen)
+
+	sample := make([]string, n)
+	for i, index := range chosen {
+		sample[i] = urls[index]
+	}
+	return sample
+}
+
+// Shuffle a copy of the URLs so hosts are not clustered in input order
+func shuffleURLs(urls []string, rng *rand.Rand) []string {
+	shuffled := append([]string(nil), urls...)
+	rng.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return shuffled
+}
+
+// stringListFlag collects the values of a flag that may be repeated
+type stringListFlag []string
+
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// Expand input file patterns into file paths. Patterns without glob
+// characters are used as-is so a missing file is reported when opened.
+func expandInputs(patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[") {
+			files = append(files, pattern)
+			continue
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("input pattern %q matched no files", pattern)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// urlEntry is a URL from an input file plus the extra data carried with it
+type urlEntry struct {
+	URL      string            `json:"url"`
+	Metadata map[string]string `json:"metadata,omitempty"` // copied to the Result untouched
+	Tags     []string          `json:"tags,omitempty"`     // business categories, copied to the Result
+
+	// Request overrides from extended (JSON lines) input
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+
+	// Pattern the body must match for the fetch to count as successful
+	ExpectBodyRegex string `json:"expect_body_regex,omitempty"`
+	expectBody      *regexp.Regexp
+
+	line int // where the URL was read from, for error reports
+}
+
+// Report whether the entry carries anything beyond the URL
+func (e *urlEntry) hasExtras() bool {
+	return e.Metadata != nil || e.Tags != nil || e.Method != "" || e.Headers != nil || e.Body != "" || e.ExpectBodyRegex != ""
+}
+
+// Load URL entries from a file, choosing the format by extension
+func loadInputFile(filePath string) ([]urlEntry, error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".csv":
+		return loadCSVInput(filePath)
+	case ".jsonl", ".ndjson":
+		return loadJSONLInput(filePath)
+	}
+
+	return loadURLs(filePath)
+}
+
+// Load a CSV file with a header row. The "url" column is required; a "tags"
+// column holds tags separated by spaces or commas, and every other column is
+// kept as per-URL metadata.
+func loadCSVInput(filePath string) ([]urlEntry, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: reading CSV header: %w", filePath, err)
+	}
+	urlColumn := -1
+	for i, name := range header {
+		header[i] = strings.TrimSpace(name)
+		if strings.EqualFold(header[i], "url") {
+			urlColumn = i
+		}
+	}
+	if urlColumn < 0 {
+		return nil, fmt.Errorf("%s: CSV header has no url column", filePath)
+	}
+
+	var entries []urlEntry
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+		if urlColumn >= len(record) || strings.TrimSpace(record[urlColumn]) == "" {
+			continue
+		}
+
+		line, _ := reader.FieldPos(urlColumn)
+		entry := urlEntry{URL: strings.TrimSpace(record[urlColumn]), line: line}
+		for i, value := range record {
+			if i == urlColumn || i >= len(header) {
+				continue
+			}
+			if strings.EqualFold(header[i], "tags") {
+				entry.Tags = parseTags(value)
+				continue
+			}
+			if entry.Metadata == nil {
+				entry.Metadata = make(map[string]string)
+			}
+			entry.Metadata[header[i]] = value
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Load a JSON lines file where each line describes one request, e.g.
+// {"url": "...", "method": "POST", "headers": {...}, "body": "..."}
+func loadJSONLInput(filePath string) ([]urlEntry, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []urlEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var entry urlEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", filePath, lineNumber, err)
+		}
+		if entry.URL == "" {
+			return nil, fmt.Errorf("%s:%d: missing url", filePath, lineNumber)
+		}
+		entry.Method = strings.ToUpper(entry.Method)
+		entry.Tags = parseTags(strings.Join(entry.Tags, ","))
+		if entry.ExpectBodyRegex != "" {
+			if entry.expectBody, err = regexp.Compile(entry.ExpectBodyRegex); err != nil {
+				return nil, fmt.Errorf("%s:%d: expect_body_regex: %w", filePath, lineNumber, err)
+			}
+		}
+		entry.line = lineNumber
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// InvalidURL is an input line whose URL can't be fetched
+type InvalidURL struct {
+	File  string `json:"file"`
+	Line  int    `json:"line"`
+	URL   string `json:"url"`
+	Error string `json:"error"`
+}
+
+// Check that a URL has an http or https scheme and a host
+func validateURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return err
+	}
+	switch {
+	case parsed.Scheme == "":
+		return errors.New("missing scheme")
+	case parsed.Scheme != "http" && parsed.Scheme != "https":
+		return fmt.Errorf("%w %q", errUnsupportedScheme, parsed.Scheme)
+	case parsed.Hostname() == "":
+		return errors.New("missing host")
+	}
+	if port := parsed.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid port %q", port)
+		}
+	}
+	return nil
+}
+
+// Report whether two entries for a URL make the same request: the same
+// method, headers and body, and the same body assertion
+func sameRequest(a, b *urlEntry) bool {
+	methodA, methodB := a.Method, b.Method
+	if methodA == "" {
+		methodA = "GET"
+	}
+	if methodB == "" {
+		methodB = "GET"
+	}
+	if methodA != methodB || a.Body != b.Body || a.ExpectBodyRegex != b.ExpectBodyRegex || len(a.Headers) != len(b.Headers) {
+		return false
+	}
+	for name, value := range a.Headers {
+		if other, ok := b.Headers[name]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Load and merge URLs from several files, dropping duplicates while keeping
+// the first occurrence in order. Entries carrying extra data are returned
+// keyed by URL. Malformed URLs are left out and returned with their location.
+// Results are keyed by URL, so a URL listed again with a different request
+// is an error rather than a request silently dropped.
+func loadURLsFromFiles(files []string) ([]string, map[string]*urlEntry, []InvalidURL, error) {
+	var urls []string
+	var invalid []InvalidURL
+	extras := make(map[string]*urlEntry)
+	type firstEntry struct {
+		entry *urlEntry
+		file  string
+	}
+	seen := make(map[string]firstEntry)
+
+	for _, file := range files {
+		entries, err := loadInputFile(file)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for i := range entries {
+			entry := &entries[i]
+			if err := validateURL(entry.URL); err != nil {
+				invalid = append(invalid, InvalidURL{File: file, Line: entry.line, URL: entry.URL, Error: err.Error()})
+				continue
+			}
+			entry.URL = stripQueryParams(entry.URL)
+			if first, ok := seen[entry.URL]; ok {
+				if !sameRequest(first.entry, entry) {
+					return nil, nil, nil, fmt.Errorf("%s:%d: %s is listed at %s:%d with a different method, headers, body or expect_body_regex; each URL is fetched once", file, entry.line, entry.URL, first.file, first.entry.line)
+				}
+				continue
+			}
+			seen[entry.URL] = firstEntry{entry, file}
+			urls = append(urls, entry.URL)
+			if entry.hasExtras() {
+				extras[entry.URL] = entry
+			}
+		}
+	}
+	return urls, extras, invalid, nil
+}
+
+// Append URLs that are not already in the list, without -strip-params
+// query parameters
+func mergeURLs(urls, more []string) []string {
+	seen := make(map[string]bool, len(urls))
+	for _, urlStr := range urls {
+		seen[urlStr] = true
+	}
+	for _, urlStr := range more {
+		urlStr = stripQueryParams(urlStr)
+		if !seen[urlStr] {
+			seen[urlStr] = true
+			urls = append(urls, urlStr)
+		}
+	}
+	return urls
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Write an input file into a temporary directory, returning its path
+func writeInput(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadCSVInput(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+		want    []urlEntry
+		err     string
+	}{
+		{
+			name:    "url only",
+			content: "url\nhttps://a.example/\nhttps://b.example/\n",
+			want:    []urlEntry{{URL: "https://a.example/", line: 2}, {URL: "https://b.example/", line: 3}},
+		},
+		{
+			name:    "metadata and tags",
+			content: "id, URL ,tags\n7,https://a.example/,\"news, sport\"\n",
+			want:    []urlEntry{{URL: "https://a.example/", Metadata: map[string]string{"id": "7"}, Tags: []string{"news", "sport"}, line: 2}},
+		},
+		{
+			name:    "blank and short rows skipped",
+			content: "name,url\nempty,\nshort\nfull,https://a.example/\n",
+			want:    []urlEntry{{URL: "https://a.example/", Metadata: map[string]string{"name": "full"}, line: 4}},
+		},
+		{
+			name:    "quoted field across lines",
+			content: "note,url\n\"two\nlines\",https://a.example/\n",
+			want:    []urlEntry{{URL: "https://a.example/", Metadata: map[string]string{"note": "two\nlines"}, line: 3}},
+		},
+		{name: "no url column", content: "id,link\n1,https://a.example/\n", err: "no url column"},
+		{name: "empty file", content: "", err: "reading CSV header"},
+	} {
+		entries, err := loadInputFile(writeInput(t, "urls.csv", tc.content))
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: got error %v, want %q", tc.name, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(entries, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, entries, tc.want)
+		}
+	}
+}
+
+func TestLoadJSONLInput(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+		want    []urlEntry
+		err     string
+	}{
+		{
+			name:    "plain",
+			content: "{\"url\": \"https://a.example/\"}\n\n{\"url\": \"https://b.example/\"}\n",
+			want:    []urlEntry{{URL: "https://a.example/", line: 1}, {URL: "https://b.example/", line: 3}},
+		},
+		{
+			name:    "request overrides",
+			content: `{"url": "https://a.example/api", "method": "post", "headers": {"X-Key": "k"}, "body": "{}", "tags": ["api, v2"], "metadata": {"team": "core"}}` + "\n",
+			want: []urlEntry{{
+				URL:      "https://a.example/api",
+				Method:   "POST",
+				Headers:  map[string]string{"X-Key": "k"},
+				Body:     "{}",
+				Tags:     []string{"api", "v2"},
+				Metadata: map[string]string{"team": "core"},
+				line:     1,
+			}},
+		},
+		{name: "missing url", content: "{\"method\": \"GET\"}\n", err: "urls.jsonl:1: missing url"},
+		{name: "bad json", content: "{\"url\": \"https://a.example/\"}\n{url}\n", err: "urls.jsonl:2"},
+		{name: "bad regex", content: "{\"url\": \"https://a.example/\", \"expect_body_regex\": \"(\"}\n", err: "expect_body_regex"},
+	} {
+		entries, err := loadInputFile(writeInput(t, "urls.jsonl", tc.content))
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: got error %v, want %q", tc.name, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(entries, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, entries, tc.want)
+		}
+	}
+}
+
+// A URL listed twice is crawled once when both entries make the same
+// request, and refused when they make different ones
+func TestLoadURLsFromFilesDuplicates(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		lines []string
+		urls  int
+		err   string
+	}{
+		{"same request", []string{`{"url": "https://a.example/"}`, `{"url": "https://a.example/", "method": "get"}`}, 1, ""},
+		{"same request, other tags", []string{`{"url": "https://a.example/", "tags": ["x"]}`, `{"url": "https://a.example/", "tags": ["y"]}`}, 1, ""},
+		{"different method", []string{`{"url": "https://a.example/"}`, `{"url": "https://a.example/", "method": "POST"}`}, 0, "urls.jsonl:2: https://a.example/ is listed at"},
+		{"different body", []string{`{"url": "https://a.example/", "method": "POST", "body": "a"}`, `{"url": "https://a.example/", "method": "POST", "body": "b"}`}, 0, "different method, headers, body"},
+		{"different headers", []string{`{"url": "https://a.example/", "headers": {"A": "1"}}`, `{"url": "https://a.example/", "headers": {"A": "2"}}`}, 0, "different method, headers, body"},
+	} {
+		path := writeInput(t, "urls.jsonl", strings.Join(tc.lines, "\n")+"\n")
+		urls, _, _, err := loadURLsFromFiles([]string{path})
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("%s: %v", tc.name, err)
+		case tc.err == "" && len(urls) != tc.urls:
+			t.Errorf("%s: got %d URLs, want %d", tc.name, len(urls), tc.urls)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.err)
+		}
+	}
+
+	// Across files, plain text and CSV entries make GET requests
+	text := writeInput(t, "urls.txt", "https://a.example/\n")
+	csv := writeInput(t, "urls.csv", "url,id\nhttps://a.example/,1\n")
+	if urls, _, _, err := loadURLsFromFiles([]string{text, csv}); err != nil || len(urls) != 1 {
+		t.Errorf("text and CSV: got %v, %v; want one URL", urls, err)
+	}
+	post := writeInput(t, "post.jsonl", `{"url": "https://a.example/", "method": "POST"}`+"\n")
+	if _, _, _, err := loadURLsFromFiles([]string{text, post}); err == nil {
+		t.Errorf("text and POST: accepted a URL listed with two methods")
+	}
+}
+
+func TestSampleFlagsConflict(t *testing.T) {
+	out, code := runCrawler(t, "-sample", "10%", "-sample-n", "5", "-input", writeInput(t, "urls.txt", "https://a.example/\n"))
+	if code != exitConfig || !strings.Contains(out, "-sample and -sample-n can't be combined") {
+		t.Errorf("got exit code %d, want %d, with output:\n%s", code, exitConfig, out)
+	}
+}
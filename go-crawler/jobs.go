@@ -0,0 +1,791 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Directory the job server keeps each job's files in by default
+const defaultJobsDir = "crawler-jobs"
+
+// Address the job server listens on by default: only this machine, since
+// the API can make the crawler fetch any URL
+const defaultJobServerAddr = "localhost:8080"
+
+// Job names double as directory names, so they are kept to safe characters
+var jobNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Crawl flags the server sets for a job, or that jobs can't use as they share
+// its terminal and port. The server's CRAWLER_ variables for them are not
+// passed on to jobs.
+var jobReservedFlags = []string{"output", "config", "serve", "container", "tui"}
+
+// Crawl flags a job may set, in its args or its config. Anything else is
+// refused: flags naming files, such as -input, -failures-file or -history,
+// would let an API client read or write any path the server can, and flags
+// sending results elsewhere, such as -sink or -push-gateway, are for the
+// server's operator to set in its CRAWLER_ environment, which jobs inherit.
+var jobAllowedFlags = map[string]bool{
+	"audit": true, "backoff-max": true, "backoff-threshold": true, "bloom-capacity": true, "bloom-fp-rate": true,
+	"body-digest": true, "capture-headers": true, "cert-expiry-warn": true, "check-hreflang": true,
+	"circuit-breaker": true, "circuit-cooldown": true, "connect-timeout": true, "deadline": true, "depth": true,
+	"discover-sitemaps": true, "duplicate-distance": true, "expect-body-regex": true, "fail-fast-rate": true,
+	"fail-fast-window": true, "failure-threshold": true, "field-names": true, "follow-meta-refresh": true,
+	"grace-period": true, "header-timeout": true, "large-uncompressed-kb": true, "limit": true, "max-pages": true,
+	"max-rps": true, "min-time": true, "near-duplicates": true, "offset": true, "only-failures": true,
+	"only-status": true, "only-tag": true, "pagerank": true, "parsers": true, "pre-resolve": true,
+	"respect-robots": true, "retry-after-attempts": true, "retry-after-max": true, "robots-cache-size": true,
+	"robots-ttl": true, "sample": true, "sample-n": true, "seed": true, "shuffle": true, "sitemap": true,
+	"sitemap-limit": true, "soft-404": true, "soft-404-calibrate": true, "sort": true, "stream": true,
+	"strip-params": true, "success-status": true, "time-unit": true, "timeout": true, "tls-timeout": true,
+	"workers": true,
+}
+
+// Allowed flags that take a URL or a file, of which a job may only give URLs
+var jobURLFlags = map[string]bool{"sitemap": true}
+
+// Report whether a flag value is an http:// or https:// URL
+func isHTTPURL(value string) bool {
+	return strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://")
+}
+
+// JobRequest is the body of POST /jobs
+type JobRequest struct {
+	Name   string                 `json:"name"`
+	Args   []string               `json:"args,omitempty"`   // crawl flags
+	Config map[string]interface{} `json:"config,omitempty"` // config file contents, including domains and rewrites
+	URLs   []string               `json:"urls,omitempty"`   // crawled along with any -input in args
+}
+
+// Job states. A job waits in the queue until a slot frees up, then runs
+// until its crawl exits or it is cancelled.
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobCompleted = "completed"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+// Report whether a job state is final
+func jobFinished(state string) bool {
+	return state == jobCompleted || state == jobFailed || state == jobCancelled
+}
+
+// Job is a crawl run by the job server, as the API reports it
+type Job struct {
+	Name        string     `json:"name"`
+	Args        []string   `json:"args"`
+	State       string     `json:"state"`
+	SubmittedBy string     `json:"submitted_by,omitempty"` // API key name or client certificate
+	ExitCode    *int       `json:"exit_code,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	SubmittedAt time.Time  `json:"submitted_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	Summary     *Summary   `json:"summary,omitempty"`
+}
+
+// JobList is a page of GET /jobs
+type JobList struct {
+	Jobs   []Job `json:"jobs"`
+	Total  int   `json:"total"` // jobs matching the state filter
+	Offset int   `json:"offset"`
+	Limit  int   `json:"limit"`
+}
+
+// Page sizes of GET /jobs
+const (
+	defaultJobPage = 50
+	maxJobPage     = 500
+)
+
+// jobServer runs named crawl jobs side by side, queueing those beyond
+// maxJobs. Each job is a crawl process of its own, so flags, config
+// sections such as per-domain limits, the rate limiter, the robots.txt cache
+// and the circuit breaker are never shared between jobs.
+type jobServer struct {
+	exe       string
+	dir       string
+	maxJobs   int
+	maxQueued int
+	store     *jobStore // nil keeps jobs in memory only
+	retention retention // of finished jobs
+
+	mu      sync.Mutex
+	jobs    map[string]*serverJob // a nil entry reserves a name while its job is prepared
+	order   []string
+	seq     int // of the last job submitted
+	queue   []*serverJob
+	running int
+	closed  bool // shutting down; no more jobs start
+	wg      sync.WaitGroup
+}
+
+// serverJob is a job and the process running it
+type serverJob struct {
+	Job
+	seq       int
+	dir       string
+	args      []string // crawl arguments, with the files the server wrote
+	cmd       *exec.Cmd
+	cancelled bool // cancelled while running; the crawl is saving its results
+}
+
+func newJobServer(exe, dir string, maxJobs, maxQueued int, store *jobStore, retention retention) *jobServer {
+	return &jobServer{exe: exe, dir: dir, maxJobs: maxJobs, maxQueued: maxQueued, store: store, retention: retention, jobs: make(map[string]*serverJob)}
+}
+
+// Take over the jobs in the store: queued jobs wait for a slot again, and
+// jobs the previous server left running have failed. Returns how many jobs
+// were loaded and how many of them are queued.
+func (s *jobServer) restore() (int, int, error) {
+	jobs, err := s.store.load()
+	if err != nil {
+		return 0, 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range jobs {
+		s.jobs[job.Name] = job
+		s.order = append(s.order, job.Name)
+		s.seq = max(s.seq, job.seq)
+		switch job.State {
+		case jobQueued:
+			s.queue = append(s.queue, job)
+		case jobRunning:
+			now := time.Now().UTC()
+			job.State = jobFailed
+			job.Error = errJobInterrupted.Error()
+			job.FinishedAt = &now
+			s.persist(job)
+		}
+	}
+	queued := len(s.queue)
+	s.prune()
+	s.dispatch()
+	return len(jobs), queued, nil
+}
+
+// Write a job's current state to the store. Called with s.mu held, so
+// writes reach the store in the order the changes were made.
+func (s *jobServer) persist(job *serverJob) {
+	if s.store == nil {
+		return
+	}
+	if err := s.store.save(job); err != nil {
+		fmt.Printf("Warning: saving job %s to the store: %s\n", job.Name, err)
+	}
+}
+
+// Name of the flag an argument sets, or "" when it isn't a flag
+func argFlagName(arg string) string {
+	if !strings.HasPrefix(arg, "-") || arg == "-" || arg == "--" {
+		return ""
+	}
+	name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+	return name
+}
+
+// Check a job request before anything is written for it
+func validateJobRequest(req JobRequest) error {
+	if !jobNameRegex.MatchString(req.Name) {
+		return fmt.Errorf("invalid job name %q: use letters, digits, '.', '_' and '-', up to 64 characters", req.Name)
+	}
+	// Flags may follow URLs, and even --, so every argument is checked
+	for i := 0; i < len(req.Args); i++ {
+		name := argFlagName(req.Args[i])
+		if name == "" {
+			continue
+		}
+		if !jobAllowedFlags[name] {
+			return fmt.Errorf("-%s can't be set for a job", name)
+		}
+		if jobURLFlags[name] {
+			_, value, inline := strings.Cut(req.Args[i], "=")
+			if !inline && i+1 < len(req.Args) {
+				i++
+				value = req.Args[i]
+			}
+			if !isHTTPURL(value) {
+				return fmt.Errorf("-%s takes only http:// or https:// URLs in a job", name)
+			}
+		}
+	}
+	for key, value := range req.Config {
+		if isConfigSection(key) {
+			continue
+		}
+		name := strings.ReplaceAll(key, "_", "-")
+		if !jobAllowedFlags[name] {
+			return fmt.Errorf("config key %q can't be set for a job", key)
+		}
+		if jobURLFlags[name] {
+			values, ok := value.([]interface{})
+			if !ok {
+				values = []interface{}{value}
+			}
+			for _, v := range values {
+				if s, ok := v.(string); !ok || !isHTTPURL(s) {
+					return fmt.Errorf("config key %q takes only http:// or https:// URLs in a job", key)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Submit a job. It starts right away when a slot is free and is queued
+// otherwise. On error the returned status says why it was refused.
+func (s *jobServer) submit(req JobRequest, client string) (Job, int, error) {
+	if err := validateJobRequest(req); err != nil {
+		return Job{}, http.StatusBadRequest, err
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return Job{}, http.StatusServiceUnavailable, errors.New("server is shutting down")
+	}
+	if _, taken := s.jobs[req.Name]; taken {
+		s.mu.Unlock()
+		return Job{}, http.StatusConflict, fmt.Errorf("job %s already exists", req.Name)
+	}
+	if s.running >= s.maxJobs && len(s.queue) >= s.maxQueued {
+		s.mu.Unlock()
+		return Job{}, http.StatusTooManyRequests, fmt.Errorf("%d jobs are running and %d queued", s.running, len(s.queue))
+	}
+	s.jobs[req.Name] = nil
+	s.seq++
+	seq := s.seq
+	s.mu.Unlock()
+
+	job, status, err := s.prepare(req)
+	if err == nil {
+		job.SubmittedBy = client
+		job.seq = seq
+		// A job the store doesn't have would be lost at the next restart
+		if s.store != nil {
+			if err = s.store.save(job); err != nil {
+				os.RemoveAll(job.dir)
+				status = http.StatusInternalServerError
+			}
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		delete(s.jobs, req.Name)
+		return Job{}, status, err
+	}
+	s.jobs[req.Name] = job
+	s.order = append(s.order, req.Name)
+	s.queue = append(s.queue, job)
+	s.dispatch()
+	return job.Job, http.StatusCreated, nil
+}
+
+// Write a job's files and check its flags and config
+func (s *jobServer) prepare(req JobRequest) (*serverJob, int, error) {
+	dir := filepath.Join(s.dir, req.Name)
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, http.StatusConflict, fmt.Errorf("job directory %s already exists", dir)
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	removeDir := true
+	defer func() {
+		if removeDir {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	args := append([]string(nil), req.Args...)
+	if len(req.URLs) > 0 {
+		urlsFile := filepath.Join(dir, "urls.txt")
+		if err := os.WriteFile(urlsFile, []byte(strings.Join(req.URLs, "\n")+"\n"), 0o644); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		args = append(args, "-input", urlsFile)
+	}
+	if req.Config != nil {
+		data, err := json.MarshalIndent(req.Config, "", "  ")
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		configFile := filepath.Join(dir, "config.json")
+		if err := os.WriteFile(configFile, data, 0o644); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		args = append(args, "-config", configFile)
+	}
+
+	// Bad flags and config are refused now rather than failing the job
+	check := exec.Command(s.exe, append([]string{"config", "check"}, args...)...)
+	check.Env = jobEnv()
+	if output, err := check.CombinedOutput(); err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("%s", strings.TrimSpace(string(output)))
+	}
+	removeDir = false
+
+	return &serverJob{
+		Job:  Job{Name: req.Name, Args: append([]string{}, req.Args...), State: jobQueued, SubmittedAt: time.Now().UTC()},
+		dir:  dir,
+		args: append(args, "-output", filepath.Join(dir, "results.json")),
+	}, 0, nil
+}
+
+// Start queued jobs while there are free slots. Called with s.mu held.
+func (s *jobServer) dispatch() {
+	for !s.closed && s.running < s.maxJobs && len(s.queue) > 0 {
+		job := s.queue[0]
+		s.queue = s.queue[1:]
+		now := time.Now().UTC()
+		job.StartedAt = &now
+		if err := s.run(job); err != nil {
+			job.State = jobFailed
+			job.Error = err.Error()
+			job.FinishedAt = &now
+			s.persist(job)
+			continue
+		}
+		job.State = jobRunning
+		s.running++
+		s.persist(job)
+	}
+}
+
+// Start a job's crawl process, logging its output to the job directory
+func (s *jobServer) run(job *serverJob) error {
+	logFile, err := os.Create(filepath.Join(job.dir, "log.txt"))
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(s.exe, append([]string{"crawl"}, job.args...)...)
+	cmd.Env = jobEnv()
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		return err
+	}
+	job.cmd = cmd
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		err := cmd.Wait()
+		logFile.Close()
+		s.finish(job, err)
+	}()
+	return nil
+}
+
+// Environment of a job's processes, without the variables for flags the
+// server sets itself
+func jobEnv() []string {
+	var env []string
+	for _, entry := range os.Environ() {
+		key, _, _ := strings.Cut(entry, "=")
+		reserved := false
+		for _, name := range jobReservedFlags {
+			if key == envPrefix+strings.ToUpper(name) {
+				reserved = true
+			}
+		}
+		if !reserved {
+			env = append(env, entry)
+		}
+	}
+	return env
+}
+
+// Record how a job's crawl process ended and start the next queued job. A
+// crawl with failed fetches or partial results still completed; its results
+// say what went wrong.
+func (s *jobServer) finish(job *serverJob, err error) {
+	code := exitOK
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		code = exitError
+	}
+	var summary *Summary
+	if data, readErr := os.ReadFile(filepath.Join(job.dir, "results.json")); readErr == nil {
+		var combined CombinedResults
+		if json.Unmarshal(data, &combined) == nil {
+			combined.toSeconds()
+			summary = &combined.Summary
+		}
+		if s.store != nil {
+			if err := s.store.saveResults(job.Name, data); err != nil {
+				fmt.Printf("Warning: saving the results of job %s to the store: %s\n", job.Name, err)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	now := time.Now().UTC()
+	job.FinishedAt = &now
+	job.ExitCode = &code
+	job.Summary = summary
+	switch {
+	case job.cancelled:
+		job.State = jobCancelled
+	case code == exitOK || code == exitFailures || code == exitPartial:
+		job.State = jobCompleted
+	default:
+		job.State = jobFailed
+		job.Error = fmt.Sprintf("crawl exited with status %d; see its log", code)
+	}
+	s.persist(job)
+	s.prune()
+	s.dispatch()
+}
+
+// Cancel a job. A queued job is dropped from the queue; a running crawl is
+// interrupted, so it stops and saves its partial results, and the job is
+// cancelled once it exits.
+func (s *jobServer) cancel(name string) (Job, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.jobs[name]
+	if job == nil {
+		return Job{}, http.StatusNotFound, fmt.Errorf("no job named %q", name)
+	}
+	switch {
+	case job.State == jobQueued:
+		for i, queued := range s.queue {
+			if queued == job {
+				s.queue = append(s.queue[:i], s.queue[i+1:]...)
+				break
+			}
+		}
+		now := time.Now().UTC()
+		job.State = jobCancelled
+		job.FinishedAt = &now
+		s.persist(job)
+		s.prune()
+		return job.Job, http.StatusOK, nil
+	case job.State == jobRunning:
+		if !job.cancelled {
+			job.cancelled = true
+			job.cmd.Process.Signal(os.Interrupt)
+		}
+		return job.Job, http.StatusAccepted, nil
+	}
+	return job.Job, http.StatusConflict, fmt.Errorf("job %s is already %s", name, job.State)
+}
+
+// Look a job up, returning a copy that is safe to encode
+func (s *jobServer) lookup(name string) (Job, string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.jobs[name]
+	if job == nil {
+		return Job{}, "", false
+	}
+	return job.Job, job.dir, true
+}
+
+// A page of the jobs in a state ("" for all), in the order submitted
+func (s *jobServer) list(state string, offset, limit int) JobList {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := JobList{Jobs: []Job{}, Offset: offset, Limit: limit}
+	for _, name := range s.order {
+		job := s.jobs[name]
+		if state != "" && job.State != state {
+			continue
+		}
+		if list.Total >= offset && len(list.Jobs) < limit {
+			list.Jobs = append(list.Jobs, job.Job)
+		}
+		list.Total++
+	}
+	return list
+}
+
+// Stop starting jobs and pass a signal on to every running crawl. Queued
+// jobs are left queued.
+func (s *jobServer) stop(sig os.Signal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, job := range s.jobs {
+		if job != nil && job.State == jobRunning {
+			job.cmd.Process.Signal(sig)
+		}
+	}
+}
+
+// Parse the state, offset and limit of a job listing
+func parseJobListQuery(query url.Values) (string, int, int, error) {
+	state := query.Get("state")
+	switch state {
+	case "", jobQueued, jobRunning, jobCompleted, jobFailed, jobCancelled:
+	default:
+		return "", 0, 0, fmt.Errorf("unknown state %q", state)
+	}
+	offset, limit := 0, defaultJobPage
+	if value := query.Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return "", 0, 0, fmt.Errorf("invalid offset %q", value)
+		}
+		offset = n
+	}
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxJobPage {
+			return "", 0, 0, fmt.Errorf("invalid limit %q: use 1 to %d", value, maxJobPage)
+		}
+		limit = n
+	}
+	return state, offset, limit, nil
+}
+
+// Error body of the job API
+type jobError struct {
+	Error string `json:"error"`
+}
+
+// Routes of the job API, behind auth when it is set up, and the health
+// probes
+func jobServerHandler(s *jobServer, health *serverHealth, auth *apiAuth) http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("/jobs", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			state, offset, limit, err := parseJobListQuery(r.URL.Query())
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, jobError{err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, s.list(state, offset, limit))
+		case http.MethodPost:
+			var req JobRequest
+			decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10<<20))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&req); err != nil {
+				writeJSON(w, http.StatusBadRequest, jobError{err.Error()})
+				return
+			}
+			job, status, err := s.submit(req, apiClient(r))
+			if err != nil {
+				writeJSON(w, status, jobError{err.Error()})
+				return
+			}
+			writeJSON(w, status, job)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeJSON(w, http.StatusMethodNotAllowed, jobError{"method not allowed"})
+		}
+	})
+	api.HandleFunc("/jobs/", func(w http.ResponseWriter, r *http.Request) {
+		name, part, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+		allow := http.MethodGet
+		if part == "cancel" {
+			allow = http.MethodPost
+		}
+		if r.Method != allow {
+			w.Header().Set("Allow", allow)
+			writeJSON(w, http.StatusMethodNotAllowed, jobError{"method not allowed"})
+			return
+		}
+		if part == "cancel" {
+			job, status, err := s.cancel(name)
+			if err != nil {
+				writeJSON(w, status, jobError{err.Error()})
+				return
+			}
+			writeJSON(w, status, job)
+			return
+		}
+		job, dir, ok := s.lookup(name)
+		if !ok {
+			writeJSON(w, http.StatusNotFound, jobError{fmt.Sprintf("no job named %q", name)})
+			return
+		}
+		switch part {
+		case "":
+			writeJSON(w, http.StatusOK, job)
+		case "results":
+			// The file is incomplete until the crawl has saved it
+			if !jobFinished(job.State) {
+				writeJSON(w, http.StatusConflict, jobError{"job is " + job.State})
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if _, err := os.Stat(filepath.Join(dir, "results.json")); err == nil {
+				http.ServeFile(w, r, filepath.Join(dir, "results.json"))
+				return
+			}
+			// The job directory may be gone, or on another machine
+			if s.store != nil {
+				data, err := s.store.results(name)
+				if err != nil {
+					writeJSON(w, http.StatusInternalServerError, jobError{err.Error()})
+					return
+				}
+				if data != nil {
+					w.Write(data)
+					return
+				}
+			}
+			writeJSON(w, http.StatusNotFound, jobError{"job saved no results"})
+		case "log":
+			if job.StartedAt == nil {
+				writeJSON(w, http.StatusConflict, jobError{"job has not started"})
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			http.ServeFile(w, r, filepath.Join(dir, "log.txt"))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	mux := http.NewServeMux()
+	if auth != nil {
+		mux.Handle("/jobs", auth.wrap(api))
+		mux.Handle("/jobs/", auth.wrap(api))
+	} else {
+		mux.Handle("/jobs", api)
+		mux.Handle("/jobs/", api)
+	}
+	health.register(mux)
+	return mux
+}
+
+// Run the server subcommand: accept named crawl jobs over HTTP and run them
+// side by side until interrupted
+func runJobServer(args []string) int {
+	fs := flag.NewFlagSet("server", flag.ExitOnError)
+	addr := fs.String("addr", defaultJobServerAddr, "Address to serve the job API on")
+	dir := fs.String("dir", defaultJobsDir, "Directory for each job's config, log and results")
+	maxJobs := fs.Int("max-jobs", 4, "Jobs that may run at once; more wait in the queue")
+	maxQueued := fs.Int("max-queued", 100, "Jobs that may wait in the queue; more are refused with 429")
+	apiKeysFile := fs.String("api-keys", "", "JSON file of API keys allowed to use the job API, with per-key rate limits")
+	tlsCert := fs.String("tls-cert", "", "Certificate file to serve the API over HTTPS with")
+	tlsKey := fs.String("tls-key", "", "Private key file of -tls-cert")
+	clientCA := fs.String("client-ca", "", "CA certificate file; job API clients must present a certificate it signed (mTLS)")
+	storeTarget := fs.String("store", "", "Keep jobs and their results in this SQLite file, or a postgres:// database, across restarts")
+	keepJobs := fs.Int("keep-jobs", 0, "Keep only this many of the latest finished jobs, deleting older ones with their files (0 keeps all)")
+	keepDays := fs.Int("keep-days", 0, "Delete finished jobs, with their files, this many days after they finish (0 keeps all)")
+	noAuth := fs.Bool("no-auth", false, "Serve the job API without authentication on an address other machines can reach")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: crawler server [-addr %s] [-dir %s] [-max-jobs N] [-max-queued N] [-api-keys keys.json] [-tls-cert cert.pem -tls-key key.pem [-client-ca ca.pem]]\n", defaultJobServerAddr, defaultJobsDir)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 || *maxJobs < 1 || *maxQueued < 0 || *keepJobs < 0 || *keepDays < 0 {
+		fs.Usage()
+		return exitConfig
+	}
+
+	var keys []apiKey
+	if *apiKeysFile != "" {
+		var err error
+		if keys, err = loadAPIKeys(*apiKeysFile); err != nil {
+			fmt.Printf("Error loading API keys: %s\n", err)
+			return exitConfig
+		}
+	}
+	if (*tlsCert == "") != (*tlsKey == "") || (*clientCA != "" && *tlsCert == "") {
+		fmt.Printf("Error: -tls-cert and -tls-key go together, and -client-ca needs them\n")
+		return exitConfig
+	}
+	var auth *apiAuth
+	if len(keys) > 0 || *clientCA != "" {
+		auth = newAPIAuth(keys, *clientCA != "")
+	} else if !*noAuth && !isLoopbackAddr(*addr) {
+		// Anyone who can reach the API can make the crawler fetch any URL
+		fmt.Printf("Error: serving the job API on %s needs -api-keys or -client-ca; use -no-auth to serve it unauthenticated\n", *addr)
+		return exitConfig
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Printf("Error getting executable path: %s\n", err)
+		return exitError
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		fmt.Printf("Error creating job directory: %s\n", err)
+		return exitError
+	}
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Printf("Error starting job server: %s\n", err)
+		return exitConfig
+	}
+	scheme := "http"
+	if *tlsCert != "" {
+		config, err := serverTLSConfig(*tlsCert, *tlsKey, *clientCA)
+		if err != nil {
+			listener.Close()
+			fmt.Printf("Error setting up TLS: %s\n", err)
+			return exitConfig
+		}
+		listener = tls.NewListener(listener, config)
+		scheme = "https"
+	}
+
+	// Catch signals before any job exists, so none is lost
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	var store *jobStore
+	if *storeTarget != "" {
+		if store, err = openJobStore(*storeTarget); err != nil {
+			listener.Close()
+			fmt.Printf("Error opening job store: %s\n", err)
+			return exitConfig
+		}
+	}
+	jobs := newJobServer(exe, *dir, *maxJobs, *maxQueued, store, retention{runs: *keepJobs, days: *keepDays})
+	health := &serverHealth{info: newBuildInfo(newRunID(), time.Now())}
+	health.watchSignals()
+	server := &http.Server{Handler: jobServerHandler(jobs, health, auth)}
+	if store != nil {
+		loaded, queued, err := jobs.restore()
+		if err != nil {
+			listener.Close()
+			fmt.Printf("Error loading jobs from the store: %s\n", err)
+			return exitError
+		}
+		fmt.Printf("Loaded %d jobs from the store, %d of them queued\n", loaded, queued)
+	}
+	if *keepDays > 0 {
+		go jobs.pruneEvery(time.Hour)
+	}
+	go server.Serve(listener)
+	fmt.Printf("Job server listening on %s://%s/jobs\n", scheme, listener.Addr())
+
+	// Running crawls stop and save their results, as they would on their own
+	sig := <-signals
+	fmt.Printf("Stopping: waiting for running jobs to save their results\n")
+	jobs.stop(sig)
+	jobs.wg.Wait()
+	server.Close()
+	return exitOK
+}
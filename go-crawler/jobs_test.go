@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateJobRequest(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		req  JobRequest
+		err  string // "" when the request is accepted
+	}{
+		{"plain", JobRequest{Name: "ok", Args: []string{"-workers", "4", "-pagerank", "-timeout=5s"}}, ""},
+		{"sitemap URL", JobRequest{Name: "ok", Args: []string{"-sitemap", "https://example.com/sitemap.xml"}}, ""},
+		{"config", JobRequest{Name: "ok", Config: map[string]interface{}{"max_rps": 5, "sitemap": []interface{}{"http://example.com/s.xml"}, "domains": map[string]interface{}{}}}, ""},
+		{"failures file", JobRequest{Name: "x", Args: []string{"-failures-file", "/tmp/x"}}, "-failures-file can't be set"},
+		{"input", JobRequest{Name: "x", Args: []string{"--input=/etc/passwd"}}, "-input can't be set"},
+		{"history after URL", JobRequest{Name: "x", Args: []string{"https://example.com/", "--", "-history", "/tmp/h.db"}}, "-history can't be set"},
+		{"output", JobRequest{Name: "x", Args: []string{"-output", "/tmp/r.json"}}, "-output can't be set"},
+		{"sink", JobRequest{Name: "x", Args: []string{"-sink", "es://localhost:9200/x"}}, "-sink can't be set"},
+		{"sitemap file", JobRequest{Name: "x", Args: []string{"-sitemap", "/etc/sitemap.xml"}}, "only http:// or https:// URLs"},
+		{"sitemap file inline", JobRequest{Name: "x", Args: []string{"-sitemap=file.xml"}}, "only http:// or https:// URLs"},
+		{"config path", JobRequest{Name: "x", Config: map[string]interface{}{"frontier_dir": "/tmp"}}, `config key "frontier_dir" can't be set`},
+		{"config sitemap file", JobRequest{Name: "x", Config: map[string]interface{}{"sitemap": []interface{}{"/etc/s.xml"}}}, "only http:// or https:// URLs"},
+		{"bad name", JobRequest{Name: "../x"}, "invalid job name"},
+	} {
+		err := validateJobRequest(tc.req)
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("%s: refused: %v", tc.name, err)
+		case tc.err != "" && err == nil:
+			t.Errorf("%s: accepted, want %q", tc.name, tc.err)
+		case tc.err != "" && !strings.Contains(err.Error(), tc.err):
+			t.Errorf("%s: got %q, want %q", tc.name, err, tc.err)
+		}
+	}
+}
+
+// A job naming a file outside its directory is refused before anything is
+// written for it
+func TestJobWithPathFlagIsRefused(t *testing.T) {
+	dir := t.TempDir()
+	jobs := newJobServer(os.Args[0], dir, 1, 1, nil, retention{})
+	health := &serverHealth{info: newBuildInfo(newRunID(), time.Now())}
+	server := httptest.NewServer(jobServerHandler(jobs, health, nil))
+	defer server.Close()
+
+	body := `{"name": "escape", "args": ["-failures-file", "/tmp/x"], "urls": ["http://127.0.0.1:1/"]}`
+	resp, err := http.Post(server.URL+"/jobs", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("got status %d, want 400", resp.StatusCode)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape")); !os.IsNotExist(err) {
+		t.Errorf("job directory written for a refused job: %v", err)
+	}
+}
+
+// Every flag jobs may set is a crawl flag, so a renamed flag isn't silently
+// dropped from the allowlist
+func TestJobAllowedFlagsExist(t *testing.T) {
+	out, _ := runCrawler(t, "crawl", "-h")
+	flags := make(map[string]bool)
+	for _, f := range parseFlagDefaults(strings.NewReader(out)) {
+		flags[f.name] = true
+	}
+	for name := range jobAllowedFlags {
+		if !flags[name] {
+			t.Errorf("-%s is not a crawl flag", name)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Table of the job store: one row per job, with its results file once it
+// has finished. The SQL is understood by both SQLite and Postgres.
+const jobStoreSchema = `
+CREATE TABLE IF NOT EXISTS jobs (
+	name TEXT PRIMARY KEY,
+	seq INTEGER NOT NULL,
+	state TEXT NOT NULL,
+	args TEXT NOT NULL,
+	crawl_args TEXT NOT NULL,
+	dir TEXT NOT NULL,
+	submitted_by TEXT NOT NULL,
+	submitted_at TEXT NOT NULL,
+	started_at TEXT,
+	finished_at TEXT,
+	exit_code INTEGER,
+	error TEXT NOT NULL,
+	summary TEXT,
+	results TEXT
+);
+`
+
+// jobStore keeps the job server's jobs in SQLite or Postgres, so they
+// survive restarts. Like the history store it drives the command-line tool,
+// sqlite3 or psql, rather than a database driver.
+type jobStore struct {
+	tool   string // sqlite3 or psql
+	target string // database file or connection URI
+}
+
+// Open the job store named by -store: a postgres:// URI or a SQLite file
+func openJobStore(target string) (*jobStore, error) {
+	store := &jobStore{tool: "sqlite3", target: target}
+	if strings.HasPrefix(target, "postgres://") || strings.HasPrefix(target, "postgresql://") {
+		store.tool = "psql"
+	}
+	if _, err := exec.LookPath(store.tool); err != nil {
+		return nil, fmt.Errorf("the job store needs the %s command-line tool on the PATH", store.tool)
+	}
+	if err := store.exec(jobStoreSchema); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Command running SQL against the store, stopping at the first error
+func (s *jobStore) command(args ...string) *exec.Cmd {
+	if s.tool == "psql" {
+		return exec.Command("psql", append([]string{"-X", "-q", "-v", "ON_ERROR_STOP=1", "-d", s.target}, args...)...)
+	}
+	return exec.Command("sqlite3", append([]string{"-bail", s.target}, args...)...)
+}
+
+// Run a SQL script
+func (s *jobStore) exec(script string) error {
+	cmd := s.command()
+	cmd.Stdin = strings.NewReader(script)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %s", s.tool, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Run a query and decode its rows from a JSON array
+func (s *jobStore) query(sql string, rows interface{}) error {
+	var cmd *exec.Cmd
+	if s.tool == "psql" {
+		cmd = s.command("-t", "-A", "-c", "SELECT coalesce(json_agg(q), '[]'::json) FROM ("+sql+") q")
+	} else {
+		cmd = exec.Command("sqlite3", "-bail", "-json", s.target, sql)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("%s: %s", s.tool, strings.TrimSpace(stderr.String()))
+	}
+	// sqlite3 prints nothing at all for no rows
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil
+	}
+	return json.Unmarshal(out, rows)
+}
+
+// Quote a value as a SQL literal, or NULL when it is nil
+func sqlNullable(value *string) string {
+	if value == nil {
+		return "NULL"
+	}
+	return sqlQuote(*value)
+}
+
+// Layout of the times in the store: UTC with every digit of the
+// nanoseconds, so that they compare as text in time order
+const storedTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// Format a time for the store, or nil when it isn't set
+func storedTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	value := t.UTC().Format(storedTimeLayout)
+	return &value
+}
+
+// Parse a time read back from the store
+func parseStoredTime(value *string) *time.Time {
+	if value == nil {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, *value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// jobRow is a row of the jobs table, less the results
+type jobRow struct {
+	Name        string  `json:"name"`
+	Seq         int     `json:"seq"`
+	State       string  `json:"state"`
+	Args        string  `json:"args"`
+	CrawlArgs   string  `json:"crawl_args"`
+	Dir         string  `json:"dir"`
+	SubmittedBy string  `json:"submitted_by"`
+	SubmittedAt string  `json:"submitted_at"`
+	StartedAt   *string `json:"started_at"`
+	FinishedAt  *string `json:"finished_at"`
+	ExitCode    *int    `json:"exit_code"`
+	Error       string  `json:"error"`
+	Summary     *string `json:"summary"`
+}
+
+// Insert or update a job, leaving its results alone
+func (s *jobStore) save(job *serverJob) error {
+	args, _ := json.Marshal(job.Args)
+	crawlArgs, _ := json.Marshal(job.args)
+	var summary *string
+	if job.Summary != nil {
+		data, err := json.Marshal(job.Summary)
+		if err != nil {
+			return err
+		}
+		value := string(data)
+		summary = &value
+	}
+	exitCode := "NULL"
+	if job.ExitCode != nil {
+		exitCode = fmt.Sprint(*job.ExitCode)
+	}
+	return s.exec(fmt.Sprintf(`INSERT INTO jobs (name, seq, state, args, crawl_args, dir, submitted_by, submitted_at, started_at, finished_at, exit_code, error, summary)
+VALUES (%s, %d, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s)
+ON CONFLICT (name) DO UPDATE SET state = excluded.state, started_at = excluded.started_at, finished_at = excluded.finished_at,
+	exit_code = excluded.exit_code, error = excluded.error, summary = excluded.summary;
+`, sqlQuote(job.Name), job.seq, sqlQuote(job.State), sqlQuote(string(args)), sqlQuote(string(crawlArgs)), sqlQuote(job.dir),
+		sqlQuote(job.SubmittedBy), sqlQuote(job.SubmittedAt.UTC().Format(storedTimeLayout)), sqlNullable(storedTime(job.StartedAt)),
+		sqlNullable(storedTime(job.FinishedAt)), exitCode, sqlQuote(job.Error), sqlNullable(summary)))
+}
+
+// Store a finished job's results file
+func (s *jobStore) saveResults(name string, data []byte) error {
+	return s.exec(fmt.Sprintf("UPDATE jobs SET results = %s WHERE name = %s;\n", sqlQuote(string(data)), sqlQuote(name)))
+}
+
+// A job's stored results file, nil when there is none
+func (s *jobStore) results(name string) ([]byte, error) {
+	var rows []struct {
+		Results *string `json:"results"`
+	}
+	if err := s.query("SELECT results FROM jobs WHERE name = "+sqlQuote(name), &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 || rows[0].Results == nil {
+		return nil, nil
+	}
+	return []byte(*rows[0].Results), nil
+}
+
+// Load every job in the order submitted
+func (s *jobStore) load() ([]*serverJob, error) {
+	var rows []jobRow
+	if err := s.query("SELECT name, seq, state, args, crawl_args, dir, submitted_by, submitted_at, started_at, finished_at, exit_code, error, summary FROM jobs ORDER BY seq", &rows); err != nil {
+		return nil, err
+	}
+	jobs := make([]*serverJob, 0, len(rows))
+	for _, row := range rows {
+		job := &serverJob{
+			Job: Job{
+				Name:        row.Name,
+				State:       row.State,
+				SubmittedBy: row.SubmittedBy,
+				StartedAt:   parseStoredTime(row.StartedAt),
+				FinishedAt:  parseStoredTime(row.FinishedAt),
+				ExitCode:    row.ExitCode,
+				Error:       row.Error,
+			},
+			seq: row.Seq,
+			dir: row.Dir,
+		}
+		if submitted := parseStoredTime(&row.SubmittedAt); submitted != nil {
+			job.SubmittedAt = *submitted
+		}
+		if err := json.Unmarshal([]byte(row.Args), &job.Args); err != nil {
+			return nil, fmt.Errorf("job %s: args: %w", row.Name, err)
+		}
+		if err := json.Unmarshal([]byte(row.CrawlArgs), &job.args); err != nil {
+			return nil, fmt.Errorf("job %s: crawl_args: %w", row.Name, err)
+		}
+		if row.Summary != nil {
+			job.Summary = &Summary{}
+			if err := json.Unmarshal([]byte(*row.Summary), job.Summary); err != nil {
+				return nil, fmt.Errorf("job %s: summary: %w", row.Name, err)
+			}
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Error for jobs the previous server left running: its crawl was stopped or
+// lost with it
+var errJobInterrupted = errors.New("the server stopped while the job was running")
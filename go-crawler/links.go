@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var hrefRegex = regexp.MustCompile(`(?i)<a\s[^>]*?href\s*=\s*["']([^"']+)["']`)
+
+// Extract absolute, normalized http(s) links from HTML content
+func extractLinks(body string, base *url.URL) []string {
+	var links []string
+	seen := make(map[string]bool)
+
+	for _, match := range hrefRegex.FindAllStringSubmatch(body, -1) {
+		ref, err := url.Parse(strings.TrimSpace(match[1]))
+		if err != nil {
+			continue
+		}
+
+		link, err := normalizeURL(base.ResolveReference(ref).String())
+		if err != nil || seen[link] {
+			continue
+		}
+
+		seen[link] = true
+		links = append(links, link)
+	}
+
+	return links
+}
+
+// Normalize a URL so equivalent forms dedupe to the same string. Scheme and
+// host are lowercased, default ports, fragments and -strip-params query
+// parameters are dropped, and an empty path becomes "/".
+func normalizeURL(rawURL string) (string, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return "", &url.Error{Op: "normalize", URL: rawURL, Err: errUnsupportedScheme}
+	}
+
+	parsedURL.Scheme = strings.ToLower(parsedURL.Scheme)
+	parsedURL.Host = strings.ToLower(parsedURL.Host)
+	if port := parsedURL.Port(); (parsedURL.Scheme == "http" && port == "80") || (parsedURL.Scheme == "https" && port == "443") {
+		parsedURL.Host = parsedURL.Hostname()
+	}
+	parsedURL.Fragment = ""
+	parsedURL.RawFragment = ""
+	if parsedURL.RawQuery != "" {
+		parsedURL.RawQuery = strippedParams.strip(parsedURL.RawQuery)
+	}
+	if parsedURL.Path == "" {
+		parsedURL.Path = "/"
+	}
+
+	return parsedURL.String(), nil
+}
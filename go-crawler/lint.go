@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Kinds of problems lint-urls reports
+const (
+	lintDuplicate         = "duplicate"
+	lintMalformed         = "malformed"
+	lintUnsupportedScheme = "unsupported-scheme"
+	lintLong              = "long"
+)
+
+// LintIssue is a problem with one line of an input file
+type LintIssue struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+	URL     string `json:"url"`
+}
+
+// urlLocation is where a URL was first seen
+type urlLocation struct {
+	file string
+	line int
+}
+
+func (l urlLocation) String(file string) string {
+	if l.file == file {
+		return fmt.Sprintf("line %d", l.line)
+	}
+	return fmt.Sprintf("%s:%d", l.file, l.line)
+}
+
+// Check input files without fetching anything. Duplicates are found across
+// all files, both exact and after URL normalization, and point at the first
+// occurrence.
+func lintInputs(files []string, maxLength int) ([]LintIssue, int, error) {
+	var issues []LintIssue
+	exact := make(map[string]urlLocation)
+	normalized := make(map[string]urlLocation)
+	total := 0
+
+	for _, file := range files {
+		entries, err := loadInputFile(file)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, entry := range entries {
+			total++
+			issue := func(kind, message string) {
+				issues = append(issues, LintIssue{File: file, Line: entry.line, Kind: kind, Message: message, URL: entry.URL})
+			}
+			here := urlLocation{file, entry.line}
+
+			if maxLength > 0 && len(entry.URL) > maxLength {
+				issue(lintLong, fmt.Sprintf("%d characters (limit %d)", len(entry.URL), maxLength))
+			}
+			if err := validateURL(entry.URL); err != nil {
+				if errors.Is(err, errUnsupportedScheme) {
+					issue(lintUnsupportedScheme, err.Error())
+				} else {
+					issue(lintMalformed, err.Error())
+				}
+				continue
+			}
+
+			if first, ok := exact[entry.URL]; ok {
+				issue(lintDuplicate, "same as "+first.String(file))
+				continue
+			}
+			exact[entry.URL] = here
+			if key, err := normalizeURL(entry.URL); err == nil {
+				if first, ok := normalized[key]; ok {
+					issue(lintDuplicate, "same as "+first.String(file)+" after normalization")
+					continue
+				}
+				normalized[key] = here
+			}
+		}
+	}
+	return issues, total, nil
+}
+
+// Run the lint-urls subcommand and return the process exit code: 0 when the
+// files are clean, 1 when there are issues or a file can't be read
+func runLint(args []string) int {
+	fs := flag.NewFlagSet("lint-urls", flag.ExitOnError)
+	maxLength := fs.Int("max-length", 2048, "Report URLs longer than this many characters (0 disables)")
+	asJSON := fs.Bool("json", false, "Print the issues as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: crawler lint-urls [-max-length N] [-json] urls.txt...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitConfig
+	}
+	files, err := expandInputs(fs.Args())
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return exitError
+	}
+	issues, total, err := lintInputs(files, *maxLength)
+	if err != nil {
+		fmt.Printf("Error reading URLs: %s\n", err)
+		return exitError
+	}
+
+	if *asJSON {
+		if issues == nil {
+			issues = []LintIssue{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(issues); err != nil {
+			fmt.Printf("Error encoding issues: %s\n", err)
+			return exitError
+		}
+	} else {
+		counts := make(map[string]int)
+		for _, issue := range issues {
+			counts[issue.Kind]++
+			fmt.Printf("%s:%d: %s: %s: %q\n", issue.File, issue.Line, issue.Kind, issue.Message, issue.URL)
+		}
+		fmt.Printf("%d URLs checked, %d issues (%d duplicate, %d malformed, %d unsupported scheme, %d long)\n",
+			total, len(issues), counts[lintDuplicate], counts[lintMalformed], counts[lintUnsupportedScheme], counts[lintLong])
+	}
+
+	if len(issues) > 0 {
+		return exitError
+	}
+	return exitOK
+}
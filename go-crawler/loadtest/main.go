@@ -0,0 +1,127 @@
+// Load test for the Go crawler's -scale mode. It serves small pages from a
+// local fixture server, writes a list of unique URLs, crawls them with a
+// copy of the crawler binary and reports throughput and peak memory.
+//
+//	go build -o crawler . && go run ./loadtest -urls 1000000
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+func main() {
+	crawler := flag.String("crawler", "./crawler", "Crawler binary to test")
+	urls := flag.Int("urls", 1000000, "Number of unique URLs to crawl")
+	workers := flag.Int("workers", 10, "Crawler workers")
+	maxRSS := flag.Int("max-rss-mb", 500, "Fail if the crawler's peak memory exceeds this many MB (0 disables)")
+	flag.Parse()
+
+	dir, err := os.MkdirTemp("", "crawler-loadtest-")
+	if err != nil {
+		fmt.Printf("Error creating work directory: %s\n", err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(dir)
+
+	// The crawler writes its results next to its binary, so run a copy
+	binary := filepath.Join(dir, "crawler")
+	if err := copyFile(*crawler, binary); err != nil {
+		fmt.Printf("Error copying crawler binary: %s\n", err)
+		os.Exit(1)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Printf("Error starting fixture server: %s\n", err)
+		os.Exit(1)
+	}
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, "<html><head><title>Page %s</title></head><body><p>Load test page</p></body></html>", r.URL.Path)
+	}))
+
+	input := filepath.Join(dir, "urls.txt")
+	if err := writeURLs(input, listener.Addr().String(), *urls); err != nil {
+		fmt.Printf("Error writing URL list: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Crawling %d URLs with %d workers...\n", *urls, *workers)
+	cmd := exec.Command(binary, "-scale", "-input", input, "-workers", fmt.Sprint(*workers))
+	cmd.Stderr = os.Stderr
+	start := time.Now()
+	output, err := cmd.Output()
+	elapsed := time.Since(start)
+	if err != nil {
+		fmt.Printf("%s", output)
+		fmt.Printf("Error running crawler: %s\n", err)
+		os.Exit(1)
+	}
+
+	peakMB := peakRSS(cmd.ProcessState) / (1024 * 1024)
+	fmt.Printf("URLs:       %d\n", *urls)
+	fmt.Printf("Time:       %.1f seconds (%.0f URLs/s)\n", elapsed.Seconds(), float64(*urls)/elapsed.Seconds())
+	fmt.Printf("Peak RSS:   %d MB\n", peakMB)
+
+	if *maxRSS > 0 && peakMB > int64(*maxRSS) {
+		fmt.Printf("FAIL: peak RSS above the %d MB target\n", *maxRSS)
+		os.Exit(1)
+	}
+	fmt.Printf("PASS\n")
+}
+
+// Write n unique URLs on the fixture server
+func writeURLs(path, addr string, n int) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(w, "http://%s/page/%d\n", addr, i)
+	}
+	return w.Flush()
+}
+
+// Peak resident memory of a finished process in bytes
+func peakRSS(state *os.ProcessState) int64 {
+	usage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	// Linux reports kilobytes, macOS bytes
+	if runtime.GOOS == "darwin" {
+		return usage.Maxrss
+	}
+	return usage.Maxrss * 1024
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Set when the test binary is run as the crawler by runCrawler
+const crawlerMainEnv = "CRAWLERTEST_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(crawlerMainEnv) != "" {
+		main()
+	}
+	os.Exit(m.Run())
+}
+
+// Run the crawler with the given arguments in a process of its own, as the
+// flags and os.Exit calls of a crawl are process-wide, and return its output
+// and exit code
+func runCrawler(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), crawlerMainEnv+"=1")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return out.String(), exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return out.String(), 0
+}
+
+// sessionStep is one message of a recorded protocol session
+type sessionStep struct {
+	client bool
+	data   []byte
+}
+
+// Load a session recorded in testdata: a message per line, "C" for the
+// client's and "S" for the server's, then its bytes in hex or as a Go quoted
+// string. Lines starting with # are comments.
+func loadSession(t *testing.T, path string) []sessionStep {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var steps []sessionStep
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		side, encoded, _ := strings.Cut(text, " ")
+		var data []byte
+		if strings.HasPrefix(encoded, `"`) {
+			var unquoted string
+			unquoted, err = strconv.Unquote(encoded)
+			data = []byte(unquoted)
+		} else {
+			data, err = hex.DecodeString(encoded)
+		}
+		if err != nil || side != "C" && side != "S" {
+			t.Fatalf("%s:%d: malformed step", path, line)
+		}
+		steps = append(steps, sessionStep{client: side == "C", data: data})
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return steps
+}
+
+// Play the server's side of a recorded session to the first client that
+// connects, checking the client sends exactly the recorded messages.
+// Returns the address to dial.
+func replaySession(t *testing.T, steps []sessionStep) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		listener.Close()
+		<-done
+	})
+	go func() {
+		defer close(done)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		for i, step := range steps {
+			if !step.client {
+				if _, err := conn.Write(step.data); err != nil {
+					t.Errorf("step %d: %v", i+1, err)
+					return
+				}
+				continue
+			}
+			got := make([]byte, len(step.data))
+			n, err := io.ReadFull(conn, got)
+			if !bytes.Equal(got[:n], step.data) {
+				t.Errorf("step %d: client sent\n%q\nwant\n%q (%v)", i+1, got[:n], step.data, err)
+				return
+			}
+		}
+		if extra, _ := io.ReadAll(conn); len(extra) > 0 {
+			t.Errorf("client sent %q after the recorded session", extra)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// Make a source of randomness give first, first+1, ... for the rest of the
+// test, as it did when a session was recorded
+func fixRand(t *testing.T, source *io.Reader, first byte) {
+	t.Helper()
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = first + byte(i)
+	}
+	saved := *source
+	*source = bytes.NewReader(data)
+	t.Cleanup(func() { *source = saved })
+}
+
+// Report the version a build without -ldflags has, which recorded sessions
+// carry, for the rest of the test
+func devVersion(t *testing.T) {
+	saved := version
+	version = "dev"
+	t.Cleanup(func() { version = saved })
+}
+
+func BenchmarkExtractTitle(b *testing.B) {
+	body := string(benchmarkBody)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	for i := 0; i < b.N; i++ {
+		if title := extractTitle(body); title != "Benchmark" {
+			b.Fatalf("got title %q", title)
+		}
+	}
+}
+
+// Serve small HTML pages like the crawl fixtures
+func newFixtureServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, "<html><head><title>Page %s</title></head><body>%s</body></html>",
+			r.URL.Path, strings.Repeat(`<p><a href="/next">Next page</a></p>`, 200))
+	}))
+}
+
+// Crawl 100 fixture pages per iteration, with parsing in the fetch workers
+// and as a separate pipeline stage
+func BenchmarkCrawlURLs(b *testing.B) {
+	server := newFixtureServer()
+	defer server.Close()
+
+	urls := make([]string, 100)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("%s/page/%d", server.URL, i)
+	}
+	client := newHTTPClient(timeoutConfig{total: 10 * time.Second})
+
+	for _, parsers := range []int{0, 4} {
+		b.Run(fmt.Sprintf("parsers=%d", parsers), func(b *testing.B) {
+			opts := &fetchOptions{extractLinks: true, parsers: parsers}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				results, truncated, err := crawlURLs(context.Background(), urls, 10, client, opts)
+				if err != nil || truncated || len(results) != len(urls) {
+					b.Fatalf("crawled %d of %d URLs: %v", len(results), len(urls), err)
+				}
+			}
+			b.ReportMetric(float64(b.N*len(urls))/b.Elapsed().Seconds(), "urls/s")
+		})
+	}
+}
+
+func BenchmarkEncodeResults(b *testing.B) {
+	results := make([]Result, 1000)
+	for i := range results {
+		results[i] = Result{
+			URL:         fmt.Sprintf("https://example.com/page/%d", i),
+			Title:       fmt.Sprintf("Example page %d", i),
+			Status:      200,
+			ContentType: "text/html; charset=utf-8",
+			TimeTaken:   0.123,
+			Domain:      "example.com",
+			ContentHash: strings.Repeat("ab", 32),
+			Links:       []string{"https://example.com/", "https://example.com/about"},
+		}
+	}
+	combined := CombinedResults{Summary: Summary{TotalURLs: len(results)}, Results: results}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := encodeResults(io.Discard, combined); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func FuzzExtractTitle(f *testing.F) {
+	f.Add("<html><head><title>Example</title></head></html>")
+	f.Add("<title lang=\"en\">  Spaced  </title><title>Second</title>")
+	f.Add("<TITLE>Upper</TITLE>")
+	f.Add("<title>Fish &amp; Chips\nto go</title>")
+	f.Add("<title>Unclosed")
+	f.Add("")
+	f.Fuzz(func(t *testing.T, body string) {
+		title := extractTitle(body)
+		if title == "No title found" {
+			return
+		}
+		if title != strings.TrimSpace(title) {
+			t.Errorf("title %q has surrounding whitespace", title)
+		}
+		// Character references are decoded, so only plain bodies contain
+		// the title verbatim
+		if !strings.Contains(body, "&") && !strings.Contains(body, title) {
+			t.Errorf("title %q is not in the body", title)
+		}
+	})
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// Ways to choose between results for the same URL when merging
+const (
+	keepLatest = "latest"
+	keepBest   = "best"
+)
+
+// Rank a result for -keep best: a success beats a failure, which beats a
+// skip
+func attemptRank(result Result) int {
+	switch {
+	case result.SkipReason != "":
+		return 0
+	case resultSucceeded(result):
+		return 2
+	default:
+		return 1
+	}
+}
+
+// Report whether a result is from a later attempt than another. Results
+// stamped with their fetch start time are compared by it, so runs that went
+// on at the same time merge correctly; otherwise the later file wins.
+func laterAttempt(result, than Result) bool {
+	if result.StartedAt != "" && than.StartedAt != "" {
+		return result.StartedAt >= than.StartedAt
+	}
+	return true
+}
+
+// Combine the results of several runs, one result per URL in order of first
+// appearance. With keepLatest the later attempt is kept; with keepBest a
+// later file's result replaces an earlier one only if it ranks at least as
+// high.
+func mergeResults(runs []CombinedResults, keep string) []Result {
+	var merged []Result
+	index := make(map[string]int)
+	for _, run := range runs {
+		for _, result := range run.Results {
+			i, seen := index[result.URL]
+			if !seen {
+				index[result.URL] = len(merged)
+				merged = append(merged, result)
+				continue
+			}
+			if keep == keepLatest && laterAttempt(result, merged[i]) || keep == keepBest && attemptRank(result) >= attemptRank(merged[i]) {
+				merged[i] = result
+			}
+		}
+	}
+	return merged
+}
+
+// Recompute the summary for merged results. Total time is the sum of the
+// runs' crawl times. Sections that depend on crawl options are recomputed
+// when any run had them; crawl-wide stats such as robots.txt caching are not
+// carried over.
+func mergedSummary(runs []CombinedResults, results []Result) Summary {
+	var tally resultTally
+	for _, result := range results {
+		tally.add(result)
+	}
+	summary := Summary{
+		TotalURLs:         tally.total,
+		SuccessfulFetches: tally.successful,
+		FailedFetches:     tally.failed,
+		UnchangedURLs:     tally.unchanged,
+		AssertionFailures: tally.assertions,
+		SkippedURLs:       tally.skipped,
+		Timeouts:          tally.timeouts,
+		TotalBytes:        tally.bytes,
+		Tags:              tally.tagStats(),
+		DuplicateTitles:   findDuplicateTitles(results),
+	}
+	summary.ExpiringCertificates = findExpiringCertificates(results)
+	summary.HTTPSUpgrade = summarizeHTTPSUpgrades(results)
+	summary.Connections = summarizeConnections(results)
+	summary.DNS = summarizeDNS(results)
+	summary.Compression = summarizeCompression(results, 100*1024)
+	summary.FailingHosts = summarizeFailingHosts(results, nil)
+
+	var security, accessibility, seo, hreflang bool
+	for _, run := range runs {
+		summary.TotalTime += run.Summary.TotalTime
+		summary.Truncated = summary.Truncated || run.Summary.Truncated
+		summary.Interrupted = summary.Interrupted || run.Summary.Interrupted
+		if summary.Aborted == "" {
+			summary.Aborted = run.Summary.Aborted
+		}
+		summary.InvalidURLs = append(summary.InvalidURLs, run.Summary.InvalidURLs...)
+		security = security || run.Summary.SecurityAudit != nil
+		accessibility = accessibility || run.Summary.AccessibilityAudit != nil
+		seo = seo || run.Summary.SEOAudit != nil
+		hreflang = hreflang || run.Summary.Hreflang != nil
+	}
+	if security {
+		summary.SecurityAudit = summarizeSecurityAudits(results)
+	}
+	if accessibility {
+		summary.AccessibilityAudit = summarizeAccessibilityAudits(results)
+	}
+	if seo {
+		summary.SEOAudit = summarizeSEOAudits(results)
+	}
+	// Alternates crawled in different shards can now be checked
+	if hreflang {
+		summary.Hreflang = validateHreflang(results)
+	}
+
+	if tally.total > 0 {
+		summary.AverageTimePerURL = summary.TotalTime / float64(tally.total)
+	}
+	if summary.TotalTime > 0 {
+		summary.BytesPerSecond = float64(tally.bytes) / summary.TotalTime
+	}
+	return summary
+}
+
+// Run the merge subcommand and return the process exit code
+func runMerge(args []string) int {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	output := fs.String("output", "merged_results.json", "File to write the merged results to")
+	keep := fs.String("keep", keepLatest, "Result to keep for a URL in several files: latest (from the last file) or best (successes over failures over skips)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: crawler merge [-keep latest|best] [-output merged.json] results.json...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || (*keep != keepLatest && *keep != keepBest) {
+		fs.Usage()
+		return exitConfig
+	}
+
+	runs := make([]CombinedResults, 0, fs.NArg())
+	total := 0
+	for _, path := range fs.Args() {
+		run, err := loadResults(path)
+		if err != nil {
+			fmt.Printf("Error loading %s: %s\n", path, err)
+			return exitError
+		}
+		runs = append(runs, run)
+		total += len(run.Results)
+	}
+
+	results := mergeResults(runs, *keep)
+	combined := CombinedResults{Summary: mergedSummary(runs, results), Results: results}
+	if err := saveResults(combined, outputFormat{}, *output); err != nil {
+		fmt.Printf("Error saving results: %s\n", err)
+		return exitError
+	}
+
+	fmt.Printf("Merged %d results from %d files into %d unique URLs\n", total, len(runs), len(results))
+	fmt.Printf("Successful fetches: %d\n", combined.Summary.SuccessfulFetches)
+	fmt.Printf("Failed fetches: %d\n", combined.Summary.FailedFetches)
+	fmt.Printf("Results saved to %s\n", *output)
+	return exitOK
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Load the two shards in testdata/merge
+func loadShards(t *testing.T) []CombinedResults {
+	t.Helper()
+	var runs []CombinedResults
+	for _, name := range []string{"shard-a.json", "shard-b.json"} {
+		run, err := loadResults(filepath.Join("testdata", "merge", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// Overlapping shards keep one result per URL: the newest attempt with
+// -keep latest, the best ranked with -keep best
+func TestMergeResults(t *testing.T) {
+	runs := loadShards(t)
+	for _, tc := range []struct {
+		keep   string
+		status map[string]int
+		title  string // of /5, unstamped in both files
+	}{
+		// /1 failed later in shard a than it succeeded in shard b
+		{keepLatest, map[string]int{"/1": 500, "/2": 404, "/3": 0, "/4": 200, "/5": 200}, "Five, second file"},
+		{keepBest, map[string]int{"/1": 200, "/2": 200, "/3": 0, "/4": 200, "/5": 200}, "Five, second file"},
+	} {
+		merged := mergeResults(runs, tc.keep)
+		var order []string
+		status := make(map[string]int)
+		for _, result := range merged {
+			path := result.URL[len("https://a.example"):]
+			order = append(order, path)
+			status[path] = result.Status
+			if path == "/5" && result.Title != tc.title {
+				t.Errorf("-keep %s: /5 has title %q, want %q", tc.keep, result.Title, tc.title)
+			}
+		}
+		// In order of first appearance
+		if want := []string{"/1", "/2", "/3", "/5", "/4"}; !reflect.DeepEqual(order, want) {
+			t.Errorf("-keep %s: got URLs %v, want %v", tc.keep, order, want)
+		}
+		if !reflect.DeepEqual(status, tc.status) {
+			t.Errorf("-keep %s: got statuses %v, want %v", tc.keep, status, tc.status)
+		}
+	}
+}
+
+// The summary is counted again from the merged results, not added up from
+// the shards' summaries
+func TestMergedSummary(t *testing.T) {
+	runs := loadShards(t)
+	results := mergeResults(runs, keepLatest)
+	summary := mergedSummary(runs, results)
+
+	if summary.TotalURLs != 5 || summary.SuccessfulFetches != 2 || summary.FailedFetches != 2 || summary.SkippedURLs != 1 {
+		t.Errorf("got %d URLs, %d successful, %d failed, %d skipped; want 5, 2, 2, 1",
+			summary.TotalURLs, summary.SuccessfulFetches, summary.FailedFetches, summary.SkippedURLs)
+	}
+	if summary.TotalTime != 15 || summary.AverageTimePerURL != 3 {
+		t.Errorf("got total time %v, average %v; want 15 and 3", summary.TotalTime, summary.AverageTimePerURL)
+	}
+	if summary.TotalBytes != 100+50+500+50 {
+		t.Errorf("got %d bytes, want those of the kept results", summary.TotalBytes)
+	}
+	if !summary.Interrupted || len(summary.InvalidURLs) != 1 || summary.InvalidURLs[0].URL != "htp://bad" {
+		t.Errorf("shard flags and invalid URLs not carried over: %+v", summary)
+	}
+}
+
+func TestMergeCommand(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "merged.json")
+	out, code := runCrawler(t, "merge", "-keep", "best", "-output", output,
+		filepath.Join("testdata", "merge", "shard-a.json"), filepath.Join("testdata", "merge", "shard-b.json"))
+	if code != exitOK {
+		t.Fatalf("merge exited with %d:\n%s", code, out)
+	}
+	merged, err := loadResults(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged.Results) != 5 || merged.Summary.SuccessfulFetches != 4 || merged.Summary.SkippedURLs != 1 {
+		t.Errorf("got %d results, summary %+v", len(merged.Results), merged.Summary)
+	}
+
+	if _, code := runCrawler(t, "merge", "-keep", "first", filepath.Join("testdata", "merge", "shard-a.json")); code != exitConfig {
+		t.Errorf("invalid -keep exited with %d, want %d", code, exitConfig)
+	}
+}
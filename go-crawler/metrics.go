@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Upper bounds in seconds of the request duration histogram buckets
+var requestDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Write the final crawl metrics in the Prometheus text exposition format
+func writePrometheusMetrics(w io.Writer, summary Summary, results []Result) {
+	fmt.Fprintln(w, "# HELP crawler_requests_total URLs processed by outcome.")
+	fmt.Fprintln(w, "# TYPE crawler_requests_total counter")
+	fmt.Fprintf(w, "crawler_requests_total{outcome=\"success\"} %d\n", summary.SuccessfulFetches)
+	fmt.Fprintf(w, "crawler_requests_total{outcome=\"failed\"} %d\n", summary.FailedFetches)
+	fmt.Fprintf(w, "crawler_requests_total{outcome=\"skipped\"} %d\n", summary.SkippedURLs)
+
+	fmt.Fprintln(w, "# HELP crawler_timeouts_total Requests that timed out by timeout kind.")
+	fmt.Fprintln(w, "# TYPE crawler_timeouts_total counter")
+	for _, kind := range []string{timeoutConnect, timeoutTLSHandshake, timeoutResponseHeader, timeoutTotal} {
+		fmt.Fprintf(w, "crawler_timeouts_total{kind=%q} %d\n", kind, summary.Timeouts[kind])
+	}
+
+	// Status codes in numeric order so pushes are stable
+	statuses := make(map[int]int)
+	for _, result := range results {
+		if result.SkipReason == "" {
+			statuses[result.Status]++
+		}
+	}
+	codes := make([]int, 0, len(statuses))
+	for code := range statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	fmt.Fprintln(w, "# HELP crawler_responses_total Responses by HTTP status (-1 for request errors).")
+	fmt.Fprintln(w, "# TYPE crawler_responses_total counter")
+	for _, code := range codes {
+		fmt.Fprintf(w, "crawler_responses_total{status=\"%d\"} %d\n", code, statuses[code])
+	}
+
+	fmt.Fprintln(w, "# HELP crawler_downloaded_bytes_total Bytes downloaded, headers included.")
+	fmt.Fprintln(w, "# TYPE crawler_downloaded_bytes_total counter")
+	fmt.Fprintf(w, "crawler_downloaded_bytes_total %d\n", summary.TotalBytes)
+
+	fmt.Fprintln(w, "# HELP crawler_request_duration_seconds Time taken per fetched URL.")
+	fmt.Fprintln(w, "# TYPE crawler_request_duration_seconds histogram")
+	counts := make([]int, len(requestDurationBuckets))
+	count, sum := 0, 0.0
+	for _, result := range results {
+		if result.SkipReason != "" {
+			continue
+		}
+		count++
+		sum += result.TimeTaken
+		for i, bound := range requestDurationBuckets {
+			if result.TimeTaken <= bound {
+				counts[i]++
+			}
+		}
+	}
+	for i, bound := range requestDurationBuckets {
+		fmt.Fprintf(w, "crawler_request_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(bound, 'g', -1, 64), counts[i])
+	}
+	fmt.Fprintf(w, "crawler_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", count)
+	fmt.Fprintf(w, "crawler_request_duration_seconds_sum %g\n", sum)
+	fmt.Fprintf(w, "crawler_request_duration_seconds_count %d\n", count)
+
+	fmt.Fprintln(w, "# HELP crawler_duration_seconds Wall clock time of the crawl.")
+	fmt.Fprintln(w, "# TYPE crawler_duration_seconds gauge")
+	fmt.Fprintf(w, "crawler_duration_seconds %g\n", summary.TotalTime)
+
+	fmt.Fprintln(w, "# HELP crawler_last_run_timestamp_seconds When the crawl finished.")
+	fmt.Fprintln(w, "# TYPE crawler_last_run_timestamp_seconds gauge")
+	fmt.Fprintf(w, "crawler_last_run_timestamp_seconds %d\n", time.Now().Unix())
+}
+
+// Push metrics to a Prometheus Pushgateway, replacing the previous push for
+// the job
+func pushMetrics(gateway, job string, summary Summary, results []Result) error {
+	var body bytes.Buffer
+	writePrometheusMetrics(&body, summary, results)
+
+	endpoint := strings.TrimSuffix(gateway, "/") + "/metrics/job/" + url.PathEscape(job)
+	req, err := http.NewRequest(http.MethodPut, endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pushgateway returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
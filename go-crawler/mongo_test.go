@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The sessions in testdata/mongo were recorded against FerretDB v1.24.0.
+// The user crawler's password has a no-break space and an ª, which SASLprep
+// maps to a space and an a for SCRAM-SHA-256; SCRAM-SHA-1 hashes it as is.
+func mongoSessionURL(addr, password, query string) string {
+	return "mongodb://" + url.UserPassword("crawler", password).String() + "@" + addr + "/crawl" + query
+}
+
+// The sink negotiates SCRAM-SHA-256, creates its indexes and upserts the
+// results and the run's summary
+func TestMongoSinkSession(t *testing.T) {
+	fixRand(t, &scramRand, 0)
+	addr := replaySession(t, loadSession(t, "testdata/mongo/sink.txt"))
+	sink, err := openMongoSink(mongoSessionURL(addr, "pen\u00a0cil\u00aa", ""), sinkConfig{runID: "run-1", options: sinkOptions{batchSize: 100, backoff: 1, retries: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range []Result{
+		{URL: "https://a.example/", Title: "A", Status: 200, TimeTaken: 0.25, Domain: "a.example", StartedAt: "2024-05-01T12:00:00.000Z"},
+		{URL: "https://b.example/missing", Status: 404, TimeTaken: 0.5, Domain: "b.example", StartedAt: "2024-05-01T12:00:01.000Z"},
+	} {
+		if err := sink.Write(result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	sink.(*mongoSink).summarize(
+		Summary{TotalURLs: 2, SuccessfulFetches: 1, FailedFetches: 1, TotalTime: 1, AverageTimePerURL: 0.5},
+		nil,
+		&RunMetadata{ID: "run-1", Version: "dev", GoVersion: "go1.21", Flags: map[string]string{"sink": "mongodb://..."}, StartedAt: start, EndedAt: start.Add(time.Second)},
+	)
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// SCRAM-SHA-1 logs in with the password unprepared, and a refused login
+// reports the server's error
+func TestMongoLoginSessions(t *testing.T) {
+	for _, tc := range []struct {
+		session  string
+		password string
+		query    string
+		code     int
+	}{
+		{"testdata/mongo/login-sha1.txt", "pen\u00a0cil\u00aa", "?authMechanism=SCRAM-SHA-1", 0},
+		{"testdata/mongo/login-refused.txt", "pen cila-wrong", "?authMechanism=SCRAM-SHA-256", 18},
+	} {
+		fixRand(t, &scramRand, 100)
+		target, err := parseMongoURL(mongoSessionURL(replaySession(t, loadSession(t, tc.session)), tc.password, tc.query))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := dialMongo(target)
+		if tc.code != 0 {
+			var refused mongoError
+			if !errors.As(err, &refused) || refused.code != tc.code {
+				t.Errorf("%s: got error %v, want code %d", tc.session, err, tc.code)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.session, err)
+			continue
+		}
+		var ping bsonDoc
+		ping.addInt32("ping", 1)
+		if _, err := conn.command("crawl", &ping); err != nil {
+			t.Errorf("%s: ping: %v", tc.session, err)
+		}
+		conn.Close()
+	}
+}
+
+// The exchanges of RFC 5802 and RFC 7677
+func TestSCRAMVectors(t *testing.T) {
+	for _, tc := range []struct {
+		scram       *scramConversation
+		serverFirst string
+		proof       string
+		signature   string
+	}{
+		{
+			scram:       &scramConversation{newHash: sha1.New, user: "user", password: "pencil", nonce: "fyko+d2lbbFgONRv9qkxdawL"},
+			serverFirst: "r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096",
+			proof:       "c=biws,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts=",
+			signature:   "v=rmF9pqV8S7suAoZWja4dJRkFsKQ=",
+		},
+		{
+			scram:       &scramConversation{newHash: sha256.New, user: "user", password: "pencil", nonce: "rOprNGfwEbeRWgbNEkqO"},
+			serverFirst: "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+			proof:       "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+			signature:   "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=",
+		},
+	} {
+		if first := tc.scram.first(); first != "n,,n=user,r="+tc.scram.nonce {
+			t.Errorf("first message %q", first)
+		}
+		proof, err := tc.scram.final(tc.serverFirst)
+		if err != nil || proof != tc.proof {
+			t.Errorf("got final message %q, %v; want %q", proof, err, tc.proof)
+		}
+		if err := tc.scram.verify(tc.signature); err != nil {
+			t.Errorf("%s: %v", tc.signature, err)
+		}
+		if err := tc.scram.verify("v=" + strings.Repeat("A", len(tc.signature)-2)); err == nil {
+			t.Errorf("accepted a wrong server signature")
+		}
+	}
+
+	// A challenge that doesn't extend the client's nonce is refused
+	scram := &scramConversation{newHash: sha256.New, user: "user", password: "pencil", nonce: "abc"}
+	if _, err := scram.final("r=xyz,s=QSXCR+Q6sek8bf92,i=4096"); err == nil {
+		t.Errorf("accepted a challenge with another nonce")
+	}
+}
+
+func TestSASLPrep(t *testing.T) {
+	for _, tc := range []struct {
+		password string
+		want     string
+		err      string
+	}{
+		{password: "pencil", want: "pencil"},
+		{password: "I\u00adX", want: "IX"},
+		{password: "pen\u2003cil\u3000x", want: "pen cil x"},
+		{password: "\u00aa\u00b2\u00bd", want: "a21\u20442"},
+		{password: "caf\u00e9", want: "caf\u00e9"},
+		{password: "a\u0007b", err: "prohibits"},
+		{password: "a\u200eb", err: "prohibits"},
+		{password: "a\ue000b", err: "prohibits"},
+		{password: "\u2168", err: "only prepare Latin-1"},
+		{password: "a\xffb", err: "valid UTF-8"},
+	} {
+		got, err := saslPrep(tc.password)
+		switch {
+		case tc.err == "" && (err != nil || got != tc.want):
+			t.Errorf("%q: got %q, %v; want %q", tc.password, got, err, tc.want)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("%q: got error %v, want %q", tc.password, err, tc.err)
+		}
+	}
+}
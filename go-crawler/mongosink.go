@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// mongoSink writes a document per result to a MongoDB collection as the
+// crawl runs, and a document with the run's summary to another at the end.
+// Result documents are keyed by run and URL, so a retried write, or a URL
+// fetched again in the same run, replaces the earlier document.
+type mongoSink struct {
+	target mongoTarget
+	runID  string
+	*batchSink
+	conn    *mongoConn // nil after a failure, until the next write dials again
+	summary []byte     // the run's summary document, once the crawl is over
+
+	mu             sync.Mutex
+	written        int
+	rejected       int
+	firstRejection string // why the first rejected document was refused
+	summarized     bool
+}
+
+// Connect to the database a mongodb:// URL names, and index the results
+// collection for queries by run and by URL
+func openMongoSink(rawURL string, config sinkConfig) (ResultSink, error) {
+	target, err := parseMongoURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialMongo(target)
+	if err != nil {
+		return nil, err
+	}
+	var indexes bsonDoc
+	for i, keys := range [][]string{{"run_id", "url"}, {"url", "started_at"}} {
+		var key bsonDoc
+		name := ""
+		for _, field := range keys {
+			key.addInt32(field, 1)
+			name += field + "_1_"
+		}
+		var index bsonDoc
+		index.addDocument("key", key.bytes())
+		index.addString("name", name[:len(name)-1])
+		indexes.addDocument(strconv.Itoa(i), index.bytes())
+	}
+	var create bsonDoc
+	create.addString("createIndexes", target.collection)
+	create.addArray("indexes", indexes.bytes())
+	if _, err := conn.command(target.database, &create); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("collection %s: %w", target.collection, err)
+	}
+	s := &mongoSink{target: target, runID: config.runID, conn: conn}
+	s.batchSink = newBatchSink(config, s.write)
+	return s, nil
+}
+
+func (s *mongoSink) Write(result Result) error {
+	id := sinkDocumentID(s.runID, result.URL)
+	var doc bsonDoc
+	doc.addString("_id", id)
+	doc.addString("run_id", s.runID)
+	// When the fetch started is stored as a date, for range queries and TTL
+	// indexes
+	if startedAt, err := time.Parse(time.RFC3339Nano, result.StartedAt); err == nil {
+		doc.addDate("started_at", startedAt)
+		result.StartedAt = ""
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	if err := doc.addJSON(data); err != nil {
+		return err
+	}
+	s.add(result, sinkItem{id: id, doc: doc.bytes()})
+	return nil
+}
+
+// Run a command, dialing again first if the last one failed
+func (s *mongoSink) command(cmd *bsonDoc) (map[string]interface{}, error) {
+	if s.conn == nil {
+		conn, err := dialMongo(s.target)
+		if err != nil {
+			return nil, err
+		}
+		s.conn = conn
+	}
+	reply, err := s.conn.command(s.target.database, cmd)
+	if err != nil && mongoRetryable(err) {
+		// The connection, or the node it is to, is of no more use
+		s.conn.Close()
+		s.conn = nil
+	}
+	return reply, err
+}
+
+// An update command replacing documents by ID, inserting them when missing
+func mongoUpsert(collection string, batch []sinkItem) *bsonDoc {
+	var updates bsonDoc
+	for i, item := range batch {
+		var query bsonDoc
+		query.addString("_id", item.id)
+		var update bsonDoc
+		update.addDocument("q", query.bytes())
+		update.addDocument("u", item.doc)
+		update.addBool("upsert", true)
+		updates.addDocument(strconv.Itoa(i), update.bytes())
+	}
+	var cmd bsonDoc
+	cmd.addString("update", collection)
+	cmd.addArray("updates", updates.bytes())
+	cmd.addBool("ordered", false)
+	return &cmd
+}
+
+// The write errors of an update's reply, by index in the batch
+func mongoWriteErrors(reply map[string]interface{}) map[int]string {
+	errs := make(map[int]string)
+	list, _ := reply["writeErrors"].([]interface{})
+	for _, item := range list {
+		writeError, _ := item.(map[string]interface{})
+		message, _ := writeError["errmsg"].(string)
+		errs[bsonInt(writeError["index"])] = message
+	}
+	return errs
+}
+
+// Write a batch of results, in as many commands as the server's size limit
+// needs, returning the results to try again and, when a command failed,
+// whether it is worth retrying
+func (s *mongoSink) write(batch []sinkItem) ([]sinkItem, bool, error) {
+	for start := 0; start < len(batch); {
+		// Room for the command around the documents, as the drivers leave
+		limit := 16 * 1024 * 1024
+		if s.conn != nil {
+			limit = s.conn.maxDoc
+		}
+		end, size := start+1, len(batch[start].doc)
+		for end < len(batch) && size+len(batch[end].doc)+100 < limit-16*1024 {
+			size += len(batch[end].doc) + 100
+			end++
+		}
+		reply, err := s.command(mongoUpsert(s.target.collection, batch[start:end]))
+		if err != nil {
+			return batch[start:], mongoRetryable(err), fmt.Errorf("collection %s: %w", s.target.collection, err)
+		}
+		errs := mongoWriteErrors(reply)
+		for i, item := range batch[start:end] {
+			s.mu.Lock()
+			if message, refused := errs[i]; refused {
+				// A document the server will never take, e.g. one too large
+				// or failing the collection's validator, is counted and
+				// given up on
+				s.rejected++
+				if s.firstRejection == "" {
+					s.firstRejection = message
+				}
+			} else {
+				s.written++
+			}
+			s.mu.Unlock()
+			item.done()
+		}
+		start = end
+	}
+	return nil, false, nil
+}
+
+func (s *mongoSink) summarize(summary Summary, throughput []ThroughputSample, run *RunMetadata) {
+	var doc bsonDoc
+	doc.addString("_id", s.runID)
+	doc.addDate("started_at", run.StartedAt)
+	doc.addDate("ended_at", run.EndedAt)
+	data, err := json.Marshal(struct {
+		Summary    Summary            `json:"summary"`
+		Throughput []ThroughputSample `json:"throughput,omitempty"`
+		Run        *RunMetadata       `json:"run"`
+	}{summary, throughput, run})
+	if err != nil {
+		return
+	}
+	if err := doc.addJSON(data); err != nil {
+		return
+	}
+	s.summary = doc.bytes()
+}
+
+// Write what is queued, then the summary, and disconnect
+func (s *mongoSink) Close() error {
+	err := s.close()
+	if err == nil && s.summary != nil {
+		summary := []sinkItem{{id: s.runID, doc: s.summary}}
+		err = writeWithRetries(s.options, summary, func(batch []sinkItem) ([]sinkItem, bool, error) {
+			reply, err := s.command(mongoUpsert(s.target.runs, batch))
+			if err == nil {
+				for _, message := range mongoWriteErrors(reply) {
+					return batch, false, fmt.Errorf("collection %s: %s", s.target.runs, message)
+				}
+				s.mu.Lock()
+				s.summarized = true
+				s.mu.Unlock()
+				return nil, false, nil
+			}
+			return batch, mongoRetryable(err), fmt.Errorf("collection %s: %w", s.target.runs, err)
+		})
+	}
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	return err
+}
+
+func (s *mongoSink) report() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	text := fmt.Sprintf("%d results written to %s.%s", s.written, s.target.database, s.target.collection)
+	if s.rejected > 0 {
+		text += fmt.Sprintf(", %d refused (%s)", s.rejected, s.firstRejection)
+	}
+	if s.summarized {
+		text += fmt.Sprintf(", run summary to %s.%s", s.target.database, s.target.runs)
+	}
+	return text
+}
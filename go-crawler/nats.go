@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long a NATS request waits for its reply
+const natsRequestTimeout = 10 * time.Second
+
+// errNATSNoResponders is the answer to a request nobody is subscribed to,
+// e.g. while the coordinator is down
+var errNATSNoResponders = errors.New("nats: no responders")
+
+// errNATSClosed is the failure of a connection closed on purpose
+var errNATSClosed = errors.New("nats: connection closed")
+
+// Source of inbox names; tests replay recorded sessions with a fixed one
+var natsRand io.Reader = rand.Reader
+
+// natsMsg is a message received on a subscription
+type natsMsg struct {
+	Subject string
+	Reply   string
+	Data    []byte
+	Status  int // status of a header-only message, e.g. 404 from JetStream, 0 otherwise
+}
+
+// natsConn is a minimal NATS client: publish, subscribe and request-reply
+// over the text protocol, plus the few JetStream API calls the cluster
+// needs. The crawler is built from the standard library alone, so it
+// doesn't use the official client; there is no reconnecting.
+type natsConn struct {
+	conn       net.Conn
+	maxPayload int
+	inbox      string // prefix of reply subjects for requests
+
+	writeMu sync.Mutex
+	w       *bufio.Writer
+
+	mu     sync.Mutex
+	sid    int
+	subs   map[string]func(natsMsg)
+	nextID int
+	pongs  []chan struct{}
+	err    error // why the connection failed
+	closed chan struct{}
+}
+
+// natsServerInfo is the part of the server's INFO line the client uses
+type natsServerInfo struct {
+	MaxPayload int `json:"max_payload"`
+}
+
+// Connect to a NATS server given as nats://[user:password@]host:port or
+// tls://..., with a token as the user when there is no password
+func dialNATS(rawURL, name string) (*natsConn, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := parsedURL.Host
+	if parsedURL.Port() == "" {
+		host = net.JoinHostPort(parsedURL.Hostname(), "4222")
+	}
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	switch parsedURL.Scheme {
+	case "nats":
+		conn, err = dialer.Dial("tcp", host)
+	case "tls":
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: parsedURL.Hostname(), MinVersion: tls.VersionTLS12})
+	default:
+		return nil, fmt.Errorf("unsupported NATS URL scheme %q: use nats:// or tls://", parsedURL.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReaderSize(conn, 64*1024)
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	line, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("nats: reading server info: %w", err)
+	}
+	op, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+	if !strings.EqualFold(op, "INFO") {
+		conn.Close()
+		return nil, fmt.Errorf("nats: unexpected greeting %q", line)
+	}
+	var info natsServerInfo
+	json.Unmarshal([]byte(args), &info)
+	if info.MaxPayload <= 0 {
+		info.MaxPayload = 1 << 20
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	var id [12]byte
+	io.ReadFull(natsRand, id[:])
+	c := &natsConn{
+		conn:       conn,
+		maxPayload: info.MaxPayload,
+		inbox:      "_INBOX." + hex.EncodeToString(id[:]),
+		w:          bufio.NewWriter(conn),
+		subs:       make(map[string]func(natsMsg)),
+		closed:     make(chan struct{}),
+	}
+	options := map[string]interface{}{
+		"verbose": false, "pedantic": false, "headers": true, "no_responders": true,
+		"name": name, "lang": "go", "version": version, "protocol": 1,
+	}
+	if user := parsedURL.User; user != nil {
+		if password, ok := user.Password(); ok {
+			options["user"], options["pass"] = user.Username(), password
+		} else {
+			options["auth_token"] = user.Username()
+		}
+	}
+	connect, _ := json.Marshal(options)
+	go c.readLoop(r)
+	if err := c.write("CONNECT " + string(connect) + "\r\n"); err != nil {
+		c.Close()
+		return nil, err
+	}
+	// A PONG means the server took the CONNECT; an -ERR means it didn't
+	if err := c.flush(10 * time.Second); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Write protocol text to the server
+func (c *natsConn) write(parts ...string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	for _, part := range parts {
+		c.w.WriteString(part)
+	}
+	return c.w.Flush()
+}
+
+// Wait until the server has processed everything sent so far
+func (c *natsConn) flush(timeout time.Duration) error {
+	pong := make(chan struct{})
+	c.mu.Lock()
+	c.pongs = append(c.pongs, pong)
+	c.mu.Unlock()
+	if err := c.write("PING\r\n"); err != nil {
+		return err
+	}
+	select {
+	case <-pong:
+		return nil
+	case <-c.closed:
+		return c.failure()
+	case <-time.After(timeout):
+		return errors.New("nats: timed out waiting for the server")
+	}
+}
+
+// Why the connection failed
+func (c *natsConn) failure() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Read messages and protocol lines until the connection fails
+func (c *natsConn) readLoop(r *bufio.Reader) {
+	err := c.read(r)
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+	close(c.closed)
+}
+
+func (c *natsConn) read(r *bufio.Reader) error {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("nats: connection lost: %w", err)
+		}
+		op, args, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		switch strings.ToUpper(op) {
+		case "MSG", "HMSG":
+			msg, err := readNATSMsg(r, strings.ToUpper(op) == "HMSG", strings.Fields(args))
+			if err != nil {
+				return err
+			}
+			c.mu.Lock()
+			handler := c.subs[msg.sid]
+			c.mu.Unlock()
+			if handler != nil {
+				handler(msg.natsMsg)
+			}
+		case "PING":
+			c.write("PONG\r\n")
+		case "PONG":
+			c.mu.Lock()
+			if len(c.pongs) > 0 {
+				close(c.pongs[0])
+				c.pongs = c.pongs[1:]
+			}
+			c.mu.Unlock()
+		case "-ERR":
+			return fmt.Errorf("nats: %s", strings.Trim(args, "' "))
+		}
+	}
+}
+
+// A message with the ID of the subscription it arrived on
+type natsDelivery struct {
+	natsMsg
+	sid string
+}
+
+// Read the payload of a MSG or HMSG line: subject sid [reply] [header size]
+// size
+func readNATSMsg(r *bufio.Reader, headers bool, fields []string) (natsDelivery, error) {
+	sizes := 1
+	if headers {
+		sizes = 2
+	}
+	if len(fields) != 2+sizes && len(fields) != 3+sizes {
+		return natsDelivery{}, fmt.Errorf("nats: malformed message line %q", strings.Join(fields, " "))
+	}
+	msg := natsDelivery{natsMsg: natsMsg{Subject: fields[0]}, sid: fields[1]}
+	if len(fields) == 3+sizes {
+		msg.Reply = fields[2]
+	}
+	total, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil {
+		return natsDelivery{}, fmt.Errorf("nats: malformed message size: %w", err)
+	}
+	headerSize := 0
+	if headers {
+		if headerSize, err = strconv.Atoi(fields[len(fields)-2]); err != nil || headerSize > total {
+			return natsDelivery{}, fmt.Errorf("nats: malformed header size")
+		}
+	}
+	data := make([]byte, total+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return natsDelivery{}, err
+	}
+	if headers {
+		// The first header line is e.g. "NATS/1.0 404 No Messages"
+		status, _, _ := bytes.Cut(data[:headerSize], []byte("\r\n"))
+		if fields := strings.Fields(string(status)); len(fields) > 1 {
+			msg.Status, _ = strconv.Atoi(fields[1])
+		}
+	}
+	msg.Data = data[headerSize:total]
+	return msg, nil
+}
+
+// Subscribe a handler to a subject, which may have wildcards, returning the
+// subscription's ID. Handlers run on the connection's reader, so they must
+// not block.
+func (c *natsConn) subscribe(subject string, handler func(natsMsg)) (string, error) {
+	c.mu.Lock()
+	c.sid++
+	sid := strconv.Itoa(c.sid)
+	c.subs[sid] = handler
+	c.mu.Unlock()
+	return sid, c.write("SUB ", subject, " ", sid, "\r\n")
+}
+
+// End a subscription
+func (c *natsConn) unsubscribe(sid string) error {
+	c.mu.Lock()
+	delete(c.subs, sid)
+	c.mu.Unlock()
+	return c.write("UNSUB ", sid, "\r\n")
+}
+
+// Publish a message, with a subject for replies when reply is set
+func (c *natsConn) publish(subject, reply string, data []byte) error {
+	if len(data) > c.maxPayload {
+		return fmt.Errorf("nats: message of %d bytes is over the server's limit of %d", len(data), c.maxPayload)
+	}
+	line := "PUB " + subject + " "
+	if reply != "" {
+		line += reply + " "
+	}
+	return c.write(line, strconv.Itoa(len(data)), "\r\n", string(data), "\r\n")
+}
+
+// Publish a request and wait for the first reply. Each request has its own
+// inbox subscription: JetStream delivers pulled messages under their stream
+// subject, so a reply can't be told apart by its subject.
+func (c *natsConn) request(subject string, data []byte, timeout time.Duration) (natsMsg, error) {
+	reply := make(chan natsMsg, 1)
+	c.mu.Lock()
+	c.nextID++
+	inbox := c.inbox + "." + strconv.Itoa(c.nextID)
+	c.mu.Unlock()
+	sid, err := c.subscribe(inbox, func(msg natsMsg) {
+		select {
+		case reply <- msg:
+		default:
+		}
+	})
+	if err != nil {
+		return natsMsg{}, err
+	}
+	defer c.unsubscribe(sid)
+	if err := c.publish(subject, inbox, data); err != nil {
+		return natsMsg{}, err
+	}
+	select {
+	case msg := <-reply:
+		if msg.Status == 503 {
+			return natsMsg{}, errNATSNoResponders
+		}
+		return msg, nil
+	case <-c.closed:
+		return natsMsg{}, c.failure()
+	case <-time.After(timeout):
+		return natsMsg{}, fmt.Errorf("nats: no reply on %s within %s", subject, timeout)
+	}
+}
+
+// Close the connection
+func (c *natsConn) Close() error {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = errNATSClosed
+	}
+	c.mu.Unlock()
+	return c.conn.Close()
+}
+
+// natsAPIError is the error part of a JetStream API response
+type natsAPIError struct {
+	Code        int    `json:"code"`
+	ErrCode     int    `json:"err_code"`
+	Description string `json:"description"`
+}
+
+// Call the JetStream API and decode its response into out when it is set
+func (c *natsConn) jetStream(subject string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	msg, err := c.request(subject, data, natsRequestTimeout)
+	if errors.Is(err, errNATSNoResponders) {
+		return fmt.Errorf("nats: nothing answered on %s; is JetStream enabled and the stream created?", subject)
+	}
+	if err != nil {
+		return err
+	}
+	var response struct {
+		Error *natsAPIError `json:"error"`
+	}
+	if err := json.Unmarshal(msg.Data, &response); err != nil {
+		return fmt.Errorf("nats: %s: %w", subject, err)
+	}
+	if response.Error != nil {
+		return fmt.Errorf("nats: %s: %s", subject, response.Error.Description)
+	}
+	if out != nil {
+		return json.Unmarshal(msg.Data, out)
+	}
+	return nil
+}
+
+// Create a work queue stream on the subjects unless it exists, and purge
+// it, so messages from an earlier run aren't taken for this one's
+func (c *natsConn) resetWorkQueue(stream string, subjects []string) error {
+	config := map[string]interface{}{"name": stream, "subjects": subjects, "retention": "workqueue", "storage": "file"}
+	if err := c.jetStream("$JS.API.STREAM.CREATE."+stream, config, nil); err != nil && !strings.Contains(err.Error(), "already in use") {
+		return err
+	}
+	return c.jetStream("$JS.API.STREAM.PURGE."+stream, struct{}{}, nil)
+}
+
+// Create a durable pull consumer that needs each message acknowledged
+// within ackWait, or it is delivered again
+func (c *natsConn) durableConsumer(stream, name string, ackWait time.Duration) error {
+	config := map[string]interface{}{
+		"stream_name": stream,
+		"config":      map[string]interface{}{"durable_name": name, "ack_policy": "explicit", "ack_wait": ackWait.Nanoseconds()},
+	}
+	return c.jetStream("$JS.API.CONSUMER.DURABLE.CREATE."+stream+"."+name, config, nil)
+}
+
+// Publish a message to a JetStream stream, returning once it is stored
+func (c *natsConn) publishStored(subject string, data []byte) error {
+	return c.jetStream(subject, json.RawMessage(data), nil)
+}
+
+// Fetch the next message for a pull consumer, waiting up to wait for one.
+// Returns false when there was none.
+func (c *natsConn) next(stream, consumer string, wait time.Duration) (natsMsg, bool, error) {
+	request, _ := json.Marshal(map[string]interface{}{"batch": 1, "expires": wait.Nanoseconds()})
+	msg, err := c.request("$JS.API.CONSUMER.MSG.NEXT."+stream+"."+consumer, request, wait+natsRequestTimeout)
+	if err != nil {
+		return natsMsg{}, false, err
+	}
+	switch msg.Status {
+	case 0:
+		return msg, true, nil
+	case 404, 408, 409:
+		// No messages, the wait expired, or the request was superseded
+		return natsMsg{}, false, nil
+	}
+	return natsMsg{}, false, fmt.Errorf("nats: fetching from %s: status %d", stream, msg.Status)
+}
+
+// Acknowledge a message fetched from a pull consumer
+func (c *natsConn) ack(msg natsMsg) error {
+	return c.publish(msg.Reply, "", []byte("+ACK"))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The work queue calls the cluster transport makes, replayed from a session
+// recorded against nats-server
+func TestNATSSession(t *testing.T) {
+	fixRand(t, &natsRand, 0)
+	devVersion(t)
+
+	conn, err := dialNATS("nats://"+replaySession(t, loadSession(t, "testdata/nats/session.txt")), "crawler-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.resetWorkQueue("CRAWL", []string{"crawl.urls"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.durableConsumer("CRAWL", "worker", 30*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.publishStored("crawl.urls", []byte(`{"url":"https://a.example/"}`)); err != nil {
+		t.Fatal(err)
+	}
+	msg, ok, err := conn.next("CRAWL", "worker", time.Second)
+	if err != nil || !ok || string(msg.Data) != `{"url":"https://a.example/"}` || !strings.HasPrefix(msg.Reply, "$JS.ACK.CRAWL.worker.") {
+		t.Fatalf("got %+v, %v, %v; want the stored message", msg, ok, err)
+	}
+	if err := conn.ack(msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg, ok, err := conn.next("CRAWL", "worker", 100*time.Millisecond); ok || err != nil {
+		t.Errorf("got %+v, %v, %v from an empty queue", msg, ok, err)
+	}
+	if err := conn.publishStored("nowhere.urls", []byte(`{}`)); err == nil || !strings.Contains(err.Error(), "nothing answered on nowhere.urls") {
+		t.Errorf("publishing where no stream listens: %v", err)
+	}
+}
+
+// An -ERR ends the connection with the server's reason
+func TestNATSServerError(t *testing.T) {
+	fixRand(t, &natsRand, 0)
+	addr := replaySession(t, []sessionStep{
+		{data: []byte("INFO {\"max_payload\":1048576}\r\n")},
+		{client: true, data: []byte(`CONNECT {"auth_token":"wrong","headers":true,"lang":"go","name":"crawler-test","no_responders":true,"pedantic":false,"protocol":1,"verbose":false,"version":"` + version + "\"}\r\nPING\r\n")},
+		{data: []byte("-ERR 'Authorization Violation'\r\n")},
+	})
+	_, err := dialNATS("nats://wrong@"+addr, "crawler-test")
+	if err == nil || err.Error() != "nats: Authorization Violation" {
+		t.Errorf("got error %v, want the server's", err)
+	}
+	if errors.Is(err, errNATSClosed) {
+		t.Errorf("the server's error was lost")
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Cluster a NATS URL names when its path is empty
+const defaultNATSCluster = "crawler"
+
+// Name of the coordinator's JetStream consumer of results
+const natsResultsConsumer = "coordinator"
+
+// How long the coordinator has to take a result message before JetStream
+// delivers it again
+const natsResultsAckWait = 30 * time.Second
+
+// Cluster names, which go into subjects and stream names
+var natsClusterRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// natsClusterRequest is a worker's call to the coordinator over NATS
+type natsClusterRequest struct {
+	Worker string          `json:"worker"`
+	Token  string          `json:"token,omitempty"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// natsClusterReply is the coordinator's answer to a call over NATS
+type natsClusterReply struct {
+	Status int             `json:"status"`
+	Error  string          `json:"error,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// natsCluster names the subjects and stream of one cluster on a NATS server.
+// Registering, batches and heartbeats are request-reply calls on
+// <prefix>.api.<op>; results and leaving go through the JetStream stream, so
+// they reach the coordinator in order and survive it being busy or
+// restarting its connection.
+type natsCluster struct {
+	server string // NATS server URL, less the cluster
+	prefix string // crawler.<cluster>
+	stream string // crawler_<cluster>
+}
+
+// Report whether a coordinator URL names a NATS server
+func isNATSURL(rawURL string) bool {
+	return strings.HasPrefix(rawURL, "nats://") || strings.HasPrefix(rawURL, "tls://")
+}
+
+// Parse nats://host:4222/<cluster>, the cluster defaulting to "crawler"
+func parseNATSCluster(rawURL string) (natsCluster, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return natsCluster{}, err
+	}
+	name := strings.Trim(parsedURL.Path, "/")
+	if name == "" {
+		name = defaultNATSCluster
+	}
+	if !natsClusterRegex.MatchString(name) {
+		return natsCluster{}, fmt.Errorf("invalid NATS cluster name %q: use 1-64 letters, digits, '-' or '_'", name)
+	}
+	parsedURL.Path = ""
+	return natsCluster{
+		server: parsedURL.String(),
+		prefix: "crawler." + name,
+		stream: "crawler_" + name,
+	}, nil
+}
+
+// Serve the cluster API over the NATS server at rawURL alongside HTTP, until
+// the connection is closed or lost
+func serveClusterNATS(c *coordinator, rawURL, token string) (*natsConn, error) {
+	cluster, err := parseNATSCluster(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialNATS(cluster.server, "crawler-coordinator")
+	if err != nil {
+		return nil, err
+	}
+	err = conn.resetWorkQueue(cluster.stream, []string{cluster.prefix + ".results", cluster.prefix + ".leave"})
+	if err == nil {
+		err = conn.durableConsumer(cluster.stream, natsResultsConsumer, natsResultsAckWait)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	api := cluster.prefix + ".api."
+	_, err = conn.subscribe(api+"*", func(msg natsMsg) {
+		// Handlers run on the connection's reader
+		go func() {
+			reply := natsClusterCall(c, token, strings.TrimPrefix(msg.Subject, api), msg.Data)
+			if msg.Reply != "" {
+				data, _ := json.Marshal(reply)
+				conn.publish(msg.Reply, "", data)
+			}
+		}()
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go func() {
+		for {
+			msg, ok, err := conn.next(cluster.stream, natsResultsConsumer, clusterWait)
+			if err != nil {
+				select {
+				case <-conn.closed:
+					if err := conn.failure(); err != errNATSClosed {
+						fmt.Printf("Error: lost the NATS connection: %s; workers must use the HTTP API\n", err)
+					}
+					return
+				default:
+					fmt.Printf("Error reading results from NATS: %s\n", err)
+					time.Sleep(clusterWait)
+					continue
+				}
+			}
+			if !ok {
+				continue
+			}
+			op := strings.TrimPrefix(msg.Subject, cluster.prefix+".")
+			if reply := natsClusterCall(c, token, op, msg.Data); reply.Status >= 300 && reply.Status != http.StatusGone {
+				fmt.Printf("Error: %s from NATS: %s\n", op, reply.Error)
+			}
+			conn.ack(msg)
+		}
+	}()
+	return conn, nil
+}
+
+// Run a worker's call received over NATS on the coordinator
+func natsClusterCall(c *coordinator, token, op string, data []byte) natsClusterReply {
+	var request natsClusterRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		return natsClusterReply{Status: http.StatusBadRequest, Error: err.Error()}
+	}
+	if token != "" && subtle.ConstantTimeCompare([]byte(request.Token), []byte(token)) != 1 {
+		return natsClusterReply{Status: http.StatusUnauthorized, Error: "missing or invalid token"}
+	}
+	status, response, err := c.call(op, request.Worker, request.Body)
+	if err != nil {
+		return natsClusterReply{Status: status, Error: err.Error()}
+	}
+	reply := natsClusterReply{Status: status}
+	if response != nil {
+		reply.Body, _ = json.Marshal(response)
+	}
+	return reply
+}
+
+// natsClusterTransport makes a worker's calls through a NATS server
+type natsClusterTransport struct {
+	conn    *natsConn
+	cluster natsCluster
+	name    string
+	token   string
+}
+
+// Connect a worker to its cluster through the NATS server at rawURL
+func dialNATSCluster(rawURL, name, token string) (*natsClusterTransport, error) {
+	cluster, err := parseNATSCluster(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialNATS(cluster.server, "crawler-"+name)
+	if err != nil {
+		return nil, err
+	}
+	return &natsClusterTransport{conn: conn, cluster: cluster, name: name, token: token}, nil
+}
+
+// Wrap a call's body for the coordinator
+func (t *natsClusterTransport) request(body interface{}) ([]byte, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(natsClusterRequest{Worker: t.name, Token: t.token, Body: data})
+}
+
+func (t *natsClusterTransport) call(op string, body, out interface{}) error {
+	switch op {
+	case "results":
+		return t.sendResults(body.(ClusterResults))
+	case "leave":
+		data, err := t.request(body)
+		if err != nil {
+			return err
+		}
+		return t.conn.publishStored(t.cluster.prefix+".leave", data)
+	}
+	data, err := t.request(body)
+	if err != nil {
+		return err
+	}
+	msg, err := t.conn.request(t.cluster.prefix+".api."+op, data, natsRequestTimeout)
+	if errors.Is(err, errNATSNoResponders) {
+		return clusterAPIError{http.StatusServiceUnavailable, "no coordinator is serving the cluster on NATS"}
+	}
+	if err != nil {
+		return err
+	}
+	var reply natsClusterReply
+	if err := json.Unmarshal(msg.Data, &reply); err != nil {
+		return fmt.Errorf("coordinator: %w", err)
+	}
+	if reply.Status >= 300 {
+		return clusterAPIError{reply.Status, reply.Error}
+	}
+	if out == nil || len(reply.Body) == 0 {
+		return nil
+	}
+	return json.Unmarshal(reply.Body, out)
+}
+
+// Store results in the cluster's stream, splitting them over several
+// messages when they are over the server's payload limit
+func (t *natsClusterTransport) sendResults(body ClusterResults) error {
+	data, err := t.request(body)
+	if err != nil {
+		return err
+	}
+	if len(data) <= t.conn.maxPayload {
+		return t.conn.publishStored(t.cluster.prefix+".results", data)
+	}
+	if len(body.Results) == 1 {
+		if len(body.Links) == 0 {
+			return fmt.Errorf("the result for %s is over the NATS server's payload limit", body.Results[0].URL)
+		}
+		// The page is still crawled; only the links it found are lost
+		return t.sendResults(ClusterResults{Results: body.Results})
+	}
+	half := len(body.Results) / 2
+	for _, results := range [][]Result{body.Results[:half], body.Results[half:]} {
+		part := ClusterResults{Results: results}
+		if body.Links != nil {
+			part.Links = make(map[string][]string)
+			for _, result := range results {
+				if links, ok := body.Links[result.URL]; ok {
+					part.Links[result.URL] = links
+				}
+			}
+		}
+		if err := t.sendResults(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *natsClusterTransport) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Uploads can be much larger than crawled pages, so they get their own
+// timeout rather than -timeout
+const uploadTimeout = 5 * time.Minute
+
+// Report whether -output names an object store location rather than a file
+func isRemoteOutput(dest string) bool {
+	return strings.HasPrefix(dest, "s3://") || strings.HasPrefix(dest, "https://") || strings.HasPrefix(dest, "http://")
+}
+
+// s3Location is an object in an S3 compatible store, with the credentials
+// from the standard AWS environment variables
+type s3Location struct {
+	bucket       string
+	key          string
+	region       string
+	endpoint     string // for S3 compatible stores such as MinIO; objects are addressed path-style
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// Parse an s3://bucket/key URL and read the credentials it needs
+func parseS3Location(dest string) (*s3Location, error) {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return nil, err
+	}
+	loc := &s3Location{
+		bucket:       u.Host,
+		key:          strings.TrimPrefix(u.Path, "/"),
+		region:       firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		endpoint:     strings.TrimSuffix(firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"), "/"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if loc.bucket == "" || loc.key == "" || strings.HasSuffix(loc.key, "/") {
+		return nil, fmt.Errorf("invalid S3 location %q: want s3://bucket/key", dest)
+	}
+	if loc.accessKey == "" || loc.secretKey == "" {
+		return nil, errors.New("S3 output needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if loc.region == "" {
+		loc.region = "us-east-1"
+	}
+	return loc, nil
+}
+
+// Value of the first of the environment variables that is set
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Check an object store destination before the crawl, so a typo or missing
+// credentials don't cost a whole crawl
+func checkRemoteOutput(dest string) error {
+	if strings.HasPrefix(dest, "s3://") {
+		_, err := parseS3Location(dest)
+		return err
+	}
+	_, err := url.ParseRequestURI(dest)
+	return err
+}
+
+// Upload a results file to an object store: s3:// URLs are signed with the
+// AWS credentials, http(s) URLs (e.g. presigned URLs) are used as they are
+func uploadResults(dest, filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	var req *http.Request
+	if strings.HasPrefix(dest, "s3://") {
+		loc, err := parseS3Location(dest)
+		if err != nil {
+			return err
+		}
+		req, err = loc.putRequest(data, time.Now())
+		if err != nil {
+			return err
+		}
+	} else {
+		req, err = http.NewRequest(http.MethodPut, dest, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: uploadTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Build a PUT request for the object signed with AWS Signature Version 4
+func (loc *s3Location) putRequest(data []byte, now time.Time) (*http.Request, error) {
+	var target string
+	if loc.endpoint != "" {
+		target = loc.endpoint + "/" + loc.bucket + "/" + s3EscapePath(loc.key)
+	} else {
+		target = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", loc.bucket, loc.region, s3EscapePath(loc.key))
+	}
+	req, err := http.NewRequest(http.MethodPut, target, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	payloadHash := sha256.Sum256(data)
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": hex.EncodeToString(payloadHash[:]),
+		"x-amz-date":           amzDate,
+	}
+	if loc.sessionToken != "" {
+		headers["x-amz-security-token"] = loc.sessionToken
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+		if name != "host" {
+			req.Header.Set(name, headers[name])
+		}
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodPut,
+		req.URL.EscapedPath(),
+		"", // no query string
+		canonicalHeaders.String(),
+		signedHeaders,
+		headers["x-amz-content-sha256"],
+	}, "\n")
+	scope := day + "/" + loc.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+loc.secretKey), day)
+	for _, part := range []string{loc.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		loc.accessKey, scope, signedHeaders, signature))
+	return req, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Escape an object key the way SigV4 expects: every byte but the unreserved
+// characters and slashes is percent encoded
+func s3EscapePath(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Orders accepted by -sort
+const (
+	sortInput = "input"
+	sortURL   = "url"
+	sortTime  = "time"
+)
+
+// Check a -sort value; empty keeps completion order
+func checkSortOrder(order string) error {
+	switch order {
+	case "", sortInput, sortURL, sortTime:
+		return nil
+	}
+	return fmt.Errorf("invalid -sort %q: must be input, url or time", order)
+}
+
+// Sort results so runs over the same input write comparable files. Input
+// order follows the URL list; URLs that were not on it, such as pages found
+// by a recursive crawl, come after it in URL order. Time order puts the
+// slowest URLs first.
+func sortResults(results []Result, order string, inputOrder []string) {
+	switch order {
+	case sortInput:
+		position := make(map[string]int, len(inputOrder))
+		for i, urlStr := range inputOrder {
+			if _, seen := position[urlStr]; !seen {
+				position[urlStr] = i
+			}
+		}
+		rank := func(urlStr string) int {
+			if i, ok := position[urlStr]; ok {
+				return i
+			}
+			return len(inputOrder)
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			a, b := rank(results[i].URL), rank(results[j].URL)
+			if a != b {
+				return a < b
+			}
+			return results[i].URL < results[j].URL
+		})
+	case sortURL:
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].URL < results[j].URL
+		})
+	case sortTime:
+		sort.SliceStable(results, func(i, j int) bool {
+			if results[i].TimeTaken != results[j].TimeTaken {
+				return results[i].TimeTaken > results[j].TimeTaken
+			}
+			return results[i].URL < results[j].URL
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import "fmt"
+
+// outputFormat controls the time unit and field names of the results file.
+// A file in milliseconds says so in the summary's time_unit, and is read
+// back in seconds. Files with Python field names lack the fields the
+// crawler's own subcommands and -since need.
+type outputFormat struct {
+	milliseconds bool // timings in milliseconds instead of seconds
+	python       bool // only the fields the Python crawler writes
+}
+
+// Parse -time-unit and -field-names
+func newOutputFormat(timeUnit, fieldNames string) (outputFormat, error) {
+	var format outputFormat
+	switch timeUnit {
+	case "s":
+	case "ms":
+		format.milliseconds = true
+	default:
+		return format, fmt.Errorf("invalid -time-unit %q: must be s or ms", timeUnit)
+	}
+	switch fieldNames {
+	case "go":
+	case "python":
+		format.python = true
+	default:
+		return format, fmt.Errorf("invalid -field-names %q: must be go or python", fieldNames)
+	}
+	return format, nil
+}
+
+// pythonResult and pythonSummary have exactly the fields, and field order,
+// of python_results.json
+type pythonResult struct {
+	URL       string  `json:"url"`
+	Title     string  `json:"title"`
+	Status    int     `json:"status"`
+	TimeTaken float64 `json:"time_taken"`
+	Domain    string  `json:"domain"`
+}
+
+type pythonSummary struct {
+	TotalURLs         int     `json:"total_urls"`
+	SuccessfulFetches int     `json:"successful_fetches"`
+	FailedFetches     int     `json:"failed_fetches"`
+	TimeUnit          string  `json:"time_unit,omitempty"` // only with -time-unit ms
+	TotalTime         float64 `json:"total_time"`
+	AverageTimePerURL float64 `json:"average_time_per_url"`
+}
+
+type pythonResults struct {
+	Summary pythonSummary  `json:"summary"`
+	Results []pythonResult `json:"results"`
+}
+
+// Convert a duration in seconds to the output unit
+func (f outputFormat) duration(seconds float64) float64 {
+	if f.milliseconds {
+		return seconds * 1000
+	}
+	return seconds
+}
+
+// A result as it is written
+func (f outputFormat) result(result Result) interface{} {
+	result.TimeTaken = f.duration(result.TimeTaken)
+	if f.python {
+		return pythonResult{result.URL, result.Title, result.Status, result.TimeTaken, result.Domain}
+	}
+	return result
+}
+
+// A summary as it is written
+func (f outputFormat) summary(summary Summary) interface{} {
+	summary.TotalTime = f.duration(summary.TotalTime)
+	summary.AverageTimePerURL = f.duration(summary.AverageTimePerURL)
+	if f.milliseconds {
+		summary.TimeUnit = "ms"
+	}
+	if f.python {
+		return pythonSummary{summary.TotalURLs, summary.SuccessfulFetches, summary.FailedFetches, summary.TimeUnit, summary.TotalTime, summary.AverageTimePerURL}
+	}
+	return summary
+}
+
+// Convert the timings of a results file written with -time-unit ms back to
+// seconds, which is what every reader of results files works in
+func (c *CombinedResults) toSeconds() {
+	if c.Summary.TimeUnit != "ms" {
+		return
+	}
+	c.Summary.TimeUnit = ""
+	c.Summary.TotalTime /= 1000
+	c.Summary.AverageTimePerURL /= 1000
+	for i := range c.Results {
+		c.Results[i].TimeTaken /= 1000
+	}
+}
+
+// The whole results file as it is written
+func (f outputFormat) combined(combined CombinedResults) interface{} {
+	if f == (outputFormat{}) {
+		return combined
+	}
+	if f.python {
+		converted := pythonResults{Summary: f.summary(combined.Summary).(pythonSummary), Results: make([]pythonResult, len(combined.Results))}
+		for i, result := range combined.Results {
+			converted.Results[i] = f.result(result).(pythonResult)
+		}
+		return converted
+	}
+
+	combined.Summary = f.summary(combined.Summary).(Summary)
+	results := make([]Result, len(combined.Results))
+	for i, result := range combined.Results {
+		results[i] = f.result(result).(Result)
+	}
+	combined.Results = results
+	return combined
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A results file in milliseconds says so, and is read back in seconds
+func TestTimeUnitReadBack(t *testing.T) {
+	combined := CombinedResults{
+		Summary: Summary{TotalURLs: 2, TotalTime: 3, AverageTimePerURL: 1.5},
+		Results: []Result{{URL: "https://a.example/", TimeTaken: 1.25}, {URL: "https://b.example/", TimeTaken: 0.5}},
+	}
+	for _, tc := range []struct {
+		timeUnit, fieldNames string
+		marked               bool
+	}{
+		{"s", "go", false},
+		{"ms", "go", true},
+		{"s", "python", false},
+		{"ms", "python", true},
+	} {
+		format, err := newOutputFormat(tc.timeUnit, tc.fieldNames)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "results.json")
+		if err := saveResults(combined, format, path); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if marked := strings.Contains(string(data), `"time_unit": "ms"`); marked != tc.marked {
+			t.Errorf("-time-unit %s -field-names %s: time_unit recorded %v, want %v", tc.timeUnit, tc.fieldNames, marked, tc.marked)
+		}
+
+		loaded, err := loadResults(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.Summary.TimeUnit != "" || loaded.Summary.TotalTime != 3 || loaded.Summary.AverageTimePerURL != 1.5 {
+			t.Errorf("-time-unit %s -field-names %s: read back summary %+v", tc.timeUnit, tc.fieldNames, loaded.Summary)
+		}
+		if len(loaded.Results) != 2 || loaded.Results[0].TimeTaken != 1.25 || loaded.Results[1].TimeTaken != 0.5 {
+			t.Errorf("-time-unit %s -field-names %s: read back results %+v", tc.timeUnit, tc.fieldNames, loaded.Results)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/msaberp/web-crawler-comparison/go-crawler/pool"
+)
+
+// pipelineItem carries a fetched URL from the fetch stage to the parse stage
+type pipelineItem struct {
+	result Result
+	page   *fetchedPage
+}
+
+// Start the crawl workers. Up to queue URLs wait for a free fetcher. With
+// opts.parsers set, fetching and parsing run as separate stages so slow
+// parsing of large pages doesn't hold up fetchers; otherwise each worker
+// does both. Once ctx is done, queued URLs are dropped without a result.
+func startWorkers(ctx context.Context, maxWorkers, queue int, client *http.Client, opts *fetchOptions) *pool.Pool[string, Result] {
+	if opts.parsers <= 0 {
+		return pool.New(ctx, maxWorkers, queue, func(urlStr string) Result {
+			opts.begin()
+			result, page := fetchStage(urlStr, client, opts)
+			result = parseStage(result, page, client, opts)
+			opts.record(result)
+			return result
+		}, func(urlStr string, recovered any) Result {
+			return panicResult(urlStr, recovered, opts)
+		})
+	}
+
+	fetchers := pool.New(ctx, maxWorkers, queue, func(urlStr string) pipelineItem {
+		opts.begin()
+		result, page := fetchStage(urlStr, client, opts)
+		return pipelineItem{result, page}
+	}, func(urlStr string, recovered any) pipelineItem {
+		return pipelineItem{result: errorResult(urlStr, panicError(recovered), time.Now(), "")}
+	})
+	// Fetched pages are always parsed, even after the crawl is stopped
+	parsers := pool.New(context.Background(), opts.parsers, opts.parsers, func(item pipelineItem) Result {
+		result := parseStage(item.result, item.page, client, opts)
+		opts.record(result)
+		return result
+	}, func(item pipelineItem, recovered any) Result {
+		return panicResult(item.result.URL, recovered, opts)
+	})
+	return pool.Pipe(fetchers, parsers)
+}
+
+// Build and record the result for a URL whose worker panicked
+func panicResult(urlStr string, recovered any, opts *fetchOptions) Result {
+	result := errorResult(urlStr, panicError(recovered), time.Now(), "")
+	opts.record(result)
+	return result
+}
+
+// Describe a recovered panic as an error
+func panicError(recovered any) error {
+	return fmt.Errorf("worker panic: %v", recovered)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Config file key holding per-domain politeness, which is not a flag
+const domainsConfigKey = "domains"
+
+// domainPolicy limits the requests to one host
+type domainPolicy struct {
+	RPS            float64 `json:"rps"`             // steady request rate (0 means no limit)
+	Burst          int     `json:"burst"`           // requests that may start at once after an idle spell
+	MaxConcurrency int     `json:"max_concurrency"` // requests in flight at once (0 means no limit)
+}
+
+// Parse the domains section of a config file. Keys are host names,
+// "*.example.com" for its subdomains or "*" for every other host.
+func parseDomainPolicies(value interface{}) (map[string]domainPolicy, error) {
+	if value == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var policies map[string]domainPolicy
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&policies); err != nil {
+		return nil, fmt.Errorf("config key %q: %w", domainsConfigKey, err)
+	}
+	for pattern, policy := range policies {
+		if policy.RPS < 0 || policy.Burst < 0 || policy.MaxConcurrency < 0 {
+			return nil, fmt.Errorf("config key %q: %s: limits must not be negative", domainsConfigKey, pattern)
+		}
+		if strings.Contains(strings.TrimPrefix(pattern, "*."), "*") && pattern != "*" {
+			return nil, fmt.Errorf("config key %q: %s: only a leading \"*.\" or \"*\" alone is supported", domainsConfigKey, pattern)
+		}
+	}
+	return policies, nil
+}
+
+// domainLimits applies per-domain policies, with separate limits for each
+// host a pattern matches
+type domainLimits struct {
+	policies map[string]domainPolicy
+
+	mu    sync.Mutex
+	hosts map[string]*hostLimit
+}
+
+// hostLimit is the live state of one host's policy
+type hostLimit struct {
+	limiter *rateLimiter  // nil without a rate limit
+	slots   chan struct{} // nil without a concurrency limit
+}
+
+func newDomainLimits(policies map[string]domainPolicy) *domainLimits {
+	return &domainLimits{policies: policies, hosts: make(map[string]*hostLimit)}
+}
+
+// Find the policy for a host: an exact match, then the most specific
+// "*." pattern, then "*"
+func (d *domainLimits) policy(host string) (domainPolicy, bool) {
+	if policy, ok := d.policies[host]; ok {
+		return policy, true
+	}
+	for suffix := host; ; {
+		dot := strings.IndexByte(suffix, '.')
+		if dot < 0 {
+			break
+		}
+		suffix = suffix[dot+1:]
+		if policy, ok := d.policies["*."+suffix]; ok {
+			return policy, true
+		}
+	}
+	policy, ok := d.policies["*"]
+	return policy, ok
+}
+
+// Wait until a request to host may start under its policy, returning a
+// function to call once the response has been read
+func (d *domainLimits) acquire(host string) (release func()) {
+	host = strings.ToLower(host)
+	d.mu.Lock()
+	limit, ok := d.hosts[host]
+	if !ok {
+		limit = &hostLimit{}
+		if policy, found := d.policy(host); found {
+			if policy.RPS > 0 {
+				limit.limiter = newRateLimiter(policy.RPS, policy.Burst)
+			}
+			if policy.MaxConcurrency > 0 {
+				limit.slots = make(chan struct{}, policy.MaxConcurrency)
+			}
+		}
+		d.hosts[host] = limit
+	}
+	d.mu.Unlock()
+
+	if limit.slots != nil {
+		limit.slots <- struct{}{}
+	}
+	if limit.limiter != nil {
+		limit.limiter.wait()
+	}
+	return func() {
+		if limit.slots != nil {
+			<-limit.slots
+		}
+	}
+}
+
+// Describe the policies for the crawl log, most specific first
+func (d *domainLimits) describe() []string {
+	patterns := make([]string, 0, len(d.policies))
+	for pattern := range d.policies {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if (patterns[i] == "*") != (patterns[j] == "*") {
+			return patterns[j] == "*"
+		}
+		return patterns[i] < patterns[j]
+	})
+	lines := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		policy := d.policies[pattern]
+		rate, concurrency := "no rate limit", "no concurrency limit"
+		if policy.RPS > 0 {
+			rate = fmt.Sprintf("%g rps, burst %d", policy.RPS, max(policy.Burst, 1))
+		}
+		if policy.MaxConcurrency > 0 {
+			concurrency = fmt.Sprintf("max concurrency %d", policy.MaxConcurrency)
+		}
+		lines[i] = fmt.Sprintf("%s: %s, %s", pattern, rate, concurrency)
+	}
+	return lines
+}
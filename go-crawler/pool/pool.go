@@ -0,0 +1,160 @@
+// Package pool runs work over a fixed number of goroutines: Pool feeds jobs
+// to workers and delivers their results, and Group runs tasks that stop
+// together on the first error. It depends on the standard library alone.
+package pool
+
+import (
+	"context"
+	"sync"
+)
+
+// Pool runs a function over submitted jobs with a fixed number of workers.
+// A panicking job is turned into a result by the onPanic function instead of
+// taking the process down.
+type Pool[J, R any] struct {
+	jobs      chan J
+	results   chan R
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeJobs *sync.Once
+}
+
+// New starts a pool of workers calling work for each job. Up to queue jobs
+// wait for a free worker before Submit blocks. Once ctx is done, queued jobs
+// are dropped without running.
+func New[J, R any](ctx context.Context, workers, queue int, work func(J) R, onPanic func(J, any) R) *Pool[J, R] {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &Pool[J, R]{
+		jobs:      make(chan J, queue),
+		results:   make(chan R, workers),
+		ctx:       ctx,
+		cancel:    cancel,
+		closeJobs: &sync.Once{},
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range p.jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				p.results <- runJob(job, work, onPanic)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		cancel()
+		close(p.results)
+	}()
+	return p
+}
+
+func runJob[J, R any](job J, work func(J) R, onPanic func(J, any) R) (result R) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			result = onPanic(job, recovered)
+		}
+	}()
+	return work(job)
+}
+
+// Submit queues a job, blocking while the queue is full. It returns false if
+// the pool was cancelled first.
+func (p *Pool[J, R]) Submit(job J) bool {
+	if p.ctx.Err() != nil {
+		return false
+	}
+	select {
+	case p.jobs <- job:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+// Close signals that no more jobs will be submitted
+func (p *Pool[J, R]) Close() {
+	p.closeJobs.Do(func() { close(p.jobs) })
+}
+
+// Results delivers results in completion order. The channel is closed once
+// the pool is closed and every job has finished.
+func (p *Pool[J, R]) Results() <-chan R {
+	return p.results
+}
+
+// Collect closes the pool and waits for all remaining results
+func (p *Pool[J, R]) Collect() []R {
+	p.Close()
+	var results []R
+	for result := range p.results {
+		results = append(results, result)
+	}
+	return results
+}
+
+// Cancel stops the pool: queued jobs are dropped and Submit fails. Jobs
+// already running finish and deliver their results.
+func (p *Pool[J, R]) Cancel() {
+	p.cancel()
+}
+
+// Pipe feeds the results of one pool into another, returning a pool that
+// takes jobs like the first and delivers results like the second. Cancelling
+// it cancels the first stage; work already handed on still completes.
+func Pipe[A, B, C any](first *Pool[A, B], second *Pool[B, C]) *Pool[A, C] {
+	go func() {
+		for result := range first.results {
+			second.jobs <- result
+		}
+		second.Close()
+	}()
+	return &Pool[A, C]{
+		jobs:      first.jobs,
+		results:   second.results,
+		ctx:       first.ctx,
+		cancel:    first.cancel,
+		closeJobs: first.closeJobs,
+	}
+}
+
+// Group runs goroutines that share a lifecycle, in the manner of
+// golang.org/x/sync/errgroup: the first error cancels the group's context
+// and is returned by Wait.
+type Group struct {
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+	once   sync.Once
+	err    error
+}
+
+// NewGroup creates a task group and the context its tasks should watch
+func NewGroup(ctx context.Context) (*Group, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Group{cancel: cancel}, ctx
+}
+
+// Go runs a task in its own goroutine
+func (g *Group) Go(task func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := task(); err != nil {
+			g.once.Do(func() {
+				g.err = err
+				g.cancel()
+			})
+		}
+	}()
+}
+
+// Wait for every task and return the first error
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
@@ -0,0 +1,174 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func double(n int) int { return 2 * n }
+
+func noPanic(n int, recovered any) int { return -1 }
+
+// A single worker delivers results in the order jobs were submitted
+func TestPoolOrder(t *testing.T) {
+	p := New(context.Background(), 1, 10, double, noPanic)
+	for i := 0; i < 10; i++ {
+		if !p.Submit(i) {
+			t.Fatalf("Submit(%d) refused", i)
+		}
+	}
+	results := p.Collect()
+	for i, result := range results {
+		if result != 2*i {
+			t.Fatalf("result %d is %d, want %d: %v", i, result, 2*i, results)
+		}
+	}
+	if len(results) != 10 {
+		t.Fatalf("got %d results, want 10", len(results))
+	}
+}
+
+// Many workers deliver one result per job, in completion order
+func TestPoolAllResults(t *testing.T) {
+	p := New(context.Background(), 8, 4, double, noPanic)
+	go func() {
+		for i := 0; i < 100; i++ {
+			p.Submit(i)
+		}
+		p.Close()
+	}()
+	var results []int
+	for result := range p.Results() {
+		results = append(results, result)
+	}
+	sort.Ints(results)
+	if len(results) != 100 {
+		t.Fatalf("got %d results, want 100", len(results))
+	}
+	for i, result := range results {
+		if result != 2*i {
+			t.Fatalf("missing or repeated result %d: %v", 2*i, results)
+		}
+	}
+}
+
+// Cancelling drops queued jobs and refuses new ones; the job running
+// finishes and delivers its result
+func TestPoolCancel(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var ran atomic.Int32
+	p := New(context.Background(), 1, 5, func(n int) int {
+		if ran.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		return n
+	}, noPanic)
+	for i := 0; i < 5; i++ {
+		p.Submit(i)
+	}
+	<-started
+	p.Cancel()
+	close(release)
+	if p.Submit(99) {
+		t.Errorf("Submit accepted a job after Cancel")
+	}
+	results := p.Collect()
+	if len(results) != 1 || results[0] != 0 || ran.Load() != 1 {
+		t.Errorf("got results %v from %d jobs run, want [0] from 1", results, ran.Load())
+	}
+}
+
+// Cancelling the context the pool was started with stops it too
+func TestPoolContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := New(ctx, 2, 0, double, noPanic)
+	cancel()
+	if p.Submit(1) {
+		t.Errorf("Submit accepted a job after the context was cancelled")
+	}
+	if results := p.Collect(); len(results) != 0 {
+		t.Errorf("got results %v, want none", results)
+	}
+}
+
+// A panicking job becomes a result instead of taking the pool down
+func TestPoolPanic(t *testing.T) {
+	p := New(context.Background(), 2, 3, func(n int) string {
+		if n == 2 {
+			panic("bad job")
+		}
+		return fmt.Sprint(n)
+	}, func(n int, recovered any) string {
+		return fmt.Sprintf("%d panicked: %v", n, recovered)
+	})
+	for i := 1; i <= 3; i++ {
+		p.Submit(i)
+	}
+	results := p.Collect()
+	sort.Strings(results)
+	want := []string{"1", "2 panicked: bad job", "3"}
+	if fmt.Sprint(results) != fmt.Sprint(want) {
+		t.Errorf("got %q, want %q", results, want)
+	}
+}
+
+// Piped pools run every job through both stages
+func TestPipe(t *testing.T) {
+	first := New(context.Background(), 2, 2, double, noPanic)
+	second := New(context.Background(), 2, 2, func(n int) string { return fmt.Sprint(n) }, func(n int, recovered any) string { return "" })
+	p := Pipe(first, second)
+	for i := 0; i < 5; i++ {
+		p.Submit(i)
+	}
+	results := p.Collect()
+	sort.Strings(results)
+	if want := []string{"0", "2", "4", "6", "8"}; fmt.Sprint(results) != fmt.Sprint(want) {
+		t.Errorf("got %q, want %q", results, want)
+	}
+}
+
+// The first error cancels the group's context and is returned by Wait
+func TestGroupError(t *testing.T) {
+	first := errors.New("first")
+	g, ctx := NewGroup(context.Background())
+	g.Go(func() error { return first })
+	g.Go(func() error {
+		select {
+		case <-ctx.Done():
+			return errors.New("second")
+		case <-time.After(5 * time.Second):
+			return nil
+		}
+	})
+	if err := g.Wait(); err != first {
+		t.Errorf("Wait returned %v, want %v", err, first)
+	}
+	if ctx.Err() == nil {
+		t.Errorf("context not cancelled after an error")
+	}
+}
+
+// Wait returns nil once every task succeeds, and cancels the context
+func TestGroupSuccess(t *testing.T) {
+	g, ctx := NewGroup(context.Background())
+	var done atomic.Int32
+	for i := 0; i < 3; i++ {
+		g.Go(func() error {
+			done.Add(1)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil || done.Load() != 3 {
+		t.Errorf("Wait returned %v after %d tasks, want nil after 3", err, done.Load())
+	}
+	if ctx.Err() == nil {
+		t.Errorf("context not cancelled after Wait")
+	}
+}
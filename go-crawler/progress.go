@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ThroughputSample is the crawl throughput over one sampling interval
+type ThroughputSample struct {
+	Second            float64 `json:"second"` // end of the interval since the crawl started
+	Requests          int     `json:"requests"`
+	Errors            int     `json:"errors"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	ErrorRate         float64 `json:"error_rate"`
+}
+
+// crawlProgress counts finished URLs as workers report them and samples
+// throughput at a fixed interval
+type crawlProgress struct {
+	mu       sync.Mutex
+	interval time.Duration
+	start    time.Time
+	requests int // fetched URLs in the current interval
+	errors   int // failed fetches in the current interval
+	last     time.Time
+	series   []ThroughputSample
+
+	// Live state for the terminal dashboard
+	busy       int
+	queued     int
+	completed  int
+	failed     int
+	workers    int
+	ended      time.Time
+	recent     []ResultBrief // latest failures, oldest first
+	latest     []ResultBrief // latest results, oldest first
+	errorKinds map[string]int
+	domains    map[string]*domainTiming
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// domainTiming accumulates fetch times for one domain
+type domainTiming struct {
+	requests int
+	total    float64
+}
+
+// Start sampling throughput every interval
+func startProgress(interval time.Duration, workers int) *crawlProgress {
+	now := time.Now()
+	p := &crawlProgress{
+		interval:   interval,
+		start:      now,
+		last:       now,
+		workers:    workers,
+		errorKinds: make(map[string]int),
+		domains:    make(map[string]*domainTiming),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.sample(time.Now())
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// Number of recent failures and results kept for dashboards
+const (
+	recentFailures = 5
+	recentResults  = 20
+)
+
+// Count URLs added to the crawl queue
+func (p *crawlProgress) enqueue(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queued += n
+}
+
+// Note that a worker took a URL off the queue
+func (p *crawlProgress) begin() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queued--
+	p.busy++
+}
+
+// Note that a worker put its URL back on the queue
+func (p *crawlProgress) requeue() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.busy--
+	p.queued++
+}
+
+// Count a finished URL. Skipped URLs were not fetched and are left out of
+// the throughput.
+func (p *crawlProgress) record(result Result) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.busy--
+	p.completed++
+	if result.SkipReason != "" {
+		return
+	}
+
+	p.requests++
+	brief := ResultBrief{URL: result.URL, Status: result.Status, Title: result.Title, TimeTaken: result.TimeTaken}
+	if !resultSucceeded(result) {
+		brief.Failed = true
+		p.errors++
+		p.failed++
+		p.errorKinds[errorKind(result)]++
+		p.recent = append(p.recent, brief)
+		if len(p.recent) > recentFailures {
+			p.recent = p.recent[1:]
+		}
+	}
+	p.latest = append(p.latest, brief)
+	if len(p.latest) > recentResults {
+		p.latest = p.latest[1:]
+	}
+
+	timing := p.domains[result.Domain]
+	if timing == nil {
+		timing = &domainTiming{}
+		p.domains[result.Domain] = timing
+	}
+	timing.requests++
+	timing.total += result.TimeTaken
+}
+
+func (p *crawlProgress) sample(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	elapsed := now.Sub(p.last).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	sample := ThroughputSample{
+		Second:            now.Sub(p.start).Seconds(),
+		Requests:          p.requests,
+		Errors:            p.errors,
+		RequestsPerSecond: float64(p.requests) / elapsed,
+	}
+	if p.requests > 0 {
+		sample.ErrorRate = float64(p.errors) / float64(p.requests)
+	}
+	p.series = append(p.series, sample)
+	p.requests, p.errors, p.last = 0, 0, now
+}
+
+// Stop sampling and return the series. The final partial interval becomes
+// its own sample, or is folded into the previous one when it is too short
+// to give a meaningful rate.
+func (p *crawlProgress) finish() []ThroughputSample {
+	close(p.stop)
+	<-p.done
+
+	now := time.Now()
+	p.mu.Lock()
+	if n := len(p.series); n > 0 && now.Sub(p.last) < p.interval/2 {
+		previous := &p.series[n-1]
+		previousStart := previous.Second - p.interval.Seconds()
+		previous.Second = now.Sub(p.start).Seconds()
+		previous.Requests += p.requests
+		previous.Errors += p.errors
+		previous.RequestsPerSecond = float64(previous.Requests) / (previous.Second - previousStart)
+		if previous.Requests > 0 {
+			previous.ErrorRate = float64(previous.Errors) / float64(previous.Requests)
+		}
+		p.requests, p.errors, p.last = 0, 0, now
+	}
+	p.mu.Unlock()
+
+	if p.requests > 0 || len(p.series) == 0 {
+		p.sample(now)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ended = now
+	return p.series
+}
+
+// ResultBrief is the part of a result shown on live dashboards
+type ResultBrief struct {
+	URL       string  `json:"url"`
+	Status    int     `json:"status"`
+	Title     string  `json:"title"`
+	TimeTaken float64 `json:"time_taken"`
+	Failed    bool    `json:"failed"`
+}
+
+// SlowDomain is a domain and its average fetch time
+type SlowDomain struct {
+	Domain      string  `json:"domain"`
+	AverageTime float64 `json:"average_time"`
+	URLs        int     `json:"urls"`
+}
+
+// ProgressSnapshot is a consistent view of the live crawl state
+type ProgressSnapshot struct {
+	Elapsed           float64        `json:"elapsed"`
+	Finished          bool           `json:"finished"`
+	Workers           int            `json:"workers"`
+	Busy              int            `json:"busy"`
+	Queued            int            `json:"queued"`
+	Completed         int            `json:"completed"`
+	Failed            int            `json:"failed"`
+	RequestsPerSecond float64        `json:"requests_per_second"`
+	ErrorBreakdown    map[string]int `json:"error_breakdown"`
+	RecentErrors      []ResultBrief  `json:"recent_errors"`  // newest first
+	RecentResults     []ResultBrief  `json:"recent_results"` // newest first
+	SlowDomains       []SlowDomain   `json:"slow_domains"`
+}
+
+// Capture the live state, with the slowest domains by average fetch time
+func (p *crawlProgress) snapshot(slowest int) ProgressSnapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	end := time.Now()
+	if !p.ended.IsZero() {
+		end = p.ended
+	}
+	snapshot := ProgressSnapshot{
+		Elapsed:        end.Sub(p.start).Seconds(),
+		Finished:       !p.ended.IsZero(),
+		Workers:        p.workers,
+		Busy:           p.busy,
+		Queued:         p.queued,
+		Completed:      p.completed,
+		Failed:         p.failed,
+		ErrorBreakdown: make(map[string]int, len(p.errorKinds)),
+		RecentErrors:   newestFirst(p.recent),
+		RecentResults:  newestFirst(p.latest),
+		SlowDomains:    []SlowDomain{},
+	}
+	for kind, count := range p.errorKinds {
+		snapshot.ErrorBreakdown[kind] = count
+	}
+	if n := len(p.series); n > 0 {
+		snapshot.RequestsPerSecond = p.series[n-1].RequestsPerSecond
+	}
+
+	for domain, timing := range p.domains {
+		snapshot.SlowDomains = append(snapshot.SlowDomains, SlowDomain{domain, timing.total / float64(timing.requests), timing.requests})
+	}
+	sort.Slice(snapshot.SlowDomains, func(i, j int) bool {
+		a, b := snapshot.SlowDomains[i], snapshot.SlowDomains[j]
+		if a.AverageTime != b.AverageTime {
+			return a.AverageTime > b.AverageTime
+		}
+		return a.Domain < b.Domain
+	})
+	if len(snapshot.SlowDomains) > slowest {
+		snapshot.SlowDomains = snapshot.SlowDomains[:slowest]
+	}
+	return snapshot
+}
+
+func newestFirst(results []ResultBrief) []ResultBrief {
+	reversed := make([]ResultBrief, len(results))
+	for i, result := range results {
+		reversed[len(results)-1-i] = result
+	}
+	return reversed
+}
+
+// Group a failed result for the error breakdown
+func errorKind(result Result) string {
+	switch {
+	case result.Timeout != "":
+		return "timeout: " + result.Timeout
+	case result.Status <= 0:
+		return "request error"
+	case result.AssertionFailed != "" && statusSucceeded(result.Status):
+		return "body assertion"
+	default:
+		return fmt.Sprintf("HTTP %d", result.Status)
+	}
+}
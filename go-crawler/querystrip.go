@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Query parameters that only track where a visitor came from
+var trackingParams = []string{"utm_*", "gclid", "gbraid", "wbraid", "dclid", "fbclid", "msclkid", "yclid", "mc_cid", "mc_eid", "igshid", "_ga", "_gl"}
+
+// paramRules lists query parameters to drop: exact names, or prefixes
+// ending in *
+type paramRules []string
+
+// Query parameters dropped from URLs, set from -strip-params before the crawl
+var strippedParams paramRules
+
+// Parse a -strip-params list. "tracking" stands for the common tracking
+// parameters.
+func parseParamRules(spec string) paramRules {
+	var rules paramRules
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "":
+		case "tracking":
+			rules = append(rules, trackingParams...)
+		default:
+			rules = append(rules, name)
+		}
+	}
+	return rules
+}
+
+// Report whether a parameter name matches a rule
+func (rules paramRules) match(name string) bool {
+	for _, rule := range rules {
+		if prefix, ok := strings.CutSuffix(rule, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// Drop matching parameters from a raw query, keeping the others as they
+// were written and in order
+func (rules paramRules) strip(rawQuery string) string {
+	if len(rules) == 0 || rawQuery == "" {
+		return rawQuery
+	}
+	var kept []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		name, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if !rules.match(name) {
+			kept = append(kept, pair)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+// Drop matching parameters from a URL; URLs that don't parse are returned
+// as they are
+func stripQueryParams(rawURL string) string {
+	if len(strippedParams) == 0 {
+		return rawURL
+	}
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || parsedURL.RawQuery == "" {
+		return rawURL
+	}
+	parsedURL.RawQuery = strippedParams.strip(parsedURL.RawQuery)
+	return parsedURL.String()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter spaces requests out to a steady rate. Capacity left unused
+// while idle builds up to burst requests, which may then start at once.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration // between requests at the steady rate
+	burst    int
+	next     time.Time // when the next request may start
+}
+
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / rps), burst: burst}
+}
+
+// Block until a request may start. Callers are served in the order they
+// arrive, each taking the next free slot.
+func (l *rateLimiter) wait() {
+	l.mu.Lock()
+	now := time.Now()
+	if earliest := now.Add(-time.Duration(l.burst-1) * l.interval); l.next.Before(earliest) {
+		l.next = earliest
+	}
+	at := l.next
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay := time.Until(at); delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// Take a slot if one is free now, without waiting. Returns 0 when it was
+// taken, otherwise how long until the next slot.
+func (l *rateLimiter) tryTake() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if earliest := now.Add(-time.Duration(l.burst-1) * l.interval); l.next.Before(earliest) {
+		l.next = earliest
+	}
+	if l.next.After(now) {
+		return l.next.Sub(now)
+	}
+	l.next = l.next.Add(l.interval)
+	return 0
+}
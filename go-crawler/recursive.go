@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"time"
+)
+
+// recursiveOptions configures link following and the crawl frontier
+type recursiveOptions struct {
+	maxDepth      int     // link depth to follow from the seeds
+	maxPages      int     // cap on fetches, 0 means no limit
+	frontierDir   string  // keep the frontier on disk in this directory
+	bloomFPRate   float64 // use a bloom filter visited set with this false positive rate
+	bloomCapacity int     // expected number of URLs for sizing the bloom filter
+}
+
+// Open the frontier selected by the options
+func openFrontier(ropts recursiveOptions) (Frontier, error) {
+	if ropts.frontierDir != "" {
+		if ropts.bloomFPRate > 0 {
+			return nil, fmt.Errorf("a bloom filter visited set cannot be combined with a disk frontier")
+		}
+		diskFrontier, err := openDiskFrontier(ropts.frontierDir)
+		if err != nil {
+			return nil, fmt.Errorf("opening frontier: %w", err)
+		}
+		if diskFrontier.Len() > 0 {
+			fmt.Printf("Resuming crawl with %d queued URLs from %s\n", diskFrontier.Len(), ropts.frontierDir)
+		}
+		return diskFrontier, nil
+	}
+
+	if ropts.bloomFPRate > 0 {
+		if ropts.bloomFPRate >= 1 {
+			return nil, fmt.Errorf("bloom filter false positive rate must be between 0 and 1")
+		}
+		return newMemoryFrontier(newBloomFilter(ropts.bloomCapacity, ropts.bloomFPRate)), nil
+	}
+	return newMemoryFrontier(newMapSet()), nil
+}
+
+// Run a recursive crawl with the configured frontier, returning the results,
+// whether it stopped early with URLs still queued, and visited set statistics
+func runRecursiveCrawl(ctx context.Context, seeds []string, maxWorkers int, client *http.Client, opts *fetchOptions, ropts recursiveOptions) ([]Result, bool, *VisitedSetStats, error) {
+	frontier, err := openFrontier(ropts)
+	if err != nil {
+		return nil, false, nil, err
+	}
+
+	results, waiting, err := crawlRecursive(ctx, seeds, frontier, maxWorkers, client, opts, ropts.maxDepth, ropts.maxPages)
+	truncated := ctx.Err() != nil && (frontier.Len() > 0 || waiting > 0)
+	stats := frontier.Stats()
+	if closeErr := frontier.Close(); err == nil {
+		err = closeErr
+	}
+	return results, truncated, &stats, err
+}
+
+// Crawl the seed URLs and, breadth first, the links discovered from them up
+// to maxDepth, staying on the seed hosts. maxPages caps the number of fetches
+// (0 means no limit). Dispatching stops once ctx is done. Results are
+// returned in completion order, along with the number of URLs requeued
+// because of Retry-After that were left waiting.
+func crawlRecursive(ctx context.Context, seeds []string, frontier Frontier, maxWorkers int, client *http.Client, opts *fetchOptions, maxDepth, maxPages int) ([]Result, int, error) {
+	// Only follow links to hosts that were seeded
+	hosts := make(map[string]bool)
+	for _, seed := range seeds {
+		// Malformed seeds are queued as-is so the fetch error is reported
+		job := crawlJob{URL: seed}
+		if normalized, err := normalizeURL(seed); err == nil {
+			job.URL = normalized
+		}
+		// Keep input data reachable under the normalized URL; workers
+		// have not started yet so the map can still be written
+		if entry, ok := opts.inputs[seed]; ok {
+			opts.inputs[job.URL] = entry
+		}
+		if parsedURL, err := url.Parse(job.URL); err == nil {
+			hosts[parsedURL.Host] = true
+		}
+		added, err := frontier.Push(job)
+		if err != nil {
+			return nil, 0, err
+		}
+		if added {
+			opts.enqueue(1)
+		}
+	}
+
+	// The dispatcher enforces ctx; every dispatched job must produce a result
+	workers := startWorkers(context.Background(), maxWorkers, maxWorkers, client, opts)
+
+	// Depth of each URL currently being fetched
+	inFlight := make(map[string]int)
+	// URLs requeued because of Retry-After, soonest first
+	var waiting []requeuedJob
+	var resultsList []Result
+	var crawlErr error
+	dispatched := 0
+
+	for {
+		// Requeued URLs whose delay has passed go before new ones
+		now := time.Now()
+		for crawlErr == nil && ctx.Err() == nil && len(inFlight) < maxWorkers && len(waiting) > 0 && !waiting[0].at.After(now) {
+			inFlight[waiting[0].URL] = waiting[0].Depth
+			workers.Submit(waiting[0].URL)
+			waiting = waiting[1:]
+		}
+
+		// Keep every worker busy while the frontier has work
+		for crawlErr == nil && ctx.Err() == nil && len(inFlight) < maxWorkers && (maxPages == 0 || dispatched < maxPages) {
+			job, ok, err := frontier.Pop()
+			if err != nil {
+				crawlErr = err
+				break
+			}
+			if !ok {
+				break
+			}
+			inFlight[job.URL] = job.Depth
+			workers.Submit(job.URL)
+			dispatched++
+		}
+
+		if len(inFlight) == 0 && (len(waiting) == 0 || crawlErr != nil || ctx.Err() != nil) {
+			break
+		}
+
+		// Wake up for the next requeued URL if a worker is free for it, or
+		// to stop when nothing is in flight
+		var timer *time.Timer
+		var wake <-chan time.Time
+		var stop <-chan struct{}
+		if len(waiting) > 0 && len(inFlight) < maxWorkers {
+			timer = time.NewTimer(time.Until(waiting[0].at))
+			wake = timer.C
+		}
+		if len(inFlight) == 0 {
+			stop = ctx.Done()
+		}
+		var result Result
+		received := false
+		select {
+		case result = <-workers.Results():
+			received = true
+		case <-wake:
+		case <-stop:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if !received {
+			continue
+		}
+		depth := inFlight[result.URL]
+		delete(inFlight, result.URL)
+
+		if result.requeueAfter > 0 {
+			job := requeuedJob{crawlJob{URL: result.URL, Depth: depth}, time.Now().Add(result.requeueAfter)}
+			i := sort.Search(len(waiting), func(i int) bool { return waiting[i].at.After(job.at) })
+			waiting = slices.Insert(waiting, i, job)
+			continue
+		}
+		result.Depth = depth
+
+		if crawlErr == nil && result.Depth < maxDepth {
+			for _, link := range result.Links {
+				if opts.rewriter != nil {
+					link = opts.rewriter.rewrite(link)
+				}
+				parsedURL, err := url.Parse(link)
+				if err != nil || !hosts[parsedURL.Host] {
+					continue
+				}
+				added, err := frontier.Push(crawlJob{URL: link, Depth: result.Depth + 1})
+				if err != nil {
+					crawlErr = err
+					break
+				}
+				if added {
+					opts.enqueue(1)
+				}
+			}
+		}
+
+		if crawlErr == nil {
+			resultsList, crawlErr = opts.store(resultsList, result)
+		}
+	}
+
+	workers.Collect()
+
+	// URLs still waiting out a Retry-After were popped already; put them
+	// back so that a disk frontier resumed later fetches them
+	for _, job := range waiting {
+		if err := frontier.Requeue(job.crawlJob); err != nil && crawlErr == nil {
+			crawlErr = err
+		}
+	}
+
+	return resultsList, len(waiting), crawlErr
+}
+
+// requeuedJob is a URL to fetch again once a Retry-After delay has passed
+type requeuedJob struct {
+	crawlJob
+	at time.Time
+}
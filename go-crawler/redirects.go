@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Redirect types in a redirect chain
+const (
+	redirectHTTP        = "http"
+	redirectMetaRefresh = "meta-refresh"
+)
+
+// Redirect is one hop of a redirect chain: the URL that redirected and how
+type Redirect struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+	Type   string `json:"type"`
+}
+
+// Rebuild the HTTP redirects the client followed to reach a response
+func redirectChain(resp *http.Response) []Redirect {
+	var chain []Redirect
+	for req := resp.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		hop := Redirect{URL: req.Response.Request.URL.String(), Status: req.Response.StatusCode, Type: redirectHTTP}
+		chain = append([]Redirect{hop}, chain...)
+	}
+	return chain
+}
+
+var metaRefreshURLRegex = regexp.MustCompile(`(?is)^\s*[\d.]*\s*[;,]?\s*(?:url\s*=\s*)?(.*)$`)
+
+// Return the target of a <meta http-equiv="refresh"> redirect, resolved
+// against the page URL. Refreshes without a URL reload the page itself and
+// are ignored.
+func parseMetaRefresh(body string, base *url.URL) string {
+	for _, tag := range metaTagRegex.FindAllString(body, -1) {
+		attributes := tagAttributes(tag)
+		if !strings.EqualFold(strings.TrimSpace(attributes["http-equiv"]), "refresh") {
+			continue
+		}
+		match := metaRefreshURLRegex.FindStringSubmatch(attributes["content"])
+		if match == nil {
+			continue
+		}
+		target := strings.Trim(strings.TrimSpace(match[1]), `"'`)
+		if target == "" {
+			continue
+		}
+		ref, err := url.Parse(target)
+		if err != nil {
+			continue
+		}
+		return base.ResolveReference(ref).String()
+	}
+	return ""
+}
+
+// Follow up to maxHops meta refresh redirects from a fetched page, so the
+// result describes the final page and the refreshes appear in its redirect
+// chain. Loops end the chain at the first repeated URL.
+func followMetaRefresh(result Result, client *http.Client, startTime time.Time, opts *fetchOptions, maxHops int) Result {
+	originalURL := result.URL
+	seen := map[string]bool{originalURL: true}
+
+	for hop := 0; hop < maxHops && result.MetaRefresh != ""; hop++ {
+		target := result.MetaRefresh
+		if seen[target] {
+			break
+		}
+		seen[target] = true
+
+		current := result.URL
+		if result.FinalURL != "" {
+			current = result.FinalURL
+		}
+		chain := append(result.Redirects, Redirect{URL: current, Status: result.Status, Type: redirectMetaRefresh})
+
+		domain := ""
+		if parsed, err := url.Parse(target); err == nil {
+			domain = parsed.Host
+		}
+		if opts.limiter != nil {
+			opts.limiter.wait()
+		}
+		next := fetchURL(target, client, startTime, domain, nil, opts)
+		if next.FinalURL == "" {
+			next.FinalURL = target
+		}
+		next.URL = originalURL
+		next.Domain = result.Domain
+		next.Redirects = append(chain, next.Redirects...)
+		result = next
+	}
+	return result
+}
+
+// Report whether an http:// URL ended up on HTTPS. Returns nil for HTTPS
+// inputs and for URLs that could not be fetched.
+func httpsRedirect(urlStr string, result Result) *bool {
+	if !strings.HasPrefix(strings.ToLower(urlStr), "http://") || result.Status == 0 {
+		return nil
+	}
+	upgraded := strings.HasPrefix(strings.ToLower(result.FinalURL), "https://")
+	return &upgraded
+}
+
+// HTTPSUpgradeStats tracks how many plain HTTP inputs redirect to HTTPS
+type HTTPSUpgradeStats struct {
+	HTTPURLs  int      `json:"http_urls"`
+	Upgraded  int      `json:"upgraded"`
+	Plaintext []string `json:"plaintext"` // URLs still served without TLS
+}
+
+// Summarize HTTPS upgrades, or return nil when no http:// URLs were fetched
+func summarizeHTTPSUpgrades(results []Result) *HTTPSUpgradeStats {
+	stats := &HTTPSUpgradeStats{Plaintext: []string{}}
+	for _, result := range results {
+		if result.HTTPSRedirect == nil {
+			continue
+		}
+		stats.HTTPURLs++
+		if *result.HTTPSRedirect {
+			stats.Upgraded++
+		} else {
+			stats.Plaintext = append(stats.Plaintext, result.URL)
+		}
+	}
+	if stats.HTTPURLs == 0 {
+		return nil
+	}
+	sort.Strings(stats.Plaintext)
+	return stats
+}
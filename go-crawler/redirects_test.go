@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func FuzzParseMetaRefresh(f *testing.F) {
+	f.Add(`<meta http-equiv="refresh" content="0; url=/next">`)
+	f.Add(`<META HTTP-EQUIV='Refresh' CONTENT="5;URL='https://example.com/'">`)
+	f.Add(`<meta http-equiv="refresh" content="10">`)
+	f.Add(`<meta content="0;url=page.html" http-equiv="refresh">`)
+	base, _ := url.Parse("https://example.com/dir/index.html")
+	f.Fuzz(func(t *testing.T, body string) {
+		target := parseMetaRefresh(body, base)
+		if target == "" {
+			return
+		}
+		if _, err := url.Parse(target); err != nil {
+			t.Errorf("meta refresh target %q does not parse: %v", target, err)
+		}
+	})
+}
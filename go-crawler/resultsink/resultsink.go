@@ -0,0 +1,109 @@
+// Package resultsink lets other packages add -sink backends to the crawler,
+// the way database/sql takes drivers. A backend registers its URL schemes
+// from an init function, and the crawler is built with a blank import of its
+// package:
+//
+//	import _ "example.com/crawler/redissink"
+package resultsink
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Sink stores crawl results as the crawl produces them. Each result is a JSON
+// object with the fields of a result in the results file.
+type Sink interface {
+	// Write stores a result, or queues it to be stored. It is called by
+	// every worker at once.
+	Write(result json.RawMessage) error
+	// Flush stores what Write has queued, returning the first failure
+	Flush() error
+	// Close flushes and releases the sink, returning the first failure
+	Close() error
+}
+
+// Summarizer is a Sink that also stores the run's summary. It is called once
+// after the last result, before Close, with a JSON object holding the
+// summary, throughput and run fields of the results file.
+type Summarizer interface {
+	Summarize(summary json.RawMessage)
+}
+
+// Reporter is a Sink that says what it did at the end of the crawl, e.g.
+// "240 results stored in redis://localhost/crawl"
+type Reporter interface {
+	Report() string
+}
+
+// Config is what a sink is opened with
+type Config struct {
+	RunID     string        // ID of the run, e.g. to key documents by
+	BatchSize int           // results per request (-sink-batch-size)
+	Backoff   time.Duration // wait before the first retry, doubled for each next one (-sink-backoff)
+	Retries   int           // attempts at a request before giving up (-sink-retries)
+	// Stops the crawl. A sink that fails for good calls it, as later results
+	// would be lost too.
+	Stop func()
+}
+
+// Backend is a kind of sink, named by the schemes of its -sink URLs
+type Backend struct {
+	Schemes []string
+	Check   func(rawURL string) error // check a URL before the crawl starts; nil accepts any
+	Open    func(rawURL string, config Config) (Sink, error)
+}
+
+var (
+	mu       sync.RWMutex
+	backends []Backend
+)
+
+// Register adds a backend. It panics when the backend has no schemes or no
+// Open function, or when another backend has one of its schemes. The
+// crawler's built-in backends take precedence over registered ones.
+func Register(backend Backend) {
+	if len(backend.Schemes) == 0 || backend.Open == nil {
+		panic("resultsink: Register needs schemes and an Open function")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, scheme := range backend.Schemes {
+		if _, ok := lookup(scheme); ok {
+			panic(fmt.Sprintf("resultsink: a backend for %s:// is already registered", scheme))
+		}
+	}
+	backends = append(backends, backend)
+}
+
+// Lookup finds the registered backend for a URL scheme
+func Lookup(scheme string) (Backend, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return lookup(scheme)
+}
+
+func lookup(scheme string) (Backend, bool) {
+	for _, backend := range backends {
+		for _, name := range backend.Schemes {
+			if name == scheme {
+				return backend, true
+			}
+		}
+	}
+	return Backend{}, false
+}
+
+// Schemes lists the schemes of the registered backends, in the order they
+// were registered
+func Schemes() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	var schemes []string
+	for _, backend := range backends {
+		schemes = append(schemes, backend.Schemes...)
+	}
+	return schemes
+}
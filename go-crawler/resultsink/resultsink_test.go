@@ -0,0 +1,72 @@
+package resultsink
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type nopSink struct{}
+
+func (nopSink) Write(json.RawMessage) error { return nil }
+func (nopSink) Flush() error                { return nil }
+func (nopSink) Close() error                { return nil }
+
+func openNop(string, Config) (Sink, error) { return nopSink{}, nil }
+
+// Start a test with no backends registered, restoring them after it
+func resetBackends(t *testing.T) {
+	saved := backends
+	backends = nil
+	t.Cleanup(func() { backends = saved })
+}
+
+// Call register and return what it panicked with, nil when it didn't
+func registerPanic(backend Backend) (recovered interface{}) {
+	defer func() { recovered = recover() }()
+	Register(backend)
+	return nil
+}
+
+func TestRegisterAndLookup(t *testing.T) {
+	resetBackends(t)
+	Register(Backend{Schemes: []string{"redis", "rediss"}, Open: openNop})
+	Register(Backend{Schemes: []string{"kafka"}, Open: openNop})
+
+	for _, scheme := range []string{"redis", "rediss", "kafka"} {
+		if backend, ok := Lookup(scheme); !ok || backend.Open == nil {
+			t.Errorf("%s:// not found", scheme)
+		}
+	}
+	if _, ok := Lookup("nosuch"); ok {
+		t.Errorf("found a backend for an unknown scheme")
+	}
+	if schemes := strings.Join(Schemes(), " "); schemes != "redis rediss kafka" {
+		t.Errorf("schemes %q, want them in the order registered", schemes)
+	}
+}
+
+// A scheme taken by another backend, or a backend without schemes or an
+// Open function, is a programming error
+func TestRegisterRefuses(t *testing.T) {
+	resetBackends(t)
+	Register(Backend{Schemes: []string{"redis"}, Open: openNop})
+
+	for _, tc := range []struct {
+		name    string
+		backend Backend
+		panic   string
+	}{
+		{"duplicate scheme", Backend{Schemes: []string{"rediss", "redis"}, Open: openNop}, "a backend for redis:// is already registered"},
+		{"no schemes", Backend{Open: openNop}, "Register needs schemes and an Open function"},
+		{"no Open", Backend{Schemes: []string{"kafka"}}, "Register needs schemes and an Open function"},
+	} {
+		recovered := registerPanic(tc.backend)
+		if message, _ := recovered.(string); !strings.Contains(message, tc.panic) {
+			t.Errorf("%s: panicked with %v, want %q", tc.name, recovered, tc.panic)
+		}
+	}
+	if schemes := strings.Join(Schemes(), " "); schemes != "redis" {
+		t.Errorf("schemes %q after refused backends, want redis alone", schemes)
+	}
+}
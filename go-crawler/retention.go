@@ -0,0 +1,226 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// retention is how much of a store to keep: at most the latest runs runs,
+// none older than days days. Zero sets no limit.
+type retention struct {
+	runs int
+	days int
+}
+
+// Report whether the policy sets any limit
+func (r retention) set() bool {
+	return r.runs > 0 || r.days > 0
+}
+
+// The oldest time a run may have to be kept, in UTC in the layout the
+// store keeps its times in
+func (r retention) cutoff(now time.Time, layout string) string {
+	return now.AddDate(0, 0, -r.days).UTC().Format(layout)
+}
+
+// Report whether a run falls outside the policy, given how many newer runs
+// there are and when it ran
+func (r retention) expired(newer int, at time.Time, now time.Time) bool {
+	return (r.runs > 0 && newer >= r.runs) || (r.days > 0 && at.Before(now.AddDate(0, 0, -r.days)))
+}
+
+// SQL condition selecting the rows outside the policy, for a table whose
+// rows are ordered by key and timed by the column at, which holds UTC times
+// in layout. When only is set, the policy applies to the rows it selects
+// alone, e.g. to finished jobs.
+func (r retention) where(table, key, at, layout, only string, now time.Time) string {
+	latest := fmt.Sprintf("SELECT %s FROM %s ORDER BY %s DESC LIMIT %d", key, table, key, r.runs)
+	if only != "" {
+		latest = fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s DESC LIMIT %d", key, table, only, key, r.runs)
+	}
+	var conditions []string
+	if r.runs > 0 {
+		conditions = append(conditions, fmt.Sprintf("%s NOT IN (%s)", key, latest))
+	}
+	if r.days > 0 {
+		conditions = append(conditions, fmt.Sprintf("%s < %s", at, sqlQuote(r.cutoff(now, layout))))
+	}
+	where := "(" + strings.Join(conditions, " OR ") + ")"
+	if only != "" {
+		where = only + " AND " + where
+	}
+	return where
+}
+
+// Delete the runs outside the policy, and their URL statuses, returning how
+// many runs were deleted. SQLite reuses the space freed, so the file stops
+// growing rather than shrinking.
+func (h *historyDB) prune(policy retention, now time.Time) (int, error) {
+	where := policy.where("runs", "id", "started_at", time.RFC3339, "", now)
+	var rows []struct {
+		Runs int `json:"runs"`
+	}
+	if err := h.query("SELECT count(*) AS runs FROM runs WHERE "+where, &rows); err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 || rows[0].Runs == 0 {
+		return 0, nil
+	}
+	script := fmt.Sprintf("BEGIN IMMEDIATE;\nDELETE FROM url_status WHERE run_id IN (SELECT id FROM runs WHERE %s);\nDELETE FROM runs WHERE %s;\nCOMMIT;\n", where, where)
+	return rows[0].Runs, h.exec(func(w io.Writer) error {
+		_, err := io.WriteString(w, script)
+		return err
+	})
+}
+
+// The SQL condition selecting finished jobs
+var jobFinishedSQL = fmt.Sprintf("state IN (%s, %s, %s)", sqlQuote(jobCompleted), sqlQuote(jobFailed), sqlQuote(jobCancelled))
+
+// Delete the finished jobs outside the policy, returning their rows with
+// only the name and directory set. Queued and running jobs are always kept,
+// and don't count towards the runs kept.
+func (s *jobStore) prune(policy retention, now time.Time) ([]jobRow, error) {
+	var rows []jobRow
+	if err := s.query("SELECT name, dir FROM jobs WHERE "+policy.where("jobs", "seq", "finished_at", storedTimeLayout, jobFinishedSQL, now)+" ORDER BY seq", &rows); err != nil {
+		return nil, err
+	}
+	names := make([]string, len(rows))
+	for i, row := range rows {
+		names[i] = row.Name
+	}
+	return rows, s.delete(names)
+}
+
+// Delete jobs by name
+func (s *jobStore) delete(names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = sqlQuote(name)
+	}
+	return s.exec(fmt.Sprintf("DELETE FROM jobs WHERE name IN (%s);\n", strings.Join(quoted, ", ")))
+}
+
+// Drop the finished jobs outside the server's retention policy: from the
+// list, the store and the job directory. Called with s.mu held.
+func (s *jobServer) prune() {
+	if !s.retention.set() {
+		return
+	}
+	now := time.Now()
+	var pruned []string
+	newer := 0
+	for i := len(s.order) - 1; i >= 0; i-- {
+		job := s.jobs[s.order[i]]
+		if job == nil || !jobFinished(job.State) || job.FinishedAt == nil {
+			continue
+		}
+		if s.retention.expired(newer, *job.FinishedAt, now) {
+			pruned = append(pruned, job.Name)
+		}
+		newer++
+	}
+	if len(pruned) == 0 {
+		return
+	}
+	if s.store != nil {
+		if err := s.store.delete(pruned); err != nil {
+			fmt.Printf("Warning: pruning jobs from the store: %s\n", err)
+			return
+		}
+	}
+	for _, name := range pruned {
+		os.RemoveAll(s.jobs[name].dir)
+		delete(s.jobs, name)
+	}
+	kept := s.order[:0]
+	for _, name := range s.order {
+		if _, ok := s.jobs[name]; ok {
+			kept = append(kept, name)
+		}
+	}
+	s.order = kept
+}
+
+// Prune every interval, for jobs that age out while none finishes
+func (s *jobServer) pruneEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		s.mu.Lock()
+		s.prune()
+		s.mu.Unlock()
+	}
+}
+
+// Run the prune subcommand and return the process exit code
+func runPrune(args []string) int {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	historyPath := fs.String("history", "", "SQLite history file written by crawl -history")
+	storeTarget := fs.String("store", "", "Job store of the server: a SQLite file or a postgres:// database")
+	keepRuns := fs.Int("keep-runs", 0, "Keep only this many of the latest runs, or finished jobs (0 for no limit)")
+	keepDays := fs.Int("keep-days", 0, "Delete runs, or finished jobs, older than this many days (0 for no limit)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: crawler prune (-history history.db | -store jobs.db) [-keep-runs N] [-keep-days N]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	policy := retention{runs: *keepRuns, days: *keepDays}
+	if fs.NArg() > 0 || (*historyPath == "") == (*storeTarget == "") || *keepRuns < 0 || *keepDays < 0 {
+		fs.Usage()
+		return exitConfig
+	}
+	if !policy.set() {
+		fmt.Printf("Error: prune needs -keep-runs or -keep-days\n")
+		return exitConfig
+	}
+
+	if *historyPath != "" {
+		if _, err := os.Stat(*historyPath); err != nil {
+			fmt.Printf("Error opening history: %s\n", err)
+			return exitError
+		}
+		h, err := openHistory(*historyPath)
+		if err != nil {
+			fmt.Printf("Error opening history: %s\n", err)
+			return exitError
+		}
+		pruned, err := h.prune(policy, time.Now())
+		if err != nil {
+			fmt.Printf("Error pruning history: %s\n", err)
+			return exitError
+		}
+		fmt.Printf("%d runs pruned from %s\n", pruned, *historyPath)
+		return exitOK
+	}
+
+	if !strings.Contains(*storeTarget, "://") {
+		if _, err := os.Stat(*storeTarget); err != nil {
+			fmt.Printf("Error opening job store: %s\n", err)
+			return exitError
+		}
+	}
+	store, err := openJobStore(*storeTarget)
+	if err != nil {
+		fmt.Printf("Error opening job store: %s\n", err)
+		return exitError
+	}
+	pruned, err := store.prune(policy, time.Now())
+	if err != nil {
+		fmt.Printf("Error pruning job store: %s\n", err)
+		return exitError
+	}
+	// A running server still lists them until it restarts
+	for _, job := range pruned {
+		if err := os.RemoveAll(job.Dir); err != nil {
+			fmt.Printf("Warning: removing the directory of job %s: %s\n", job.Name, err)
+		}
+	}
+	fmt.Printf("%d finished jobs pruned from the store\n", len(pruned))
+	return exitOK
+}
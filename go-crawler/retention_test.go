@@ -0,0 +1,187 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The stores drive the sqlite3 command-line tool, which not every machine has
+func needSQLite(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 is not on the PATH")
+	}
+}
+
+func TestRetentionExpired(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		policy  retention
+		newer   int
+		at      time.Time
+		expired bool
+	}{
+		{retention{}, 1000, now.AddDate(-1, 0, 0), false},
+		{retention{runs: 3}, 2, now, false},
+		{retention{runs: 3}, 3, now, true},
+		{retention{days: 30}, 0, now.AddDate(0, 0, -30).Add(time.Second), false},
+		{retention{days: 30}, 0, now.AddDate(0, 0, -30).Add(-time.Second), true},
+		{retention{runs: 3, days: 30}, 0, now.AddDate(0, 0, -31), true},
+		{retention{runs: 3, days: 30}, 5, now, true},
+	} {
+		if expired := tc.policy.expired(tc.newer, tc.at, now); expired != tc.expired {
+			t.Errorf("%+v, %d newer, at %s: got %v, want %v", tc.policy, tc.newer, tc.at, expired, tc.expired)
+		}
+	}
+}
+
+// Pruning deletes the runs outside the policy along with their URL statuses
+func TestHistoryPrune(t *testing.T) {
+	needSQLite(t)
+	h, err := openHistory(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	for _, days := range []int{40, 20, 10, 5, 1} {
+		results := []Result{{URL: "https://a.example/", Status: 200, Domain: "a.example"}}
+		if err := h.appendRun(now.AddDate(0, 0, -days), Summary{TotalURLs: 1, SuccessfulFetches: 1}, results); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kept := func() (runs, statuses int) {
+		var rows []struct {
+			Runs     int `json:"runs"`
+			Statuses int `json:"statuses"`
+		}
+		if err := h.query("SELECT (SELECT count(*) FROM runs) AS runs, (SELECT count(*) FROM url_status) AS statuses", &rows); err != nil {
+			t.Fatal(err)
+		}
+		return rows[0].Runs, rows[0].Statuses
+	}
+
+	for _, tc := range []struct {
+		policy       retention
+		pruned, runs int
+	}{
+		{retention{days: 30}, 1, 4},
+		{retention{runs: 3}, 1, 3},
+		{retention{runs: 3, days: 7}, 1, 2},
+		{retention{runs: 3, days: 7}, 0, 2},
+	} {
+		pruned, err := h.prune(tc.policy, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runs, statuses := kept()
+		if pruned != tc.pruned || runs != tc.runs || statuses != tc.runs {
+			t.Errorf("%+v: pruned %d, kept %d runs and %d statuses; want %d pruned, %d kept", tc.policy, pruned, runs, statuses, tc.pruned, tc.runs)
+		}
+	}
+}
+
+// Only finished jobs are pruned, by when they finished, whatever the time
+// zone of the server that saved them
+func TestJobStorePrune(t *testing.T) {
+	needSQLite(t)
+	store, err := openJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	cutoff := now.AddDate(0, 0, -30)
+	east, west := time.FixedZone("east", 10*3600), time.FixedZone("west", -10*3600)
+	for i, tc := range []struct {
+		name     string
+		state    string
+		finished time.Time
+	}{
+		{"old-running", jobRunning, time.Time{}},
+		{"old-east", jobCompleted, cutoff.Add(-time.Hour).In(east)},
+		{"new-west", jobFailed, cutoff.Add(time.Hour).In(west)},
+		{"new", jobCancelled, now},
+		{"newest", jobCompleted, now.Add(time.Minute)},
+	} {
+		job := &serverJob{Job: Job{Name: tc.name, State: tc.state, SubmittedAt: cutoff.AddDate(0, 0, -1)}, seq: i + 1, dir: filepath.Join(t.TempDir(), tc.name)}
+		if !tc.finished.IsZero() {
+			job.FinishedAt = &tc.finished
+		}
+		if err := store.save(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := func(rows []jobRow) string {
+		var names []string
+		for _, row := range rows {
+			names = append(names, row.Name)
+		}
+		return strings.Join(names, " ")
+	}
+
+	pruned, err := store.prune(retention{days: 30}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(pruned); got != "old-east" {
+		t.Errorf("pruned %q by age, want old-east", got)
+	}
+	if len(pruned) == 1 && filepath.Base(pruned[0].Dir) != "old-east" {
+		t.Errorf("pruned job's directory %q", pruned[0].Dir)
+	}
+	if pruned, err = store.prune(retention{runs: 1}, now); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(pruned); got != "new-west new" {
+		t.Errorf("pruned %q by count, want new-west new", got)
+	}
+	jobs, err := store.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, job := range jobs {
+		left = append(left, job.Name)
+	}
+	if strings.Join(left, " ") != "old-running newest" {
+		t.Errorf("left %q, want old-running newest", left)
+	}
+}
+
+// prune -store removes the pruned jobs' directories with their rows
+func TestPruneStoreRemovesJobDirectories(t *testing.T) {
+	needSQLite(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "jobs.db")
+	store, err := openJobStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finished := time.Now()
+	for i, name := range []string{"old", "new"} {
+		job := &serverJob{Job: Job{Name: name, State: jobCompleted, SubmittedAt: finished, FinishedAt: &finished}, seq: i + 1, dir: filepath.Join(dir, name)}
+		if err := os.MkdirAll(job.dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(job.dir, "results.json"), []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.save(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out, code := runCrawler(t, "prune", "-store", path, "-keep-runs", "1")
+	if code != exitOK || !strings.Contains(out, "1 finished jobs pruned") {
+		t.Fatalf("got exit code %d, want %d, with output:\n%s", code, exitOK, out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old")); !os.IsNotExist(err) {
+		t.Errorf("the pruned job's directory is still there: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new", "results.json")); err != nil {
+		t.Errorf("the kept job's directory: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+// Load the results of a previous run and list the URLs whose fetch failed,
+// in file order. Method, metadata and tags recorded on a result are carried over
+// to its retry; request headers and bodies are not stored in results.
+func loadRetryList(filePath string) ([]Result, []string, map[string]*urlEntry, error) {
+	combined, err := loadResults(filePath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var urls []string
+	entries := make(map[string]*urlEntry)
+	for _, result := range combined.Results {
+		if result.SkipReason != "" || resultSucceeded(result) {
+			continue
+		}
+		urls = append(urls, result.URL)
+		if result.Metadata != nil || result.Tags != nil || result.Method != "" {
+			entries[result.URL] = &urlEntry{URL: result.URL, Metadata: result.Metadata, Tags: result.Tags, Method: result.Method}
+		}
+	}
+	return combined.Results, urls, entries, nil
+}
+
+// Replace the previous results of retried URLs with their new outcomes,
+// keeping the previous order. New results for URLs that were not in the
+// file, such as pages found by a recursive retry, are appended.
+func mergeRetried(previous, retried []Result) []Result {
+	latest := make(map[string]Result, len(retried))
+	for _, result := range retried {
+		latest[result.URL] = result
+	}
+
+	merged := make([]Result, 0, len(previous)+len(retried))
+	for _, result := range previous {
+		if next, ok := latest[result.URL]; ok {
+			result = next
+			delete(latest, result.URL)
+		}
+		merged = append(merged, result)
+	}
+	for _, result := range retried {
+		if _, ok := latest[result.URL]; ok {
+			merged = append(merged, result)
+		}
+	}
+	return merged
+}
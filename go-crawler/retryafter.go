@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// retryAfter requeues URLs answered 429 or 503 with a Retry-After header
+// and pauses their host until the delay has passed
+type retryAfter struct {
+	mu          sync.Mutex
+	maxAttempts int           // requeues per URL before the response counts
+	maxDelay    time.Duration // longer delays count as failures right away
+	attempts    map[string]int
+	pausedUntil map[string]time.Time
+	requeued    int
+	pauses      int
+}
+
+func newRetryAfter(maxAttempts int, maxDelay time.Duration) *retryAfter {
+	return &retryAfter{
+		maxAttempts: maxAttempts,
+		maxDelay:    maxDelay,
+		attempts:    make(map[string]int),
+		pausedUntil: make(map[string]time.Time),
+	}
+}
+
+// Parse a Retry-After value, either delay seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if delay := at.Sub(now); delay > 0 {
+		return delay, true
+	}
+	return 0, true
+}
+
+// How much longer than now a host is paused, 0 or less when it isn't
+func (r *retryAfter) paused(host string, now time.Time) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pausedUntil[host].Sub(now)
+}
+
+// Decide whether a result should be fetched again later. When it should,
+// its host is paused for the Retry-After delay and the delay is returned;
+// otherwise the result is final and 0 is returned.
+func (r *retryAfter) requeue(result Result, now time.Time) time.Duration {
+	if result.RetryAfter == "" || (result.Status != http.StatusTooManyRequests && result.Status != http.StatusServiceUnavailable) {
+		return 0
+	}
+	delay, ok := parseRetryAfter(result.RetryAfter, now)
+	if !ok || delay > r.maxDelay {
+		return 0
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.attempts[result.URL] >= r.maxAttempts {
+		return 0
+	}
+	r.attempts[result.URL]++
+	r.requeued++
+	if until := now.Add(delay); until.After(r.pausedUntil[result.Domain]) {
+		if !r.pausedUntil[result.Domain].After(now) {
+			r.pauses++
+		}
+		r.pausedUntil[result.Domain] = until
+	}
+	// A zero delay still goes to the back of the queue
+	return max(delay, time.Millisecond)
+}
+
+// Number of times a URL was requeued
+func (r *retryAfter) requeues(url string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.attempts[url]
+}
+
+// RetryAfterStats counts URLs requeued and hosts paused because of
+// Retry-After
+type RetryAfterStats struct {
+	Requeued    int `json:"requeued"`
+	HostsPaused int `json:"hosts_paused"`
+}
+
+// Stats returns the requeue counters
+func (r *retryAfter) Stats() RetryAfterStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return RetryAfterStats{Requeued: r.requeued, HostsPaused: r.pauses}
+}
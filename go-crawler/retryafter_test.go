@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		value string
+		delay time.Duration
+		ok    bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{" 5 ", 5 * time.Second, true},
+		{"0", 0, true},
+		{"-1", 0, false},
+		{"1.5", 0, false},
+		{"", 0, false},
+		{"soon", 0, false},
+		{"Wed, 01 May 2024 12:00:30 GMT", 30 * time.Second, true},
+		{"Wednesday, 01-May-24 12:01:00 GMT", time.Minute, true},
+		{"Wed May  1 12:00:10 2024", 10 * time.Second, true},
+		{"Wed, 01 May 2024 11:59:00 GMT", 0, true},
+		{"Wed, 01 May 2024 25:00:00 GMT", 0, false},
+	} {
+		delay, ok := parseRetryAfter(tc.value, now)
+		if delay != tc.delay || ok != tc.ok {
+			t.Errorf("%q: got %v, %v; want %v, %v", tc.value, delay, ok, tc.delay, tc.ok)
+		}
+	}
+}
+
+// A requeued URL pauses its host for the delay, and only 429 and 503 with a
+// usable delay are requeued, up to maxAttempts times
+func TestRetryAfterRequeue(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	throttled := func(url, host, retryAfter string) Result {
+		return Result{URL: url, Domain: host, Status: http.StatusTooManyRequests, RetryAfter: retryAfter}
+	}
+	for _, tc := range []struct {
+		name   string
+		result Result
+		delay  time.Duration
+	}{
+		{"429", throttled("https://a.example/", "a.example", "10"), 10 * time.Second},
+		{"503", Result{URL: "https://a.example/", Domain: "a.example", Status: http.StatusServiceUnavailable, RetryAfter: "3"}, 3 * time.Second},
+		{"zero delay", throttled("https://a.example/", "a.example", "0"), time.Millisecond},
+		{"past date", throttled("https://a.example/", "a.example", "Wed, 01 May 2024 11:00:00 GMT"), time.Millisecond},
+		{"other status", Result{URL: "https://a.example/", Domain: "a.example", Status: http.StatusBadGateway, RetryAfter: "10"}, 0},
+		{"no header", throttled("https://a.example/", "a.example", ""), 0},
+		{"negative", throttled("https://a.example/", "a.example", "-5"), 0},
+		{"over the maximum", throttled("https://a.example/", "a.example", "3600"), 0},
+	} {
+		r := newRetryAfter(3, time.Minute)
+		if delay := r.requeue(tc.result, now); delay != tc.delay {
+			t.Errorf("%s: requeued after %v, want %v", tc.name, delay, tc.delay)
+		}
+	}
+
+	r := newRetryAfter(2, time.Minute)
+	first := throttled("https://a.example/1", "a.example", "10")
+	for attempt := 1; attempt <= 3; attempt++ {
+		want := 10 * time.Second
+		if attempt == 3 {
+			want = 0
+		}
+		if delay := r.requeue(first, now); delay != want {
+			t.Errorf("attempt %d: requeued after %v, want %v", attempt, delay, want)
+		}
+	}
+	if n := r.requeues(first.URL); n != 2 {
+		t.Errorf("got %d requeues, want 2", n)
+	}
+}
+
+func TestRetryAfterPausesHost(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	r := newRetryAfter(5, time.Minute)
+	result := func(url, retryAfter string) Result {
+		return Result{URL: url, Domain: "a.example", Status: http.StatusTooManyRequests, RetryAfter: retryAfter}
+	}
+
+	r.requeue(result("https://a.example/1", "30"), now)
+	if delay := r.paused("a.example", now.Add(10*time.Second)); delay != 20*time.Second {
+		t.Errorf("paused for %v after 10s, want 20s", delay)
+	}
+	if delay := r.paused("b.example", now); delay > 0 {
+		t.Errorf("other host paused for %v", delay)
+	}
+
+	// A shorter delay doesn't cut the pause short, a longer one extends it
+	r.requeue(result("https://a.example/2", "5"), now.Add(time.Second))
+	if delay := r.paused("a.example", now); delay != 30*time.Second {
+		t.Errorf("paused for %v after a shorter delay, want 30s", delay)
+	}
+	r.requeue(result("https://a.example/3", "40"), now.Add(time.Second))
+	if delay := r.paused("a.example", now); delay != 41*time.Second {
+		t.Errorf("paused for %v after a longer delay, want 41s", delay)
+	}
+	if delay := r.paused("a.example", now.Add(time.Minute)); delay > 0 {
+		t.Errorf("still paused for %v once the delay passed", delay)
+	}
+
+	// A pause that started after the last one ended counts as another
+	r.requeue(result("https://a.example/4", "5"), now.Add(time.Minute))
+	if stats := r.Stats(); stats.Requeued != 4 || stats.HostsPaused != 2 {
+		t.Errorf("got %+v, want 4 requeued and 2 pauses", stats)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Config file key holding URL rewrite rules, which is not a flag
+const rewritesConfigKey = "rewrites"
+
+// rewriteRule changes URLs on matching hosts before they are fetched. The
+// changes of a rule are made in field order.
+type rewriteRule struct {
+	Host       string `json:"host"`        // hosts the rule applies to: a name, "*.example.com", or "*" or empty for all
+	SetHost    string `json:"set_host"`    // host, with an optional port, to fetch from instead
+	StripPort  bool   `json:"strip_port"`  // drop an explicit port
+	ForceHTTPS bool   `json:"force_https"` // fetch http URLs over https
+	Match      string `json:"match"`       // regular expression over the whole URL
+	Replace    string `json:"replace"`     // replacement for Match, with $1 style references
+
+	match *regexp.Regexp
+}
+
+// Parse the rewrites section of a config file: a list of rules applied in
+// order
+func parseRewriteRules(value interface{}) ([]rewriteRule, error) {
+	if value == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var rules []rewriteRule
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("config key %q: %w", rewritesConfigKey, err)
+	}
+	for i := range rules {
+		rule := &rules[i]
+		if strings.Contains(strings.TrimPrefix(rule.Host, "*."), "*") && rule.Host != "*" {
+			return nil, fmt.Errorf("config key %q: rule %d: host %s: only a leading \"*.\" or \"*\" alone is supported", rewritesConfigKey, i+1, rule.Host)
+		}
+		if rule.Replace != "" && rule.Match == "" {
+			return nil, fmt.Errorf("config key %q: rule %d: replace needs match", rewritesConfigKey, i+1)
+		}
+		if rule.Match != "" {
+			if rule.match, err = regexp.Compile(rule.Match); err != nil {
+				return nil, fmt.Errorf("config key %q: rule %d: %w", rewritesConfigKey, i+1, err)
+			}
+		}
+		if rule.SetHost == "" && !rule.StripPort && !rule.ForceHTTPS && rule.match == nil {
+			return nil, fmt.Errorf("config key %q: rule %d changes nothing", rewritesConfigKey, i+1)
+		}
+	}
+	return rules, nil
+}
+
+// Report whether a host name matches a rule's host pattern
+func (rule *rewriteRule) appliesTo(host string) bool {
+	switch {
+	case rule.Host == "" || rule.Host == "*":
+		return true
+	case strings.HasPrefix(rule.Host, "*."):
+		return strings.HasSuffix(host, rule.Host[1:])
+	}
+	return strings.EqualFold(host, rule.Host)
+}
+
+// Rewrite a URL with one rule
+func (rule *rewriteRule) apply(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || !rule.appliesTo(strings.ToLower(parsedURL.Hostname())) {
+		return rawURL
+	}
+	if rule.SetHost != "" {
+		parsedURL.Host = rule.SetHost
+	}
+	if rule.StripPort {
+		parsedURL.Host = parsedURL.Hostname()
+	}
+	if rule.ForceHTTPS && parsedURL.Scheme == "http" {
+		parsedURL.Scheme = "https"
+		if parsedURL.Port() == "80" {
+			parsedURL.Host = parsedURL.Hostname()
+		}
+	}
+	rewritten := parsedURL.String()
+	if rule.match != nil {
+		rewritten = rule.match.ReplaceAllString(rewritten, rule.Replace)
+	}
+	return rewritten
+}
+
+// urlRewriter applies the rewrite rules and remembers the URL each rewritten
+// URL came from
+type urlRewriter struct {
+	rules []rewriteRule
+
+	mu        sync.Mutex
+	originals map[string]string
+}
+
+func newURLRewriter(rules []rewriteRule) *urlRewriter {
+	return &urlRewriter{rules: rules, originals: make(map[string]string)}
+}
+
+// Rewrite a URL with every rule in turn. When URLs merge, the first one
+// rewritten is kept as the original.
+func (r *urlRewriter) rewrite(rawURL string) string {
+	rewritten := rawURL
+	for i := range r.rules {
+		rewritten = r.rules[i].apply(rewritten)
+	}
+	if rewritten != rawURL {
+		r.mu.Lock()
+		if _, ok := r.originals[rewritten]; !ok {
+			r.originals[rewritten] = rawURL
+		}
+		r.mu.Unlock()
+	}
+	return rewritten
+}
+
+// The URL a rewritten URL came from, empty when it wasn't rewritten
+func (r *urlRewriter) original(rawURL string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.originals[rawURL]
+}
+
+// Rewrite a URL list, dropping URLs that become duplicates. Input data moves
+// to the rewritten URL.
+func (r *urlRewriter) rewriteList(urls []string, entries map[string]*urlEntry) []string {
+	rewritten := make([]string, 0, len(urls))
+	seen := make(map[string]bool, len(urls))
+	for _, rawURL := range urls {
+		target := r.rewrite(rawURL)
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+		rewritten = append(rewritten, target)
+		if entry, ok := entries[rawURL]; ok && target != rawURL {
+			delete(entries, rawURL)
+			entries[target] = entry
+		}
+	}
+	return rewritten
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"container/list"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Product token matched against robots.txt User-agent lines, and sent at
+// the start of the User-Agent header
+const robotsAgent = "go-crawler"
+
+// The User-Agent header sent with every request, e.g. "go-crawler/1.4.0"
+func userAgent() string {
+	return robotsAgent + "/" + version
+}
+
+// The product token of a User-agent line, in lower case: the value up to
+// the first character other than a letter, "_" or "-" (RFC 9309 2.2.1), so
+// "Go-Crawler/2.0" gives "go-crawler". A lone * is kept as the wildcard.
+func robotsProductToken(value string) string {
+	if value == "*" {
+		return value
+	}
+	end := strings.IndexFunc(value, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_' || r == '-')
+	})
+	if end >= 0 {
+		value = value[:end]
+	}
+	return strings.ToLower(value)
+}
+
+// Upper bound on the robots.txt bytes parsed per host
+const maxRobotsSize = 512 * 1024
+
+// robotsRule is a single Allow or Disallow line
+type robotsRule struct {
+	pattern string
+	allow   bool
+	regex   *regexp.Regexp // set for patterns using * or $
+}
+
+// Report whether the rule's pattern matches the path
+func (r robotsRule) matches(path string) bool {
+	if r.regex != nil {
+		return r.regex.MatchString(path)
+	}
+	return strings.HasPrefix(path, r.pattern)
+}
+
+// robotsPolicy holds the rules that apply to this crawler for one host
+type robotsPolicy struct {
+	rules      []robotsRule
+	disallowed bool // the whole host is off limits
+}
+
+// Allowed applies the longest matching rule; Allow wins ties
+func (p *robotsPolicy) Allowed(path string) bool {
+	if p.disallowed {
+		return false
+	}
+
+	allowed, longest := true, -1
+	for _, rule := range p.rules {
+		if len(rule.pattern) < longest || !rule.matches(path) {
+			continue
+		}
+		if len(rule.pattern) > longest || rule.allow {
+			allowed, longest = rule.allow, len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// Parse robots.txt content, keeping the group for our agent or the * group
+func parseRobots(r io.Reader) *robotsPolicy {
+	var agentRules, wildcardRules []robotsRule
+	var matchedAgent, matchedWildcard bool
+
+	// Track the user agents of the group currently being read
+	var groupAgents []string
+	inRules := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "user-agent":
+			if inRules {
+				groupAgents = nil
+				inRules = false
+			}
+			groupAgents = append(groupAgents, robotsProductToken(value))
+		case "allow", "disallow":
+			inRules = true
+			for _, agent := range groupAgents {
+				// An empty Disallow allows everything, but still makes the
+				// group the one that applies
+				if agent == "*" {
+					matchedWildcard = true
+					if value != "" {
+						wildcardRules = append(wildcardRules, newRobotsRule(value, field == "allow"))
+					}
+				} else if agent == robotsAgent {
+					matchedAgent = true
+					if value != "" {
+						agentRules = append(agentRules, newRobotsRule(value, field == "allow"))
+					}
+				}
+			}
+		}
+	}
+
+	if matchedAgent {
+		return &robotsPolicy{rules: agentRules}
+	}
+	if matchedWildcard {
+		return &robotsPolicy{rules: wildcardRules}
+	}
+	return &robotsPolicy{}
+}
+
+func newRobotsRule(pattern string, allow bool) robotsRule {
+	rule := robotsRule{pattern: pattern, allow: allow}
+	if strings.ContainsAny(pattern, "*$") {
+		expr := regexp.QuoteMeta(strings.TrimSuffix(pattern, "$"))
+		expr = "^" + strings.ReplaceAll(expr, `\*`, ".*")
+		if strings.HasSuffix(pattern, "$") {
+			expr += "$"
+		}
+		rule.regex = regexp.MustCompile(expr)
+	}
+	return rule
+}
+
+// RobotsStats reports how effective the robots.txt cache was
+type RobotsStats struct {
+	Lookups   int `json:"lookups"`
+	Hits      int `json:"hits"`
+	Misses    int `json:"misses"`
+	Expired   int `json:"expired"`
+	Evictions int `json:"evictions"`
+	Blocked   int `json:"blocked"`
+}
+
+// robotsEntry is a cached policy; ready is closed once it has been fetched
+type robotsEntry struct {
+	origin  string // scheme://host[:port], the scope of a robots.txt
+	policy  *robotsPolicy
+	expires time.Time
+	ready   chan struct{}
+}
+
+// robotsCache is an LRU of robots policies with a TTL, one per scheme, host
+// and port as RFC 9309 scopes them. Concurrent lookups for the same origin
+// share a single robots.txt fetch.
+type robotsCache struct {
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List // front is most recently used
+	capacity int
+	ttl      time.Duration
+	client   *http.Client
+	stats    RobotsStats
+}
+
+func newRobotsCache(capacity int, ttl time.Duration, client *http.Client) *robotsCache {
+	return &robotsCache{
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		capacity: capacity,
+		ttl:      ttl,
+		client:   client,
+	}
+}
+
+// Allowed reports whether robots.txt permits fetching the URL
+func (c *robotsCache) Allowed(rawURL string) bool {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || parsedURL.Host == "" {
+		// Let the fetch report malformed URLs
+		return true
+	}
+
+	entry := c.lookup(parsedURL.Scheme + "://" + parsedURL.Host)
+	<-entry.ready
+
+	path := parsedURL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if parsedURL.RawQuery != "" {
+		path += "?" + parsedURL.RawQuery
+	}
+
+	allowed := entry.policy.Allowed(path)
+	if !allowed {
+		c.mu.Lock()
+		c.stats.Blocked++
+		c.mu.Unlock()
+	}
+	return allowed
+}
+
+// Return the cache entry for an origin, starting a fetch on a miss
+func (c *robotsCache) lookup(origin string) *robotsEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Lookups++
+
+	if elem, ok := c.entries[origin]; ok {
+		entry := elem.Value.(*robotsEntry)
+		select {
+		case <-entry.ready:
+			if time.Now().Before(entry.expires) {
+				c.stats.Hits++
+				c.order.MoveToFront(elem)
+				return entry
+			}
+			c.stats.Expired++
+			c.order.Remove(elem)
+			delete(c.entries, origin)
+		default:
+			// Another worker is fetching it
+			c.stats.Hits++
+			return entry
+		}
+	}
+
+	c.stats.Misses++
+	entry := &robotsEntry{origin: origin, ready: make(chan struct{})}
+	c.entries[origin] = c.order.PushFront(entry)
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*robotsEntry).origin)
+		c.stats.Evictions++
+	}
+
+	go c.fetch(entry)
+	return entry
+}
+
+// Fetch and parse robots.txt following RFC 9309: a 4xx means no
+// restrictions, while a server error or unreachable host disallows the host
+func (c *robotsCache) fetch(entry *robotsEntry) {
+	defer close(entry.ready)
+	entry.expires = time.Now().Add(c.ttl)
+
+	resp, err := c.client.Get(entry.origin + "/robots.txt")
+	if err != nil {
+		entry.policy = &robotsPolicy{disallowed: true}
+		return
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		entry.policy = parseRobots(io.LimitReader(resp.Body, maxRobotsSize))
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		entry.policy = &robotsPolicy{}
+	default:
+		entry.policy = &robotsPolicy{disallowed: true}
+	}
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *robotsCache) Stats() RobotsStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The group whose product token is ours applies, matched whole and without
+// regard to case; the * group applies only when none is
+func TestRobotsAgentGroups(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		robots  string
+		allowed map[string]bool
+	}{
+		{
+			name:    "exact token",
+			robots:  "User-agent: go-crawler\nDisallow: /private\n",
+			allowed: map[string]bool{"/private/x": false, "/public": true},
+		},
+		{
+			name:    "case and version ignored",
+			robots:  "User-agent: Go-Crawler/2.0\nDisallow: /private\n",
+			allowed: map[string]bool{"/private/x": false},
+		},
+		{
+			name:    "partial token",
+			robots:  "User-agent: go\nDisallow: /\n\nUser-agent: crawler\nDisallow: /\n",
+			allowed: map[string]bool{"/": true, "/page": true},
+		},
+		{
+			name:    "longer token",
+			robots:  "User-agent: go-crawler-extra\nDisallow: /\n",
+			allowed: map[string]bool{"/page": true},
+		},
+		{
+			name:    "empty agent",
+			robots:  "User-agent:\nDisallow: /\n",
+			allowed: map[string]bool{"/page": true},
+		},
+		{
+			name:    "wildcard fallback",
+			robots:  "User-agent: otherbot\nDisallow: /\n\nUser-agent: *\nDisallow: /tmp\n",
+			allowed: map[string]bool{"/page": true, "/tmp/x": false},
+		},
+		{
+			name:    "our group over the wildcard",
+			robots:  "User-agent: *\nDisallow: /\n\nUser-agent: GO-CRAWLER\nDisallow: /private\n",
+			allowed: map[string]bool{"/page": true, "/private": false},
+		},
+		{
+			name:    "groups combined",
+			robots:  "User-agent: go-crawler\nDisallow: /a\n\nUser-agent: otherbot\nUser-agent: go-crawler\nDisallow: /b\n",
+			allowed: map[string]bool{"/a": false, "/b": false, "/c": true},
+		},
+		{
+			name:    "empty disallow",
+			robots:  "User-agent: *\nDisallow: /\n\nUser-agent: go-crawler\nDisallow:\n",
+			allowed: map[string]bool{"/page": true},
+		},
+	} {
+		policy := parseRobots(strings.NewReader(tc.robots))
+		for path, want := range tc.allowed {
+			if got := policy.Allowed(path); got != want {
+				t.Errorf("%s: %s allowed %v, want %v", tc.name, path, got, want)
+			}
+		}
+	}
+}
+
+// Within a group the longest matching pattern wins, and Allow wins a tie
+func TestRobotsRulePrecedence(t *testing.T) {
+	for _, tc := range []struct {
+		rules   string
+		path    string
+		allowed bool
+	}{
+		{"Disallow: /a\nAllow: /a/b\n", "/a/b/c", true},
+		{"Disallow: /a\nAllow: /a/b\n", "/a/c", false},
+		{"Allow: /a\nDisallow: /a/b\n", "/a/b", false},
+		{"Allow: /page\nDisallow: /page\n", "/page", true},
+		{"Disallow: /page\nAllow: /page\n", "/page", true},
+		{"Disallow: /*.pdf$\n", "/doc.pdf", false},
+		{"Disallow: /*.pdf$\n", "/doc.pdf?page=2", true},
+		{"Disallow: /\nAllow: /$\n", "/", true},
+		{"Disallow: /\nAllow: /$\n", "/page", false},
+		{"Disallow: /*/edit\nAllow: /wiki/\n", "/wiki/edit", false},
+		{"Disallow: /wiki/*\nAllow: /wiki/\n", "/wiki/page", false},
+	} {
+		policy := parseRobots(strings.NewReader("User-agent: go-crawler\n" + tc.rules))
+		if got := policy.Allowed(tc.path); got != tc.allowed {
+			t.Errorf("%q: %s allowed %v, want %v", tc.rules, tc.path, got, tc.allowed)
+		}
+	}
+}
+
+// robots.txt and page requests carry the agent robots.txt is matched for
+func TestUserAgentSent(t *testing.T) {
+	var mu sync.Mutex
+	agents := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		agents[r.URL.Path] = r.Header.Get("User-Agent")
+		mu.Unlock()
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprint(w, "User-agent: go-crawler\nDisallow: /private\n")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<title>Page</title>")
+	}))
+	defer server.Close()
+
+	client := newHTTPClient(timeoutConfig{total: 10 * time.Second})
+	opts := &fetchOptions{robots: newRobotsCache(10, time.Hour, client), bodyDigest: digestCRC64}
+	results, _, err := crawlURLs(context.Background(), []string{server.URL + "/page", server.URL + "/private"}, 1, client, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if blocked := result.SkipReason != ""; blocked != strings.HasSuffix(result.URL, "/private") {
+			t.Errorf("%s: skip reason %q", result.URL, result.SkipReason)
+		}
+	}
+	want := "go-crawler/" + version
+	for _, path := range []string{"/robots.txt", "/page"} {
+		if agents[path] != want {
+			t.Errorf("%s requested with User-Agent %q, want %q", path, agents[path], want)
+		}
+	}
+}
+
+// robotsTransport answers robots.txt requests with a file per scheme
+type robotsTransport map[string]string
+
+func (t robotsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(t[req.URL.Scheme])),
+		Request:    req,
+	}, nil
+}
+
+// http:// and https:// URLs of one host follow their own robots.txt, as
+// RFC 9309 scopes it by scheme, host and port
+func TestRobotsCachePerScheme(t *testing.T) {
+	client := &http.Client{Transport: robotsTransport{
+		"http":  "User-agent: *\nDisallow: /\n",
+		"https": "User-agent: *\nDisallow: /private\n",
+	}}
+	cache := newRobotsCache(10, time.Hour, client)
+	for _, tc := range []struct {
+		url     string
+		allowed bool
+	}{
+		{"http://a.example/page", false},
+		{"https://a.example/page", true},
+		{"https://a.example/private", false},
+		{"http://a.example:8080/page", false},
+	} {
+		if allowed := cache.Allowed(tc.url); allowed != tc.allowed {
+			t.Errorf("%s: allowed %v, want %v", tc.url, allowed, tc.allowed)
+		}
+	}
+	if cache.stats.Misses != 3 {
+		t.Errorf("%d robots.txt fetched, want 3", cache.stats.Misses)
+	}
+}
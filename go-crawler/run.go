@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// Set at build time with -ldflags "-X main.version=... -X main.commit=...";
+// make setup does this
+var (
+	version = "dev"
+	commit  = ""
+)
+
+// RunMetadata records the conditions a crawl ran under, so results can be
+// traced back to them
+type RunMetadata struct {
+	ID        string            `json:"run_id"`
+	Version   string            `json:"crawler_version"`
+	Commit    string            `json:"git_commit,omitempty"`
+	GoVersion string            `json:"go_version"`
+	Hostname  string            `json:"hostname,omitempty"`
+	Flags     map[string]string `json:"flags"` // every flag's effective value, config file included
+	StartedAt time.Time         `json:"started_at"`
+	EndedAt   time.Time         `json:"ended_at"`
+}
+
+// Describe the current run
+func newRunMetadata(flags *flag.FlagSet, id string, started, ended time.Time) *RunMetadata {
+	run := &RunMetadata{
+		ID:        id,
+		Version:   version,
+		Commit:    buildCommit(),
+		GoVersion: runtime.Version(),
+		Flags:     make(map[string]string),
+		StartedAt: started,
+		EndedAt:   ended,
+	}
+	run.Hostname, _ = os.Hostname()
+	flags.VisitAll(func(f *flag.Flag) {
+		run.Flags[f.Name] = f.Value.String()
+	})
+	return run
+}
+
+// The commit set at build time, or else the one Go stamped into the binary
+// when there is one
+func buildCommit() string {
+	if commit != "" {
+		return commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return ""
+}
+
+// BuildInfo identifies the running crawler, for the server's /buildinfo
+type BuildInfo struct {
+	Version   string    `json:"crawler_version"`
+	Commit    string    `json:"git_commit,omitempty"`
+	GoVersion string    `json:"go_version"`
+	RunID     string    `json:"run_id,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+func newBuildInfo(runID string, started time.Time) BuildInfo {
+	return BuildInfo{
+		Version:   version,
+		Commit:    buildCommit(),
+		GoVersion: runtime.Version(),
+		RunID:     runID,
+		StartedAt: started,
+	}
+}
+
+// Generate a random (version 4) UUID identifying a run
+func newRunID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// Fall back to the clock, which is unique enough on one machine
+		return fmt.Sprintf("run-%d", time.Now().UnixNano())
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Format a fetch start time for Result.StartedAt: RFC 3339 in UTC with
+// milliseconds, which sorts as text
+func formatStartedAt(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z07:00")
+}
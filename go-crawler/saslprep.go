@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Compatibility forms of the Latin-1 characters NFKC changes, the non-ASCII
+// space U+00A0 aside
+var saslprepLatin1 = map[rune]string{
+	'¨': " ̈", 'ª': "a", '¯': " ̄", '²': "2",
+	'³': "3", '´': " ́", 'µ': "μ", '¸': " ̧",
+	'¹': "1", 'º': "o", '¼': "1⁄4", '½': "1⁄2",
+	'¾': "3⁄4",
+}
+
+// Prepare a password with SASLprep (RFC 4013), as SCRAM-SHA-256 requires:
+// characters commonly mapped to nothing are dropped, non-ASCII spaces
+// become spaces, and the result is normalized with NFKC. The standard
+// library has no Unicode normalization tables, so past Latin-1 only the
+// characters NFKC leaves alone are known; a password with other characters
+// is refused rather than sent in a form the server would reject.
+func saslPrep(password string) (string, error) {
+	var prepared strings.Builder
+	for _, r := range password {
+		switch {
+		case r == utf8.RuneError:
+			return "", fmt.Errorf("the password isn't valid UTF-8")
+		case saslprepMappedToNothing(r):
+			continue
+		case saslprepSpace(r):
+			prepared.WriteByte(' ')
+			continue
+		case saslprepProhibited(r):
+			return "", fmt.Errorf("the password has the character %U, which SASLprep prohibits", r)
+		case r >= 0xa0 && r <= 0xff:
+			if compat, ok := saslprepLatin1[r]; ok {
+				prepared.WriteString(compat)
+				continue
+			}
+		case r > 0x7f:
+			return "", fmt.Errorf("the password has the character %U; the crawler can only prepare Latin-1 passwords for SCRAM-SHA-256, so use SCRAM-SHA-1 or another password", r)
+		}
+		prepared.WriteRune(r)
+	}
+	return prepared.String(), nil
+}
+
+// Table B.1 of RFC 3454
+func saslprepMappedToNothing(r rune) bool {
+	switch r {
+	case 0x00ad, 0x034f, 0x1806, 0x180b, 0x180c, 0x180d, 0x200b, 0x200c, 0x200d, 0x2060, 0xfeff:
+		return true
+	}
+	return r >= 0xfe00 && r <= 0xfe0f
+}
+
+// Table C.1.2 of RFC 3454
+func saslprepSpace(r rune) bool {
+	switch r {
+	case 0x00a0, 0x1680, 0x202f, 0x205f, 0x3000:
+		return true
+	}
+	return r >= 0x2000 && r <= 0x200b
+}
+
+// Tables C.2 to C.9 of RFC 3454: controls, private use, non-characters,
+// surrogates, and characters that are inappropriate in text or change
+// display direction
+func saslprepProhibited(r rune) bool {
+	switch {
+	case r < 0x20 || r >= 0x7f && r <= 0x9f:
+		return true
+	case r == 0x0340 || r == 0x0341 || r == 0x06dd || r == 0x070f || r == 0x180e:
+		return true
+	case r >= 0x200e && r <= 0x200f, r >= 0x2028 && r <= 0x202e, r >= 0x2060 && r <= 0x2063, r >= 0x206a && r <= 0x206f:
+		return true
+	case r >= 0x2ff0 && r <= 0x2ffb, r >= 0xd800 && r <= 0xf8ff, r >= 0xfdd0 && r <= 0xfdef, r >= 0xfff9 && r <= 0xfffd:
+		return true
+	case r >= 0x1d173 && r <= 0x1d17a, r == 0xe0001, r >= 0xe0020 && r <= 0xe007f, r >= 0xf0000:
+		return true
+	}
+	// Non-characters at the end of each plane
+	return r&0xfffe == 0xfffe
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Invalid input lines kept for the summary in scale mode
+const scaleInvalidSamples = 100
+
+// Flags that need the whole URL list in memory
+var scaleIncompatibleFlags = []string{"sitemap", "discover-sitemaps", "offset", "limit", "sample", "sample-n", "shuffle", "since", "depth", "frontier-dir", "pre-resolve"}
+
+// Reject flags that can't work when the input is streamed
+func checkScaleFlags(flags *flag.FlagSet, inputs []string) error {
+	var err error
+	flags.Visit(func(f *flag.Flag) {
+		for _, name := range scaleIncompatibleFlags {
+			if f.Name == name && err == nil {
+				err = fmt.Errorf("-scale cannot be combined with -%s, which needs the whole URL list in memory", name)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, input := range inputs {
+		if ext := strings.ToLower(filepath.Ext(input)); ext == ".csv" || ext == ".jsonl" || ext == ".ndjson" {
+			return fmt.Errorf("-scale reads plain text URL lists only, not %s", input)
+		}
+	}
+	return checkStreamFlags(flags)
+}
+
+// scaleInput streams URLs from plain text lists, dropping duplicates with an
+// on-disk visited set so memory use doesn't grow with the list
+type scaleInput struct {
+	files    []string
+	visited  *diskSet
+	dir      string
+	rewriter *urlRewriter // rewrites URLs before deduplication when set
+
+	loaded       int
+	invalidCount int
+	invalid      []InvalidURL // the first scaleInvalidSamples malformed lines
+}
+
+// Prepare to stream files, keeping the visited set in a new directory under
+// parent (the system temp directory when empty)
+func newScaleInput(files []string, parent string) (*scaleInput, error) {
+	dir, err := os.MkdirTemp(parent, "crawler-scale-")
+	if err != nil {
+		return nil, err
+	}
+	visited, err := openDiskSet(filepath.Join(dir, "input-visited"))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &scaleInput{files: files, visited: visited, dir: dir}, nil
+}
+
+// Read the files line by line and submit each new valid URL, stopping when
+// submit returns false
+func (in *scaleInput) feed(opts *fetchOptions, submit func(string) bool) error {
+	for _, filePath := range in.files {
+		stopped, err := in.feedFile(filePath, opts, submit)
+		if err != nil || stopped {
+			return err
+		}
+	}
+	return nil
+}
+
+func (in *scaleInput) feedFile(filePath string, opts *fetchOptions, submit func(string) bool) (bool, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		// Tags need per-URL input data, which isn't kept at this scale
+		urlStr, _ := splitTaggedLine(scanner.Text())
+		if urlStr == "" {
+			continue
+		}
+		if err := validateURL(urlStr); err != nil {
+			in.invalidCount++
+			if len(in.invalid) < scaleInvalidSamples {
+				in.invalid = append(in.invalid, InvalidURL{File: filePath, Line: lineNumber, URL: urlStr, Error: err.Error()})
+			}
+			continue
+		}
+		urlStr = stripQueryParams(urlStr)
+		if in.rewriter != nil {
+			urlStr = in.rewriter.rewrite(urlStr)
+		}
+		added, err := in.visited.Add(urlStr)
+		if err != nil {
+			return false, err
+		}
+		if !added {
+			continue
+		}
+
+		in.loaded++
+		opts.enqueue(1)
+		if !submit(urlStr) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// Remove the visited set
+func (in *scaleInput) Close() error {
+	in.visited.Close()
+	return os.RemoveAll(in.dir)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rule outcomes in SEO audits
+const (
+	seoPass = "pass"
+	seoWarn = "warn"
+	seoFail = "fail"
+)
+
+// Recommended length ranges in characters
+const (
+	seoTitleMin       = 30
+	seoTitleMax       = 60
+	seoDescriptionMin = 70
+	seoDescriptionMax = 160
+)
+
+var (
+	metaTagRegex = regexp.MustCompile(`(?is)<meta\b[^>]*>`)
+	linkTagRegex = regexp.MustCompile(`(?is)<link\b[^>]*>`)
+	h1TagRegex   = regexp.MustCompile(`(?is)<h1\b`)
+	attrRegex    = regexp.MustCompile(`(?is)([a-z][a-z0-9_:-]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// Return the attributes of an HTML tag keyed by lowercase name
+func tagAttributes(tag string) map[string]string {
+	attributes := make(map[string]string)
+	for _, match := range attrRegex.FindAllStringSubmatch(tag, -1) {
+		name := strings.ToLower(match[1])
+		if _, ok := attributes[name]; !ok {
+			attributes[name] = html.UnescapeString(match[2] + match[3] + match[4])
+		}
+	}
+	return attributes
+}
+
+// SEORule is the outcome of a single SEO rule
+type SEORule struct {
+	Name    string `json:"name"`
+	Outcome string `json:"outcome"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// SEOAudit holds the measured values and rule outcomes for a page
+type SEOAudit struct {
+	TitleLength           int       `json:"title_length"`
+	MetaDescriptionLength int       `json:"meta_description_length"`
+	H1Count               int       `json:"h1_count"`
+	Canonical             string    `json:"canonical,omitempty"`
+	Noindex               bool      `json:"noindex"`
+	Rules                 []SEORule `json:"rules"`
+}
+
+// Audit an HTML page for common on-page SEO problems
+func auditSEO(body, title string, resp *http.Response) *SEOAudit {
+	audit := &SEOAudit{}
+
+	// Title
+	titleRule := SEORule{Name: "title", Outcome: seoPass}
+	if title == "" || title == "No title found" {
+		titleRule.Outcome, titleRule.Detail = seoFail, "missing"
+	} else {
+		audit.TitleLength = utf8.RuneCountInString(title)
+		if audit.TitleLength < seoTitleMin || audit.TitleLength > seoTitleMax {
+			titleRule.Outcome = seoWarn
+			titleRule.Detail = fmt.Sprintf("%d characters, recommended %d-%d", audit.TitleLength, seoTitleMin, seoTitleMax)
+		}
+	}
+
+	// Meta description and robots directives
+	description, hasDescription := "", false
+	for _, tag := range metaTagRegex.FindAllString(body, -1) {
+		attributes := tagAttributes(tag)
+		switch strings.ToLower(attributes["name"]) {
+		case "description":
+			if !hasDescription {
+				description, hasDescription = strings.TrimSpace(attributes["content"]), true
+			}
+		case "robots":
+			if hasNoindex(attributes["content"]) {
+				audit.Noindex = true
+			}
+		}
+	}
+	for _, value := range resp.Header.Values("X-Robots-Tag") {
+		if hasNoindex(value) {
+			audit.Noindex = true
+		}
+	}
+
+	descriptionRule := SEORule{Name: "meta_description", Outcome: seoPass}
+	if !hasDescription || description == "" {
+		descriptionRule.Outcome, descriptionRule.Detail = seoFail, "missing"
+	} else {
+		audit.MetaDescriptionLength = utf8.RuneCountInString(description)
+		if audit.MetaDescriptionLength < seoDescriptionMin || audit.MetaDescriptionLength > seoDescriptionMax {
+			descriptionRule.Outcome = seoWarn
+			descriptionRule.Detail = fmt.Sprintf("%d characters, recommended %d-%d", audit.MetaDescriptionLength, seoDescriptionMin, seoDescriptionMax)
+		}
+	}
+
+	// Exactly one H1
+	audit.H1Count = len(h1TagRegex.FindAllString(body, -1))
+	h1Rule := SEORule{Name: "h1", Outcome: seoPass}
+	if audit.H1Count == 0 {
+		h1Rule.Outcome, h1Rule.Detail = seoFail, "missing"
+	} else if audit.H1Count > 1 {
+		h1Rule.Outcome, h1Rule.Detail = seoWarn, fmt.Sprintf("%d h1 elements", audit.H1Count)
+	}
+
+	canonicalRule := auditCanonical(body, resp, audit)
+
+	noindexRule := SEORule{Name: "noindex", Outcome: seoPass}
+	if audit.Noindex {
+		noindexRule.Outcome, noindexRule.Detail = seoWarn, "page is excluded from indexing"
+	}
+
+	audit.Rules = []SEORule{titleRule, descriptionRule, h1Rule, canonicalRule, noindexRule}
+	return audit
+}
+
+// Check that a page declares a single, valid canonical URL and note when it
+// points elsewhere
+func auditCanonical(body string, resp *http.Response, audit *SEOAudit) SEORule {
+	rule := SEORule{Name: "canonical", Outcome: seoPass}
+
+	var canonicals []string
+	for _, tag := range linkTagRegex.FindAllString(body, -1) {
+		attributes := tagAttributes(tag)
+		if hasRel(attributes["rel"], "canonical") {
+			canonicals = append(canonicals, strings.TrimSpace(attributes["href"]))
+		}
+	}
+
+	switch {
+	case len(canonicals) == 0:
+		rule.Outcome, rule.Detail = seoWarn, "missing"
+		return rule
+	case len(canonicals) > 1:
+		rule.Outcome, rule.Detail = seoFail, fmt.Sprintf("%d canonical links", len(canonicals))
+		return rule
+	}
+
+	ref, err := url.Parse(canonicals[0])
+	if err != nil || canonicals[0] == "" {
+		rule.Outcome, rule.Detail = seoFail, fmt.Sprintf("invalid canonical URL %q", canonicals[0])
+		return rule
+	}
+
+	pageURL := resp.Request.URL
+	canonical, err := normalizeURL(pageURL.ResolveReference(ref).String())
+	if err != nil {
+		rule.Outcome, rule.Detail = seoFail, fmt.Sprintf("invalid canonical URL %q", canonicals[0])
+		return rule
+	}
+	audit.Canonical = canonical
+
+	if self, err := normalizeURL(pageURL.String()); err == nil && self != canonical {
+		rule.Outcome, rule.Detail = seoWarn, "canonicalizes to another URL"
+	}
+	return rule
+}
+
+// Report whether a robots directive list contains noindex (or none)
+func hasNoindex(directives string) bool {
+	for _, directive := range strings.Split(directives, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		// X-Robots-Tag may prefix directives with a user agent
+		if i := strings.LastIndex(directive, ":"); i >= 0 {
+			directive = strings.TrimSpace(directive[i+1:])
+		}
+		if directive == "noindex" || directive == "none" {
+			return true
+		}
+	}
+	return false
+}
+
+// SEOAuditSummary counts rule outcomes across a crawl
+type SEOAuditSummary struct {
+	PagesAudited int                       `json:"pages_audited"`
+	Rules        map[string]map[string]int `json:"rules"`
+}
+
+// Summarize the SEO audits of all results
+func summarizeSEOAudits(results []Result) *SEOAuditSummary {
+	summary := &SEOAuditSummary{Rules: make(map[string]map[string]int)}
+	for _, result := range results {
+		if result.SEO == nil {
+			continue
+		}
+		summary.PagesAudited++
+		for _, rule := range result.SEO.Rules {
+			if summary.Rules[rule.Name] == nil {
+				summary.Rules[rule.Name] = map[string]int{seoPass: 0, seoWarn: 0, seoFail: 0}
+			}
+			summary.Rules[rule.Name][rule.Outcome]++
+		}
+	}
+	return summary
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Words per shingle used as simhash features
+const simhashShingleSize = 3
+
+var (
+	scriptStyleRegex = regexp.MustCompile(`(?is)<(script|style)[^>]*>.*?</(script|style)>`)
+	tagRegex         = regexp.MustCompile(`(?s)<[^>]*>`)
+	wordRegex        = regexp.MustCompile(`[\p{L}\p{N}]+`)
+)
+
+// Compute a 64-bit simhash over word shingles of the page's visible text.
+// Pages with similar text get fingerprints a small Hamming distance apart.
+func computeSimhash(body string) uint64 {
+	text := tagRegex.ReplaceAllString(scriptStyleRegex.ReplaceAllString(body, " "), " ")
+	words := wordRegex.FindAllString(strings.ToLower(text), -1)
+	if len(words) == 0 {
+		return 0
+	}
+
+	var weights [64]int
+	addFeature := func(feature string) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<uint(bit)) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	if len(words) < simhashShingleSize {
+		addFeature(strings.Join(words, " "))
+	}
+	for i := 0; i+simhashShingleSize <= len(words); i++ {
+		addFeature(strings.Join(words[i:i+simhashShingleSize], " "))
+	}
+
+	var fingerprint uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			fingerprint |= 1 << uint(bit)
+		}
+	}
+	return fingerprint
+}
+
+func formatSimhash(fingerprint uint64) string {
+	return fmt.Sprintf("%016x", fingerprint)
+}
+
+// DuplicateCluster is a group of near-duplicate pages
+type DuplicateCluster struct {
+	ID   int      `json:"id"`
+	Size int      `json:"size"`
+	URLs []string `json:"urls"`
+}
+
+// NearDuplicateStats summarizes near-duplicate clustering
+type NearDuplicateStats struct {
+	MaxDistance    int                `json:"max_distance"`
+	PagesCompared  int                `json:"pages_compared"`
+	Clusters       int                `json:"clusters"`
+	DuplicatePages int                `json:"duplicate_pages"`
+	LargestCluster int                `json:"largest_cluster"`
+	ClusterSizes   []DuplicateCluster `json:"cluster_sizes"`
+}
+
+// Group pages whose simhashes are within maxDistance bits of each other and
+// label each result with its cluster. Candidate pairs are found by splitting
+// fingerprints into maxDistance+1 bands: any pair within the distance must
+// match exactly on at least one band.
+func clusterNearDuplicates(results []Result, maxDistance int) NearDuplicateStats {
+	stats := NearDuplicateStats{MaxDistance: maxDistance, ClusterSizes: []DuplicateCluster{}}
+
+	var pages []int
+	fingerprints := make(map[int]uint64)
+	for i, result := range results {
+		if result.SimHash == "" {
+			continue
+		}
+		fingerprint, err := strconv.ParseUint(result.SimHash, 16, 64)
+		if err != nil {
+			continue
+		}
+		pages = append(pages, i)
+		fingerprints[i] = fingerprint
+	}
+	stats.PagesCompared = len(pages)
+
+	// Union-find over result indices
+	parent := make(map[int]int, len(pages))
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for _, i := range pages {
+		parent[i] = i
+	}
+
+	bands := maxDistance + 1
+	if bands > 64 {
+		bands = 64
+	}
+	bandWidth := 64 / bands
+	for band := 0; band < bands; band++ {
+		shift := uint(band * bandWidth)
+		mask := uint64(1)<<uint(bandWidth) - 1
+		if bandWidth == 64 {
+			mask = ^uint64(0)
+		}
+
+		buckets := make(map[uint64][]int)
+		for _, i := range pages {
+			key := (fingerprints[i] >> shift) & mask
+			buckets[key] = append(buckets[key], i)
+		}
+		for _, bucket := range buckets {
+			for a := 0; a < len(bucket); a++ {
+				for b := a + 1; b < len(bucket); b++ {
+					i, j := bucket[a], bucket[b]
+					if find(i) != find(j) && bits.OnesCount64(fingerprints[i]^fingerprints[j]) <= maxDistance {
+						parent[find(i)] = find(j)
+					}
+				}
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+	for _, i := range pages {
+		root := find(i)
+		groups[root] = append(groups[root], i)
+	}
+
+	var clusters [][]int
+	for _, members := range groups {
+		if len(members) > 1 {
+			sort.Ints(members)
+			clusters = append(clusters, members)
+		}
+	}
+	// Largest clusters first, ties in input order
+	sort.Slice(clusters, func(a, b int) bool {
+		if len(clusters[a]) != len(clusters[b]) {
+			return len(clusters[a]) > len(clusters[b])
+		}
+		return clusters[a][0] < clusters[b][0]
+	})
+
+	for n, members := range clusters {
+		cluster := DuplicateCluster{ID: n + 1, Size: len(members)}
+		for _, i := range members {
+			results[i].DuplicateCluster = cluster.ID
+			cluster.URLs = append(cluster.URLs, results[i].URL)
+		}
+		stats.ClusterSizes = append(stats.ClusterSizes, cluster)
+		stats.DuplicatePages += len(members)
+		if len(members) > stats.LargestCluster {
+			stats.LargestCluster = len(members)
+		}
+	}
+	stats.Clusters = len(clusters)
+
+	return stats
+}
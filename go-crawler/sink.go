@@ -0,0 +1,378 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/msaberp/web-crawler-comparison/go-crawler/resultsink"
+)
+
+// Batched sinks send what is queued at least this often, so results show up
+// while the crawl runs
+const sinkFlushEvery = time.Second
+
+// ResultSink stores results as the crawl produces them. The results file is
+// one, written as results complete with -stream or once the crawl is over
+// without it; every -sink backend, a queue, search index or database, is
+// another. A new built-in backend implements it and adds its URL schemes to
+// sinkBackends; a backend outside the crawler registers with the resultsink
+// package instead.
+type ResultSink interface {
+	// Write stores a result, or queues it to be stored. The -sink backends
+	// are written to by every worker at once.
+	Write(result Result) error
+	// Flush stores what Write has queued, returning the first failure
+	Flush() error
+	// Close flushes and releases the sink, returning the first failure
+	Close() error
+}
+
+// notifyingSink is a sink that tells when each result is stored, which a
+// -source waits for before acknowledging the result's message. Other sinks
+// have stored a result once Write returns without an error.
+type notifyingSink interface {
+	// Call stored with each result once it is stored, never with one the
+	// sink fails to store
+	notifyStored(stored func(Result))
+}
+
+// summarySink is a sink that also stores the run's summary, once its results
+// are stored
+type summarySink interface {
+	summarize(summary Summary, throughput []ThroughputSample, run *RunMetadata)
+}
+
+// reportingSink is a sink that says what it did at the end of the crawl,
+// e.g. "240 results published to queue results"
+type reportingSink interface {
+	report() string
+}
+
+// sinkOptions tune the sinks that send results in batches
+type sinkOptions struct {
+	batchSize int           // results per request
+	backoff   time.Duration // wait before the first retry, doubled for each next one
+	retries   int           // attempts at a request before giving up
+}
+
+// sinkConfig is what a -sink backend is opened with
+type sinkConfig struct {
+	runID   string
+	options sinkOptions
+	// Stops the crawl. A sink that fails calls it, as later results would be
+	// lost too.
+	stop func()
+}
+
+// sinkBackend is a kind of -sink, named by its URL schemes
+type sinkBackend struct {
+	schemes []string
+	check   func(rawURL string) error // check a URL before connecting
+	open    func(rawURL string, config sinkConfig) (ResultSink, error)
+}
+
+// The -sink backends. A backend in a file of its own can add itself from an
+// init function.
+var sinkBackends = []sinkBackend{
+	{[]string{"amqp", "amqps"}, func(rawURL string) error { return checkQueueURL("sink", rawURL) }, openAMQPSink},
+	{[]string{"es", "ess"}, func(rawURL string) error { _, err := parseElasticsearchURL(rawURL); return err }, openElasticsearchSink},
+	{[]string{"clickhouse", "clickhouses"}, func(rawURL string) error { _, err := parseClickHouseURL(rawURL); return err }, openClickHouseSink},
+	{[]string{"postgres", "postgresql"}, func(rawURL string) error { _, err := parsePostgresURL(rawURL); return err }, openPostgresSink},
+	{[]string{"mongodb", "mongodb+srv"}, func(rawURL string) error { _, err := parseMongoURL(rawURL); return err }, openMongoSink},
+}
+
+// The backend of a -sink URL: a built-in one, or else one registered with
+// the resultsink package. Nil when no backend takes its scheme.
+func findSinkBackend(rawURL string) *sinkBackend {
+	scheme, _, _ := strings.Cut(rawURL, "://")
+	for i, backend := range sinkBackends {
+		for _, name := range backend.schemes {
+			if name == scheme {
+				return &sinkBackends[i]
+			}
+		}
+	}
+	registered, ok := resultsink.Lookup(scheme)
+	if !ok {
+		return nil
+	}
+	check := registered.Check
+	if check == nil {
+		check = func(string) error { return nil }
+	}
+	return &sinkBackend{registered.Schemes, check, func(rawURL string, config sinkConfig) (ResultSink, error) {
+		sink, err := registered.Open(rawURL, resultsink.Config{
+			RunID:     config.runID,
+			BatchSize: config.options.batchSize,
+			Backoff:   config.options.backoff,
+			Retries:   config.options.retries,
+			Stop:      config.stop,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return registeredSink{sink}, nil
+	}}
+}
+
+// Check a -sink URL before connecting
+func checkSinkURL(rawURL string) error {
+	if backend := findSinkBackend(rawURL); backend != nil {
+		return backend.check(rawURL)
+	}
+	var schemes []string
+	for _, backend := range sinkBackends {
+		for _, name := range backend.schemes {
+			schemes = append(schemes, name+"://")
+		}
+	}
+	for _, name := range resultsink.Schemes() {
+		schemes = append(schemes, name+"://")
+	}
+	return fmt.Errorf("-sink takes a URL starting with one of %s, e.g. es://localhost:9200/crawl", strings.Join(schemes, ", "))
+}
+
+// registeredSink is a sink registered with the resultsink package, which
+// takes results as JSON
+type registeredSink struct {
+	sink resultsink.Sink
+}
+
+func (s registeredSink) Write(result Result) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return s.sink.Write(data)
+}
+
+func (s registeredSink) Flush() error {
+	return s.sink.Flush()
+}
+
+func (s registeredSink) Close() error {
+	return s.sink.Close()
+}
+
+func (s registeredSink) summarize(summary Summary, throughput []ThroughputSample, run *RunMetadata) {
+	summarizer, ok := s.sink.(resultsink.Summarizer)
+	if !ok {
+		return
+	}
+	data, err := json.Marshal(struct {
+		Summary    Summary            `json:"summary"`
+		Throughput []ThroughputSample `json:"throughput,omitempty"`
+		Run        *RunMetadata       `json:"run,omitempty"`
+	}{summary, throughput, run})
+	if err == nil {
+		summarizer.Summarize(data)
+	}
+}
+
+func (s registeredSink) report() string {
+	if reporter, ok := s.sink.(resultsink.Reporter); ok {
+		return reporter.Report()
+	}
+	return ""
+}
+
+// Connect to the sink a -sink URL names
+func openSink(rawURL string, config sinkConfig) (ResultSink, error) {
+	backend := findSinkBackend(rawURL)
+	if backend == nil {
+		return nil, checkSinkURL(rawURL)
+	}
+	return backend.open(rawURL, config)
+}
+
+// The ID of a result's document in sinks that key documents: the same URL in
+// the same run is the same document, so a retried write can't store a result
+// twice
+func sinkDocumentID(runID, url string) string {
+	id := sha256.Sum256([]byte(runID + " " + url))
+	return hex.EncodeToString(id[:16])
+}
+
+// sinkErrors counts the results a sink failed to store on Write, keeping
+// the first failure. Workers record them all at once.
+type sinkErrors struct {
+	mu    sync.Mutex
+	count int
+	first error
+}
+
+func (e *sinkErrors) record(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.count++
+	if e.first == nil {
+		e.first = err
+	}
+}
+
+// The number of results not stored and the first failure
+func (e *sinkErrors) stats() (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.count, e.first
+}
+
+// sinkItem is a result encoded for a batched sink
+type sinkItem struct {
+	id   string // document ID, for sinks that have them
+	doc  []byte
+	done func() // tells the sink's user the result is stored
+}
+
+// batchSink queues encoded results and writes them in batches of the batch
+// size, or whatever is queued every sinkFlushEvery, retrying with
+// exponential backoff. The first failure that can't be retried stops the
+// crawl, and later results are dropped. Backends embed it for its Flush and
+// notifyStored.
+type batchSink struct {
+	options sinkOptions
+	// Write a batch, calling done for each result stored and returning the
+	// items to try again and, when the whole batch failed, whether it is
+	// worth retrying
+	writeBatch func(batch []sinkItem) ([]sinkItem, bool, error)
+	stop       func()
+	stored     func(Result) // set before the first result
+
+	items    chan sinkItem
+	flushes  chan chan struct{}
+	finished chan struct{}
+
+	mu  sync.Mutex
+	err error // the failure that stopped writing
+}
+
+func newBatchSink(config sinkConfig, writeBatch func([]sinkItem) ([]sinkItem, bool, error)) *batchSink {
+	b := &batchSink{
+		options:    config.options,
+		writeBatch: writeBatch,
+		stop:       config.stop,
+		// Room for two batches; a full queue holds up the crawl
+		items:    make(chan sinkItem, 2*config.options.batchSize),
+		flushes:  make(chan chan struct{}),
+		finished: make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *batchSink) notifyStored(stored func(Result)) {
+	b.stored = stored
+}
+
+// Queue a result's item, waiting while two batches are already queued
+func (b *batchSink) add(result Result, item sinkItem) {
+	item.done = func() {
+		if b.stored != nil {
+			b.stored(result)
+		}
+	}
+	b.items <- item
+}
+
+func (b *batchSink) run() {
+	defer close(b.finished)
+	ticker := time.NewTicker(sinkFlushEvery)
+	defer ticker.Stop()
+	var batch []sinkItem
+	for {
+		select {
+		case item, ok := <-b.items:
+			if !ok {
+				b.flush(batch)
+				return
+			}
+			batch = append(batch, item)
+			if len(batch) < b.options.batchSize {
+				continue
+			}
+		case <-ticker.C:
+		case flushed := <-b.flushes:
+			// Everything queued before Flush was called goes too
+			for len(b.items) > 0 {
+				batch = append(batch, <-b.items)
+			}
+			b.flush(batch)
+			batch = nil
+			close(flushed)
+			continue
+		}
+		b.flush(batch)
+		batch = nil
+	}
+}
+
+// Write what is queued now, returning the failure that stopped writing
+func (b *batchSink) Flush() error {
+	flushed := make(chan struct{})
+	b.flushes <- flushed
+	<-flushed
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// Write a batch, unless writing has failed already
+func (b *batchSink) flush(batch []sinkItem) {
+	b.mu.Lock()
+	failed := b.err != nil
+	b.mu.Unlock()
+	if failed || len(batch) == 0 {
+		return
+	}
+	if err := writeWithRetries(b.options, batch, b.writeBatch); err != nil {
+		b.fail(err)
+	}
+}
+
+// Write a batch, retrying what couldn't be written yet with exponential
+// backoff
+func writeWithRetries(options sinkOptions, batch []sinkItem, write func([]sinkItem) ([]sinkItem, bool, error)) error {
+	delay := options.backoff
+	for attempt := 1; len(batch) > 0; attempt++ {
+		var retry bool
+		var err error
+		batch, retry, err = write(batch)
+		if err != nil && (!retry || attempt >= options.retries) {
+			return err
+		}
+		if len(batch) > 0 {
+			if attempt >= options.retries {
+				return fmt.Errorf("%d results still refused after %d attempts", len(batch), attempt)
+			}
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return nil
+}
+
+// Give up on writing, stopping the crawl
+func (b *batchSink) fail(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err == nil {
+		b.err = err
+		if b.stop != nil {
+			b.stop()
+		}
+	}
+}
+
+// Write what is queued and stop, returning the failure that stopped writing
+func (b *batchSink) close() error {
+	close(b.items)
+	<-b.finished
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/msaberp/web-crawler-comparison/go-crawler/resultsink"
+)
+
+// A sink registered from outside the crawler's built-in backends. It keeps
+// what it is sent and writes it to the URL's path when closed. A
+// refusingsink:// one fails to store the results of /page-1.
+func init() {
+	resultsink.Register(resultsink.Backend{
+		Schemes: []string{"testsink"},
+		Open: func(rawURL string, config resultsink.Config) (resultsink.Sink, error) {
+			return &fakeSink{path: strings.TrimPrefix(rawURL, "testsink://"), RunID: config.RunID}, nil
+		},
+	})
+	resultsink.Register(resultsink.Backend{
+		Schemes: []string{"refusingsink"},
+		Open: func(rawURL string, config resultsink.Config) (resultsink.Sink, error) {
+			return &fakeSink{path: strings.TrimPrefix(rawURL, "refusingsink://"), RunID: config.RunID, refuse: "/page-1\""}, nil
+		},
+	})
+}
+
+type fakeSink struct {
+	path   string
+	refuse string // fail to store results containing this
+	mu     sync.Mutex
+
+	RunID   string            `json:"run_id"`
+	Results []json.RawMessage `json:"results"`
+	Summary json.RawMessage   `json:"summary"`
+	Flushes int               `json:"flushes"`
+}
+
+func (s *fakeSink) Write(result json.RawMessage) error {
+	if s.refuse != "" && strings.Contains(string(result), s.refuse) {
+		return fmt.Errorf("result refused")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Results = append(s.Results, result)
+	return nil
+}
+
+func (s *fakeSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Flushes++
+	return nil
+}
+
+func (s *fakeSink) Summarize(summary json.RawMessage) {
+	s.Summary = summary
+}
+
+func (s *fakeSink) Report() string {
+	return fmt.Sprintf("%d results sent to the test sink", len(s.Results))
+}
+
+func (s *fakeSink) Close() error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o644)
+}
+
+// A registered sink receives every result and the summary, with the results
+// file written through the same interface
+func TestRegisteredSink(t *testing.T) {
+	server := newFixtureServer()
+	defer server.Close()
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "urls.txt")
+	var urls []string
+	for i := 0; i < 5; i++ {
+		urls = append(urls, fmt.Sprintf("%s/page-%d", server.URL, i))
+	}
+	if err := os.WriteFile(input, []byte(strings.Join(urls, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "results.json")
+	sent := filepath.Join(dir, "sink.json")
+
+	for _, args := range [][]string{{}, {"-stream"}} {
+		args = append(args, "-input", input, "-output", output, "-sink", "testsink://"+sent)
+		out, code := runCrawler(t, args...)
+		if code != exitOK {
+			t.Fatalf("crawler %v exited with %d:\n%s", args, code, out)
+		}
+		if !strings.Contains(out, "5 results sent to the test sink") {
+			t.Errorf("%v: no report from the sink in:\n%s", args, out)
+		}
+
+		data, err := os.ReadFile(sent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var received struct {
+			RunID   string   `json:"run_id"`
+			Results []Result `json:"results"`
+			Summary struct {
+				Summary Summary      `json:"summary"`
+				Run     *RunMetadata `json:"run"`
+			} `json:"summary"`
+		}
+		if err := json.Unmarshal(data, &received); err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]int)
+		for _, result := range received.Results {
+			got[result.URL]++
+			if result.Status != http.StatusOK {
+				t.Errorf("%v: %s sent with status %d", args, result.URL, result.Status)
+			}
+		}
+		for _, urlStr := range urls {
+			if got[urlStr] != 1 {
+				t.Errorf("%v: %s sent %d times, want once", args, urlStr, got[urlStr])
+			}
+		}
+		if received.Summary.Summary.TotalURLs != len(urls) || received.Summary.Summary.SuccessfulFetches != len(urls) {
+			t.Errorf("%v: summary %+v, want %d URLs fetched", args, received.Summary.Summary, len(urls))
+		}
+		if received.Summary.Run == nil || received.Summary.Run.ID != received.RunID {
+			t.Errorf("%v: run metadata %+v, want run %s", args, received.Summary.Run, received.RunID)
+		}
+
+		data, err = os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var combined CombinedResults
+		if err := json.Unmarshal(data, &combined); err != nil {
+			t.Fatalf("%v: results file: %v", args, err)
+		}
+		if len(combined.Results) != len(urls) || combined.Summary.TotalURLs != len(urls) || combined.Run == nil {
+			t.Errorf("%v: results file has %d results, summary %+v", args, len(combined.Results), combined.Summary)
+		}
+	}
+}
+
+// Results a sink fails to store are counted in the summary, and fail the
+// crawl once the others are stored
+func TestSinkWriteErrors(t *testing.T) {
+	server := newFixtureServer()
+	defer server.Close()
+
+	dir := t.TempDir()
+	var urls []string
+	for i := 0; i < 3; i++ {
+		urls = append(urls, fmt.Sprintf("%s/page-%d", server.URL, i))
+	}
+	input := writeInput(t, "urls.txt", strings.Join(urls, "\n")+"\n")
+	output := filepath.Join(dir, "results.json")
+	sent := filepath.Join(dir, "sink.json")
+	out, code := runCrawler(t, "-input", input, "-output", output, "-sink", "refusingsink://"+sent)
+	if code != exitError || !strings.Contains(out, "Error sending results to -sink: 1 results not stored, the first: result refused") {
+		t.Fatalf("got exit code %d, want %d, with output:\n%s", code, exitError, out)
+	}
+
+	var received struct {
+		Results []Result `json:"results"`
+		Summary struct {
+			Summary Summary `json:"summary"`
+		} `json:"summary"`
+	}
+	data, err := os.ReadFile(sent)
+	if err == nil {
+		err = json.Unmarshal(data, &received)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received.Results) != 2 || received.Summary.Summary.SinkErrors != 1 {
+		t.Errorf("sink stored %d results, summary has %d sink errors; want 2 and 1", len(received.Results), received.Summary.Summary.SinkErrors)
+	}
+	var combined CombinedResults
+	data, err = os.ReadFile(output)
+	if err == nil {
+		err = json.Unmarshal(data, &combined)
+	}
+	if err != nil || combined.Summary.SinkErrors != 1 || len(combined.Results) != len(urls) {
+		t.Errorf("results file: %d results, %d sink errors, %v", len(combined.Results), combined.Summary.SinkErrors, err)
+	}
+}
+
+func TestSinkSchemes(t *testing.T) {
+	if backend := findSinkBackend("es://localhost:9200/crawl"); backend == nil || backend.schemes[0] != "es" {
+		t.Errorf("built-in es:// backend not found")
+	}
+	if backend := findSinkBackend("testsink:///tmp/x"); backend == nil {
+		t.Errorf("registered testsink:// backend not found")
+	}
+	err := checkSinkURL("nosuch://x")
+	if err == nil || !strings.Contains(err.Error(), "testsink://") || !strings.Contains(err.Error(), "mongodb://") {
+		t.Errorf("unknown scheme: got %v, want the built-in and registered schemes listed", err)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	// The sitemap protocol caps each file at 50,000 URLs and 50MB
+	// uncompressed; larger sites split their URLs across an index
+	maxSitemapEntries = 50000
+	maxSitemapSize    = 50 * 1024 * 1024
+)
+
+// sitemapDocument covers both <urlset> and <sitemapindex> files
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// Collect page URLs from sitemaps given as URLs or local paths. Sitemap
+// index files are followed, and gzipped sitemaps are decompressed. limit
+// caps the total number of URLs extracted (0 means no limit).
+func loadSitemaps(client *http.Client, sources []string, limit int) ([]string, error) {
+	var urls []string
+	seenURLs := make(map[string]bool)
+	seenSitemaps := make(map[string]bool)
+	queue := append([]string(nil), sources...)
+
+	for len(queue) > 0 && (limit == 0 || len(urls) < limit) {
+		source := queue[0]
+		queue = queue[1:]
+		if seenSitemaps[source] {
+			continue
+		}
+		seenSitemaps[source] = true
+
+		doc, err := fetchSitemap(client, source)
+		if err != nil {
+			return nil, fmt.Errorf("sitemap %s: %w", source, err)
+		}
+
+		for _, child := range doc.Sitemaps {
+			if loc := strings.TrimSpace(child.Loc); loc != "" {
+				queue = append(queue, loc)
+			}
+		}
+
+		entries := doc.URLs
+		if len(entries) > maxSitemapEntries {
+			fmt.Printf("Warning: sitemap %s lists %d URLs; only the first %d are used\n", source, len(entries), maxSitemapEntries)
+			entries = entries[:maxSitemapEntries]
+		}
+		for _, entry := range entries {
+			loc := strings.TrimSpace(entry.Loc)
+			if loc == "" || seenURLs[loc] {
+				continue
+			}
+			seenURLs[loc] = true
+			urls = append(urls, loc)
+			if limit > 0 && len(urls) >= limit {
+				break
+			}
+		}
+	}
+
+	return urls, nil
+}
+
+// Fetch or open a sitemap and decode it, decompressing gzip content
+func fetchSitemap(client *http.Client, source string) (*sitemapDocument, error) {
+	var body io.ReadCloser
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		resp, err := client.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		body = resp.Body
+	} else {
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		body = file
+	}
+	defer body.Close()
+
+	// Detect gzip by its magic bytes rather than trusting names or headers
+	reader := bufio.NewReader(body)
+	var content io.Reader = reader
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		content = gz
+	}
+
+	var doc sitemapDocument
+	if err := xml.NewDecoder(io.LimitReader(content, maxSitemapSize)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decoding XML: %w", err)
+	}
+	return &doc, nil
+}
+
+// Find the sitemaps a site advertises through Sitemap: lines in its
+// robots.txt, falling back to /sitemap.xml when none are listed. site may be
+// a bare host name or a URL; bare hosts use https.
+func discoverSitemaps(client *http.Client, site string) ([]string, error) {
+	base := strings.TrimSuffix(site, "/")
+	if !strings.HasPrefix(base, "http://") && !strings.HasPrefix(base, "https://") {
+		base = "https://" + base
+	}
+
+	resp, err := client.Get(base + "/robots.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var sitemaps []string
+	if resp.StatusCode == http.StatusOK {
+		scanner := bufio.NewScanner(io.LimitReader(resp.Body, maxRobotsSize))
+		for scanner.Scan() {
+			field, value, ok := strings.Cut(scanner.Text(), ":")
+			if ok && strings.EqualFold(strings.TrimSpace(field), "sitemap") {
+				if loc := strings.TrimSpace(value); loc != "" {
+					sitemaps = append(sitemaps, loc)
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(sitemaps) == 0 {
+		sitemaps = append(sitemaps, base+"/sitemap.xml")
+	}
+	return sitemaps, nil
+}
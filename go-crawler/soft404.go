@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Wording of error pages, matched against a page's title and first heading
+var soft404Regex = regexp.MustCompile(`(?i)\b(?:404|not found|page (?:cannot|can't|could not|couldn't) be found|(?:page|file) (?:does not|doesn't|no longer) exists?|no longer available)\b`)
+
+// First h1 element, matched in any case and across lines
+var h1Regex = regexp.MustCompile(`(?is)<h1[^>]*>(.*?)</h1>`)
+
+// soft404Detector flags pages that answer 200 with an error page. The
+// wording of the title and first heading gives most away; with calibration
+// each host is also asked for a path that can't exist, and pages that look
+// like its answer are flagged too.
+type soft404Detector struct {
+	calibrate bool
+	mu        sync.Mutex
+	hosts     map[string]*soft404Calibration
+	pages     int
+}
+
+// soft404Calibration is a host's answer for a path that doesn't exist
+type soft404Calibration struct {
+	once sync.Once
+	page *Result // nil when the host answers such paths with an error status
+}
+
+func newSoft404Detector(calibrate bool) *soft404Detector {
+	return &soft404Detector{calibrate: calibrate, hosts: make(map[string]*soft404Calibration)}
+}
+
+// Reason a page's title or first heading gives for being an error page
+func soft404TextReason(title, content string) string {
+	if soft404Regex.MatchString(title) {
+		return "title says the page was not found"
+	}
+	if matches := h1Regex.FindStringSubmatch(content); len(matches) > 1 {
+		heading := html.UnescapeString(tagRegex.ReplaceAllString(matches[1], " "))
+		if soft404Regex.MatchString(heading) {
+			return "heading says the page was not found"
+		}
+	}
+	return ""
+}
+
+// Check a parsed 2xx HTML page against its host's not-found page, fetching
+// that first if this is the host's first page
+func (d *soft404Detector) check(result *Result, page *url.URL, client *http.Client, opts *fetchOptions) {
+	if result.Soft404 == "" && d.calibrate {
+		if notFound := d.calibration(page, client, opts); notFound != nil {
+			// Sites often share a title across pages, so a title match
+			// also needs a body of about the same size
+			if result.ContentHash == notFound.ContentHash ||
+				(result.Title == notFound.Title && result.Title != "No title found" && similarSize(result.DecodedBytes, notFound.DecodedBytes)) {
+				result.Soft404 = "looks like the host's page for a path that doesn't exist"
+			}
+		}
+	}
+	if result.Soft404 != "" {
+		d.mu.Lock()
+		d.pages++
+		d.mu.Unlock()
+	}
+}
+
+// Report whether two body sizes are within a tenth of each other
+func similarSize(a, b int64) bool {
+	diff := a - b
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff*10 <= max(a, b)
+}
+
+// Fetch the page a host serves for a random path, once per host. Returns nil
+// unless the host answers it with 200.
+func (d *soft404Detector) calibration(page *url.URL, client *http.Client, opts *fetchOptions) *Result {
+	d.mu.Lock()
+	calibration := d.hosts[page.Host]
+	if calibration == nil {
+		calibration = &soft404Calibration{}
+		d.hosts[page.Host] = calibration
+	}
+	d.mu.Unlock()
+
+	calibration.once.Do(func() {
+		random := make([]byte, 12)
+		rand.Read(random)
+		probe := url.URL{Scheme: page.Scheme, Host: page.Host, Path: "/crawler-soft-404-check-" + hex.EncodeToString(random)}
+		if opts.limiter != nil {
+			opts.limiter.wait()
+		}
+		result := fetchURL(probe.String(), client, time.Now(), page.Host, nil, opts)
+		if result.Status == http.StatusOK {
+			calibration.page = &result
+		}
+	})
+	return calibration.page
+}
+
+// Soft404Stats counts flagged pages and lists the hosts that answer paths
+// that don't exist with 200
+type Soft404Stats struct {
+	Pages           int      `json:"pages"`
+	HostsWithout404 []string `json:"hosts_without_404,omitempty"`
+}
+
+// Stats returns the soft 404 counters
+func (d *soft404Detector) Stats() Soft404Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats := Soft404Stats{Pages: d.pages}
+	for host, calibration := range d.hosts {
+		if calibration.page != nil {
+			stats.HostsWithout404 = append(stats.HostsWithout404, host)
+		}
+	}
+	sort.Strings(stats.HostsWithout404)
+	return stats
+}
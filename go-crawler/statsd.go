@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// statsdClient sends metrics to a StatsD server over UDP. With tags enabled
+// it uses the DogStatsD tag extension. Sends are fire and forget.
+type statsdClient struct {
+	conn   net.Conn
+	prefix string
+	tags   bool
+}
+
+// Connect to a StatsD server at host:port
+func newStatsdClient(addr, prefix string, tags bool) (*statsdClient, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdClient{conn: conn, prefix: prefix, tags: tags}, nil
+}
+
+func (s *statsdClient) send(name, value, kind string, tags []string) {
+	line := s.prefix + name + ":" + value + "|" + kind
+	if s.tags && len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	s.conn.Write([]byte(line))
+}
+
+func (s *statsdClient) count(name string, value int64, tags ...string) {
+	s.send(name, fmt.Sprint(value), "c", tags)
+}
+
+func (s *statsdClient) timing(name string, ms float64, tags ...string) {
+	s.send(name, fmt.Sprintf("%.3f", ms), "ms", tags)
+}
+
+// Emit the metrics for one finished URL
+func (s *statsdClient) recordResult(result Result) {
+	domain := "domain:" + statsdTagValue(result.Domain)
+	if result.SkipReason != "" {
+		s.count("request.skipped", 1, domain)
+		return
+	}
+
+	status := fmt.Sprintf("status:%d", result.Status)
+	s.timing("request.time", result.TimeTaken*1000, domain, status)
+	if resultSucceeded(result) {
+		s.count("request.success", 1, domain, status)
+	} else {
+		s.count("request.error", 1, domain, status)
+	}
+	if result.Timeout != "" {
+		s.count("request.timeout", 1, domain, "kind:"+result.Timeout)
+	}
+	if result.BytesDownloaded > 0 {
+		s.count("bytes", result.BytesDownloaded, domain)
+	}
+}
+
+func (s *statsdClient) Close() error {
+	return s.conn.Close()
+}
+
+// DogStatsD reserves ',' '|' and '#' in tags
+func statsdTagValue(value string) string {
+	return strings.NewReplacer(",", "_", "|", "_", "#", "_").Replace(value)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Flags whose analysis needs every result in memory
+var streamIncompatibleFlags = []string{"pagerank", "graph-output", "near-duplicates", "check-hreflang", "push-gateway", "sort", "retry-from", "history"}
+
+// Reject flags that can't work when results are streamed out
+func checkStreamFlags(flags *flag.FlagSet) error {
+	var err error
+	flags.Visit(func(f *flag.Flag) {
+		for _, name := range streamIncompatibleFlags {
+			if f.Name == name && err == nil {
+				err = fmt.Errorf("-stream cannot be combined with -%s, which needs every result in memory", name)
+			}
+		}
+	})
+	return err
+}
+
+// resultTally holds the counters the summary needs from every result
+type resultTally struct {
+	total      int
+	successful int
+	failed     int
+	unchanged  int
+	skipped    int
+	assertions int
+	timeouts   map[string]int
+	bytes      int64
+	tags       map[string]*tagTally
+}
+
+func (t *resultTally) add(result Result) {
+	t.total++
+	t.bytes += result.BytesDownloaded
+	if result.SkipReason != "" {
+		t.skipped++
+	} else if resultSucceeded(result) {
+		t.successful++
+	} else {
+		t.failed++
+	}
+	if result.Unchanged {
+		t.unchanged++
+	}
+	if result.AssertionFailed != "" {
+		t.assertions++
+	}
+	if result.Timeout != "" {
+		if t.timeouts == nil {
+			t.timeouts = make(map[string]int)
+		}
+		t.timeouts[result.Timeout]++
+	}
+	t.addTags(result)
+}
+
+// resultStream is the ResultSink writing results to the results file as they
+// complete, keeping only the summary counters in memory. The file has the
+// same shape as one written by saveResults, with the results array written
+// before the summary.
+type resultStream struct {
+	file    *os.File
+	w       *bufio.Writer
+	tally   resultTally
+	filter  *resultFilter // results that fail it are tallied but not written
+	format  outputFormat
+	written int
+
+	// Written after the results by Close
+	summary    Summary
+	throughput []ThroughputSample
+	run        *RunMetadata
+}
+
+// Create the results file and start its results array
+func createResultStream(filePath string) (*resultStream, error) {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return nil, err
+	}
+	s := &resultStream{file: file, w: bufio.NewWriter(file)}
+	if _, err := s.w.WriteString("{\n  \"results\": ["); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Append a result to the file. Only the stream's collector may call it.
+func (s *resultStream) Write(result Result) error {
+	s.tally.add(result)
+	if s.filter != nil && !s.filter.keep(result) {
+		s.filter.dropped++
+		return nil
+	}
+	data, err := json.MarshalIndent(s.format.result(result), "    ", "  ")
+	if err != nil {
+		return err
+	}
+	separator := "\n    "
+	if s.written > 0 {
+		separator = ",\n    "
+	}
+	s.written++
+	if _, err := s.w.WriteString(separator); err != nil {
+		return err
+	}
+	_, err = s.w.Write(data)
+	return err
+}
+
+// Write out what is buffered
+func (s *resultStream) Flush() error {
+	return s.w.Flush()
+}
+
+func (s *resultStream) summarize(summary Summary, throughput []ThroughputSample, run *RunMetadata) {
+	s.summary, s.throughput, s.run = summary, throughput, run
+}
+
+// Close the results array, write the summary, throughput and run metadata,
+// and close the file
+func (s *resultStream) Close() error {
+	defer s.file.Close()
+	summary, throughput, run := s.summary, s.throughput, s.run
+
+	closing := "\n  ],\n  \"summary\": "
+	if s.written == 0 {
+		closing = "],\n  \"summary\": "
+	}
+	s.w.WriteString(closing)
+	data, err := json.MarshalIndent(s.format.summary(summary), "  ", "  ")
+	if err != nil {
+		return err
+	}
+	s.w.Write(data)
+	if len(throughput) > 0 && !s.format.python {
+		data, err = json.MarshalIndent(throughput, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		s.w.WriteString(",\n  \"throughput\": ")
+		s.w.Write(data)
+	}
+	if run != nil && !s.format.python {
+		data, err = json.MarshalIndent(run, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		s.w.WriteString(",\n  \"run\": ")
+		s.w.Write(data)
+	}
+	s.w.WriteString("\n}\n")
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return s.file.Close()
+}
+
+// resultFile is the ResultSink writing the results file in one go when it
+// is closed, for crawls that keep their results in memory to sort and
+// analyse them. Results are written to it once the crawl is over.
+type resultFile struct {
+	path    string
+	format  outputFormat
+	results CombinedResults
+}
+
+func (f *resultFile) Write(result Result) error {
+	f.results.Results = append(f.results.Results, result)
+	return nil
+}
+
+// Nothing is written before Close
+func (f *resultFile) Flush() error {
+	return nil
+}
+
+func (f *resultFile) summarize(summary Summary, throughput []ThroughputSample, run *RunMetadata) {
+	f.results.Summary, f.results.Throughput, f.results.Run = summary, throughput, run
+}
+
+// Write the results, summary, throughput and run metadata
+func (f *resultFile) Close() error {
+	return saveResults(f.results, f.format, f.path)
+}
+
+// Store the run's summary in a sink that keeps one, and close the sink
+func closeSink(sink ResultSink, summary Summary, throughput []ThroughputSample, run *RunMetadata) error {
+	if summarizing, ok := sink.(summarySink); ok {
+		summarizing.summarize(summary, throughput, run)
+	}
+	return sink.Close()
+}
+
+// Hand a finished result to the store stage: append it to the in-memory list,
+// or write it out when streaming. Failed URLs also go to the failures file.
+func (o *fetchOptions) store(results []Result, result Result) ([]Result, error) {
+	if o.failures != nil {
+		if err := o.failures.add(result); err != nil {
+			return results, err
+		}
+	}
+	if o.stream != nil {
+		return results, o.stream.Write(result)
+	}
+	return append(results, result), nil
+}
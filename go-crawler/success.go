@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Statuses that count as a successful fetch unless -success-status says
+// otherwise: any 2xx, and 304 when a conditional request finds the page
+// unchanged
+const defaultSuccessStatuses = "2xx,304"
+
+// statusRange is an inclusive range of HTTP status codes
+type statusRange struct {
+	low, high int
+}
+
+// Statuses counted as successes, set from -success-status before the crawl
+var successStatuses, _ = parseStatusRanges(defaultSuccessStatuses)
+
+// Parse a comma separated list of statuses: single codes (200), classes
+// (2xx) and ranges (200-299)
+func parseStatusRanges(spec string) ([]statusRange, error) {
+	var ranges []statusRange
+	for _, value := range strings.Split(spec, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		var r statusRange
+		var err error
+		if low, high, ok := strings.Cut(value, "-"); ok {
+			r.low, err = strconv.Atoi(low)
+			if err == nil {
+				r.high, err = strconv.Atoi(high)
+			}
+		} else if len(value) == 3 && strings.HasSuffix(strings.ToLower(value), "xx") {
+			r.low, err = strconv.Atoi(value[:1])
+			r.low *= 100
+			r.high = r.low + 99
+		} else {
+			r.low, err = strconv.Atoi(value)
+			r.high = r.low
+		}
+		if err != nil || r.low < 100 || r.high > 599 || r.low > r.high {
+			return nil, fmt.Errorf("invalid status %q: want a code (200), a class (2xx) or a range (200-299)", value)
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no statuses given")
+	}
+	return ranges, nil
+}
+
+// Report whether a status is in the success list
+func statusSucceeded(status int) bool {
+	for _, r := range successStatuses {
+		if r.low <= status && status <= r.high {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// Split a plain text input line into its URL and the "#tag" words after it,
+// e.g. "https://example.com/cart #checkout #critical". A "#" inside the URL
+// is still a fragment.
+func splitTaggedLine(line string) (string, []string) {
+	fields := strings.Fields(line)
+	end := len(fields)
+	for end > 1 && strings.HasPrefix(fields[end-1], "#") {
+		end--
+	}
+	if end == len(fields) {
+		return strings.TrimSpace(line), nil
+	}
+	return strings.Join(fields[:end], " "), parseTags(strings.Join(fields[end:], " "))
+}
+
+// Parse a tag list separated by spaces or commas, with or without a leading
+// "#", dropping repeats
+func parseTags(value string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+		tag = strings.TrimLeft(tag, "#")
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// Report whether a result carries any of the tags
+func hasAnyTag(result Result, tags map[string]bool) bool {
+	for _, tag := range result.Tags {
+		if tags[tag] {
+			return true
+		}
+	}
+	return false
+}
+
+// TagStats aggregates the fetches of the URLs carrying one tag, so critical
+// paths can be watched apart from the long tail. Skipped URLs are left out.
+type TagStats struct {
+	Tag         string  `json:"tag"`
+	URLs        int     `json:"urls"`
+	Successful  int     `json:"successful"`
+	Failed      int     `json:"failed"`
+	SuccessRate float64 `json:"success_rate"` // fraction of URLs that succeeded
+	AverageTime float64 `json:"average_time"`
+	P95Time     float64 `json:"p95_time"`
+}
+
+// tagTally collects the fetch times of one tag's URLs
+type tagTally struct {
+	successful int
+	times      []float64
+}
+
+// Count a fetched result under each of its tags
+func (t *resultTally) addTags(result Result) {
+	if len(result.Tags) == 0 || result.SkipReason != "" {
+		return
+	}
+	if t.tags == nil {
+		t.tags = make(map[string]*tagTally)
+	}
+	for _, tag := range result.Tags {
+		tally := t.tags[tag]
+		if tally == nil {
+			tally = &tagTally{}
+			t.tags[tag] = tally
+		}
+		tally.times = append(tally.times, result.TimeTaken)
+		if resultSucceeded(result) {
+			tally.successful++
+		}
+	}
+}
+
+// Per-tag aggregates in tag order, nil when no result had tags
+func (t *resultTally) tagStats() []TagStats {
+	var stats []TagStats
+	for tag, tally := range t.tags {
+		urls := len(tally.times)
+		total := 0.0
+		for _, seconds := range tally.times {
+			total += seconds
+		}
+		stats = append(stats, TagStats{
+			Tag:         tag,
+			URLs:        urls,
+			Successful:  tally.successful,
+			Failed:      urls - tally.successful,
+			SuccessRate: float64(tally.successful) / float64(urls),
+			AverageTime: total / float64(urls),
+			P95Time:     percentile(tally.times, 95),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Tag < stats[j].Tag })
+	return stats
+}
+
+// Nearest-rank percentile of a list of values, which is sorted in place
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	rank := int(math.Ceil(p / 100 * float64(len(values))))
+	return values[max(rank, 1)-1]
+}
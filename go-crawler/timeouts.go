@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Timeout kinds reported in Result.Timeout
+const (
+	timeoutConnect        = "connect"
+	timeoutTLSHandshake   = "tls_handshake"
+	timeoutResponseHeader = "response_header"
+	timeoutTotal          = "total"
+)
+
+// timeoutConfig holds the individual request timeouts; zero disables one
+type timeoutConfig struct {
+	connect        time.Duration // establishing the TCP connection
+	tlsHandshake   time.Duration // completing the TLS handshake
+	responseHeader time.Duration // waiting for response headers after the request is sent
+	total          time.Duration // the whole request including reading the body
+}
+
+// Setup the HTTP client used by all workers
+func newHTTPClient(timeouts timeoutConfig) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   timeouts.connect,
+		KeepAlive: 30 * time.Second,
+	}
+
+	return &http.Client{
+		Timeout: timeouts.total,
+		Transport: userAgentTransport{&http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   timeouts.tlsHandshake,
+			ResponseHeaderTimeout: timeouts.responseHeader,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   10,
+			IdleConnTimeout:       30 * time.Second,
+		}},
+	}
+}
+
+// userAgentTransport sends the crawler's User-Agent with every request that
+// doesn't set its own, so servers see the agent robots.txt is matched for
+type userAgentTransport struct {
+	*http.Transport
+}
+
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", userAgent())
+	}
+	return t.Transport.RoundTrip(req)
+}
+
+// Work out which timeout caused a request error, or "" if none did
+func classifyTimeout(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	// net/http reports these through unexported error types, so match the
+	// messages it documents
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "Client.Timeout"):
+		return timeoutTotal
+	case strings.Contains(message, "TLS handshake timeout"):
+		return timeoutTLSHandshake
+	case strings.Contains(message, "timeout awaiting response headers"):
+		return timeoutResponseHeader
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout() {
+		return timeoutConnect
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return timeoutTotal
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// TitleGroup lists pages that share the same title
+type TitleGroup struct {
+	Title string   `json:"title"`
+	Count int      `json:"count"`
+	URLs  []string `json:"urls"`
+}
+
+// Report whether a result's title came from an HTML page rather than being
+// a placeholder for errors or other content types
+func hasPageTitle(result Result) bool {
+	if result.Status < 200 || result.Status > 299 || result.Title == "" || result.Title == "No title found" {
+		return false
+	}
+	for _, prefix := range []string{"Error", "Non-HTML content:", "JSON Response:"} {
+		if strings.HasPrefix(result.Title, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// Find titles used by more than one page, most widely shared first
+func findDuplicateTitles(results []Result) []TitleGroup {
+	byTitle := make(map[string][]string)
+	var order []string
+	for _, result := range results {
+		if !hasPageTitle(result) {
+			continue
+		}
+		if _, ok := byTitle[result.Title]; !ok {
+			order = append(order, result.Title)
+		}
+		byTitle[result.Title] = append(byTitle[result.Title], result.URL)
+	}
+
+	var groups []TitleGroup
+	for _, title := range order {
+		urls := byTitle[title]
+		if len(urls) < 2 {
+			continue
+		}
+		sort.Strings(urls)
+		groups = append(groups, TitleGroup{Title: title, Count: len(urls), URLs: urls})
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Count > groups[j].Count })
+
+	return groups
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"time"
+)
+
+// requestTrace times the phases of a request with httptrace. Phases are
+// summed over redirect hops; hooks may fire from transport goroutines.
+type requestTrace struct {
+	mu sync.Mutex
+
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+
+	dns      time.Duration
+	connect  time.Duration
+	tls      time.Duration
+	ttfb     time.Duration
+	download time.Duration
+
+	gotConn bool
+	reused  bool // whether the last connection came from the idle pool
+}
+
+// Attach a new trace to a request
+func traceRequest(req *http.Request) (*http.Request, *requestTrace) {
+	t := &requestTrace{}
+	clientTrace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.gotConn = true
+			t.reused = info.Reused
+			t.mu.Unlock()
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			t.dnsStart = time.Now()
+			t.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			t.dns += time.Since(t.dnsStart)
+			t.mu.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+			t.mu.Unlock()
+		},
+		// With several addresses only the dial that succeeded counts
+		ConnectDone: func(_, _ string, err error) {
+			t.mu.Lock()
+			if err == nil && !t.connectStart.IsZero() {
+				t.connect += time.Since(t.connectStart)
+				t.connectStart = time.Time{}
+			}
+			t.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			t.tlsStart = time.Now()
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			t.tls += time.Since(t.tlsStart)
+			t.mu.Unlock()
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.mu.Lock()
+			t.wroteRequest = time.Now()
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			t.firstByte = time.Now()
+			if !t.wroteRequest.IsZero() {
+				t.ttfb += t.firstByte.Sub(t.wroteRequest)
+			}
+			t.mu.Unlock()
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), clientTrace)), t
+}
+
+// Mark the response body as fully read
+func (t *requestTrace) bodyDone() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.firstByte.IsZero() {
+		t.download = time.Since(t.firstByte)
+	}
+}
+
+// Copy the phase timings into a result, in milliseconds
+func (t *requestTrace) apply(result *Result) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result.DNSMs = milliseconds(t.dns)
+	result.ConnectMs = milliseconds(t.connect)
+	result.TLSMs = milliseconds(t.tls)
+	result.TTFBMs = milliseconds(t.ttfb)
+	result.DownloadMs = milliseconds(t.download)
+	if t.gotConn {
+		reused := t.reused
+		result.ConnectionReused = &reused
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// ConnectionCounts tallies requests by whether they reused a connection
+type ConnectionCounts struct {
+	Requests  int     `json:"requests"`
+	Reused    int     `json:"reused"`
+	New       int     `json:"new"`
+	ReuseRate float64 `json:"reuse_rate"`
+}
+
+func (c *ConnectionCounts) add(reused bool) {
+	c.Requests++
+	if reused {
+		c.Reused++
+	} else {
+		c.New++
+	}
+	c.ReuseRate = float64(c.Reused) / float64(c.Requests)
+}
+
+// ConnectionStats reports keep-alive connection reuse overall and per domain
+type ConnectionStats struct {
+	ConnectionCounts
+	Domains map[string]*ConnectionCounts `json:"domains"`
+}
+
+// Summarize connection reuse, or return nil when no request got a connection
+func summarizeConnections(results []Result) *ConnectionStats {
+	stats := &ConnectionStats{Domains: make(map[string]*ConnectionCounts)}
+	for _, result := range results {
+		if result.ConnectionReused == nil {
+			continue
+		}
+		domain := stats.Domains[result.Domain]
+		if domain == nil {
+			domain = &ConnectionCounts{}
+			stats.Domains[result.Domain] = domain
+		}
+		domain.add(*result.ConnectionReused)
+		stats.add(*result.ConnectionReused)
+	}
+	if stats.Requests == 0 {
+		return nil
+	}
+	return stats
+}
+
+// Domains with the most new connections first
+func domainsByNewConnections(stats *ConnectionStats) []string {
+	domains := make([]string, 0, len(stats.Domains))
+	for domain := range stats.Domains {
+		domains = append(domains, domain)
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		a, b := stats.Domains[domains[i]], stats.Domains[domains[j]]
+		if a.New != b.New {
+			return a.New > b.New
+		}
+		return domains[i] < domains[j]
+	})
+	return domains
+}
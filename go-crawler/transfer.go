@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter int64
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	*c += countingWriter(len(p))
+	return len(p), nil
+}
+
+// Approximate size of the response status line and headers as sent by the
+// server
+func headerSize(resp *http.Response) int64 {
+	var size countingWriter
+	fmt.Fprintf(&size, "%s %s\r\n", resp.Proto, resp.Status)
+	resp.Header.Write(&size)
+	size += 2 // blank line ending the headers
+	return int64(size)
+}
+
+// Record the bytes transferred for a response and the effective download
+// speed over the whole request
+func setTransferStats(result *Result, resp *http.Response, bodyBytes int64) {
+	result.HeaderBytes = headerSize(resp)
+	result.BodyBytes = bodyBytes
+	result.BytesDownloaded = result.HeaderBytes + result.BodyBytes
+	if result.TimeTaken > 0 {
+		result.BytesPerSecond = float64(result.BytesDownloaded) / result.TimeTaken
+	}
+}
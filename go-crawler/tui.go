@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ANSI sequences to clear the screen and move the cursor home
+const (
+	ansiClear = "\033[H\033[2J"
+	ansiBold  = "\033[1m"
+	ansiRed   = "\033[31m"
+	ansiReset = "\033[0m"
+)
+
+// Redraw a live dashboard of the crawl every interval until the returned
+// function is called
+func startTUI(w io.Writer, progress *crawlProgress, interval time.Duration) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			renderTUI(w, progress.snapshot(5))
+			select {
+			case <-ticker.C:
+			case <-stop:
+				renderTUI(w, progress.snapshot(5))
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+func renderTUI(w io.Writer, s ProgressSnapshot) {
+	var b strings.Builder
+	b.WriteString(ansiClear)
+	fmt.Fprintf(&b, "%sgo-crawler%s  elapsed %s\n\n", ansiBold, ansiReset, time.Duration(s.Elapsed*float64(time.Second)).Truncate(time.Second))
+
+	fmt.Fprintf(&b, "Workers busy  %s %d/%d\n", progressBar(s.Busy, s.Workers, 20), s.Busy, s.Workers)
+	fmt.Fprintf(&b, "Queue depth   %d\n", s.Queued)
+	fmt.Fprintf(&b, "Completed     %d (%d failed)\n", s.Completed, s.Failed)
+	fmt.Fprintf(&b, "Requests/sec  %.1f\n", s.RequestsPerSecond)
+
+	fmt.Fprintf(&b, "\n%sSlowest domains%s (average time per URL)\n", ansiBold, ansiReset)
+	if len(s.SlowDomains) == 0 {
+		b.WriteString("  -\n")
+	}
+	for _, domain := range s.SlowDomains {
+		fmt.Fprintf(&b, "  %-40s %7.3fs  (%d URLs)\n", truncate(domain.Domain, 40), domain.AverageTime, domain.URLs)
+	}
+
+	fmt.Fprintf(&b, "\n%sRecent errors%s\n", ansiBold, ansiReset)
+	if len(s.RecentErrors) == 0 {
+		b.WriteString("  -\n")
+	}
+	for _, result := range s.RecentErrors {
+		fmt.Fprintf(&b, "  %s%4d%s %s  %s\n", ansiRed, result.Status, ansiReset, truncate(result.URL, 60), truncate(result.Title, 50))
+	}
+
+	io.WriteString(w, b.String())
+}
+
+func progressBar(value, max, width int) string {
+	filled := 0
+	if max > 0 {
+		filled = value * width / max
+	}
+	if filled > width {
+		filled = width
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", width-filled) + "]"
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max-3] + "..."
+}
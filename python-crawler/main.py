@@ -17,36 +17,28 @@ async def fetch_url(session, url, semaphore):
         # Use semaphore to limit concurrency
         async with semaphore:
             async with session.get(url, timeout=10) as response:
-                if response.status == 200:
-                    content_type = response.headers.get('Content-Type', '')
-                    if 'text/html' in content_type:
-                        html = await response.text()
-                        soup = BeautifulSoup(html, 'html.parser')
-                        title = soup.title.string if soup.title else "No title found"
-                    else:
-                        # For non-HTML responses, like JSON
-                        if 'application/json' in content_type:
-                            data = await response.json()
-                            title = f"JSON Response: {len(str(data))} characters"
-                        else:
-                            title = f"Non-HTML content: {content_type}"
-                    
-                    end_time = time.time()
-                    return {
-                        "url": url,
-                        "title": title.strip() if isinstance(title, str) else str(title),
-                        "status": response.status,
-                        "time_taken": end_time - start_time,
-                        "domain": domain
-                    }
+                # Titles come from the body whatever the status, as in the
+                # Go crawler and the shared conformance fixture
+                content_type = response.headers.get('Content-Type', '')
+                if 'text/html' in content_type:
+                    html = await response.text()
+                    soup = BeautifulSoup(html, 'html.parser')
+                    title = soup.title.get_text() if soup.title else "No title found"
+                elif 'application/json' in content_type:
+                    # Length of the raw body in bytes
+                    body = await response.read()
+                    title = f"JSON Response: {len(body)} characters"
                 else:
-                    return {
-                        "url": url,
-                        "title": f"Error: HTTP {response.status}",
-                        "status": response.status,
-                        "time_taken": time.time() - start_time,
-                        "domain": domain
-                    }
+                    title = f"Non-HTML content: {content_type}"
+
+                end_time = time.time()
+                return {
+                    "url": url,
+                    "title": title.strip(),
+                    "status": response.status,
+                    "time_taken": end_time - start_time,
+                    "domain": domain
+                }
     except asyncio.TimeoutError:
         return {
             "url": url,